@@ -1,13 +1,595 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"key-value-engine/structs/Engine"
+	"key-value-engine/structs/config"
+	"key-value-engine/structs/resp"
+	"key-value-engine/structs/rest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const usage = `usage: kv [global flags] [command] [arguments]
+
+commands:
+  repl                                    interactive interpreter, the default command
+  get {key}                               prints the value of the key
+  put {key} {value}                       stores the key-value pair
+  scan [--prefix p | --min a --max b | --match glob | --regex re] [--page n | --cursor c] [--limit n]
+       [--contains text | --json field=value]
+                                          prints a page of keys, the first page and the pages
+                                          read with --cursor print the cursor of the next page,
+                                          --contains and --json keep the values matching them
+  count|du|bounds [--prefix p | --min a --max b] [--approx]
+                                          prints the number of keys, the bytes of their keys and values
+                                          or the first and the last key, --approx estimates count and du
+                                          from the SSTable indexes
+  exec {script}                           runs the commands of the script
+  serve [--http] [address]                runs the RESP server, or the HTTP server with --http
+  bench [--entries n] [--keys n] [--value-size n]
+                                          measures puts and gets
+  compact                                 flushes the memtables and merges the SSTables
+  verify                                  checks the SSTables against their merkle trees
+
+global flags:
+  --data-dir {dir}                        data directory (default data)
+  --config {path}                         configuration file (default conf/config.json)
+  --set {name=value}                      overrides a setting of the configuration file, can be repeated
+  --output {text|json}                    output of commands, json prints one object per command (default text)
+  --batch                                 runs the commands read from the standard input
+`
+
+// cliOptions are the global flags
+type cliOptions struct {
+	dataDir    string
+	configPath string
+	output     string
+	batch      bool
+	settings   settingsFlag
+}
+
+// settingsFlag collects the name=value pairs of the repeated --set flag
+type settingsFlag []string
+
+func (s *settingsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *settingsFlag) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return errors.New("setting must be name=value")
+	}
+	*s = append(*s, value)
+	return nil
+}
+
+// addGlobalFlags adds the global flags to the flag set, so they are accepted before and after the command
+func addGlobalFlags(fs *flag.FlagSet, cli *cliOptions) {
+	fs.StringVar(&cli.dataDir, "data-dir", cli.dataDir, "data directory")
+	fs.StringVar(&cli.configPath, "config", cli.configPath, "configuration file")
+	fs.StringVar(&cli.output, "output", cli.output, "output format, text or json")
+	fs.BoolVar(&cli.batch, "batch", cli.batch, "run commands from the standard input")
+	fs.Var(&cli.settings, "set", "configuration override name=value")
+}
+
+// commandFlags returns the flag set of the command with the global flags added
+func commandFlags(command string, cli *cliOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	addGlobalFlags(fs, cli)
+	return fs
+}
+
+/*
+parseFlags parses the flags of the command, flags are accepted before and after its arguments.
+Everything after -- is an argument, so keys starting with - can be given.
+*/
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, rest = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
 func main() {
-	e := Engine.MakeEngine()
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the command line and returns the exit code
+func run(args []string) int {
+	cli := &cliOptions{
+		dataDir:    Engine.DATA_DIRECTORY,
+		configPath: config.CONFIG_PATH,
+		output:     Engine.OUTPUT_TEXT,
+	}
+
+	fs := commandFlags("kv", cli)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	args = fs.Args()
+
+	command := "repl"
+	if cli.batch {
+		command = "batch"
+	}
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "repl":
+		return repl(cli, args)
+	case "batch":
+		return batch(cli, "")
+	case "exec":
+		return exec(cli, args)
+	case "get":
+		return single(cli, "get", args, 1)
+	case "put":
+		return single(cli, "put", args, 2)
+	case "scan":
+		return scan(cli, args)
+	case "count", "du", "bounds":
+		return aggregate(cli, command, args)
+	case "serve", "serve-http":
+		return serve(cli, args, command == "serve-http")
+	case "bench":
+		return bench(cli, args)
+	case "compact":
+		return compact(cli, args)
+	case "verify":
+		return verify(cli, args)
+	}
+
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
+
+// loadOptions reads the configuration file and applies the flags to it
+func loadOptions(cli *cliOptions) (Engine.Options, error) {
+	if cli.output != Engine.OUTPUT_TEXT && cli.output != Engine.OUTPUT_JSON {
+		return Engine.Options{}, errors.New("output must be text or json")
+	}
+
+	opts, err := Engine.LoadOptions(cli.dataDir, cli.configPath)
+	if err != nil && opts.Directory == "" {
+		return opts, err
+	}
+	if err != nil {
+		// the defaults are used in place of an unreadable file
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	for _, setting := range cli.settings {
+		name, value, _ := strings.Cut(setting, "=")
+		if err := opts.Config.Set(name, value); err != nil {
+			return opts, err
+		}
+	}
+	opts.Config.Validate()
+
+	return opts, nil
+}
+
+// makeEngine opens the engine with the options given by the flags
+func makeEngine(cli *cliOptions) *Engine.Engine {
+	opts, err := loadOptions(cli)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil
+	}
+
+	e := Engine.MakeEngine(opts)
+	if e == nil {
+		return nil
+	}
+	_ = e.SetOutput(cli.output)
+
+	return e
+}
+
+// openDB opens the database with the options given by the flags
+func openDB(cli *cliOptions) *Engine.DB {
+	opts, err := loadOptions(cli)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil
+	}
+
+	db, err := Engine.Open(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil
+	}
+
+	return db
+}
+
+// noArguments parses the flags of a command without arguments, it returns false if arguments are given
+func noArguments(command string, cli *cliOptions, args []string) bool {
+	positional, err := parseFlags(commandFlags(command, cli), args)
+	if err != nil {
+		return false
+	}
+	if len(positional) != 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return false
+	}
+	return true
+}
+
+func repl(cli *cliOptions, args []string) int {
+	if !noArguments("repl", cli, args) {
+		return 2
+	}
+
+	e := makeEngine(cli)
+	if e == nil {
+		return 1
+	}
 	e.Main()
-	//s := time.Now()
-	//e.PopulateScript(1000, 100)
-	//fmt.Println(time.Now().Sub(s))
+	return 0
+}
+
+func exec(cli *cliOptions, args []string) int {
+	positional, err := parseFlags(commandFlags("exec", cli), args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	return batch(cli, positional[0])
+}
+
+// batch runs the commands of the script, or of the standard input if the path is empty
+func batch(cli *cliOptions, path string) int {
+	input := os.Stdin
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+
+	e := makeEngine(cli)
+	if e == nil {
+		return 1
+	}
+	if e.Batch(input) != nil {
+		return 1
+	}
+	return 0
+}
+
+// single runs one engine command taking the given number of arguments
+func single(cli *cliOptions, command string, args []string, count int) int {
+	positional, err := parseFlags(commandFlags(command, cli), args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != count {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	e := makeEngine(cli)
+	if e == nil {
+		return 1
+	}
+	defer e.Close()
+
+	if e.Exec(append([]string{command}, positional...)) != nil {
+		return 1
+	}
+	return 0
+}
+
+func scan(cli *cliOptions, args []string) int {
+	fs := commandFlags("scan", cli)
+	prefix := fs.String("prefix", "", "key prefix")
+	minKey := fs.String("min", "", "first key of the range")
+	maxKey := fs.String("max", "", "last key of the range")
+	page := fs.Int("page", 1, "page number")
+	cursor := fs.String("cursor", "", "cursor printed with the previous page")
+	limit := fs.Int("limit", 10, "number of keys on a page")
+	match := fs.String("match", "", "glob the keys match, like user:*:session")
+	regex := fs.String("regex", "", "regular expression the keys match")
+	contains := fs.String("contains", "", "text the values contain")
+	field := fs.String("json", "", "field=value the JSON values have")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return 2
+	}
+
+	ranged, paged, patterns, conditions := false, false, 0, 0
+	fs.Visit(func(f *flag.Flag) {
+		ranged = ranged || f.Name == "min" || f.Name == "max"
+		paged = paged || f.Name == "page"
+		if f.Name == "prefix" || f.Name == "match" || f.Name == "regex" {
+			patterns++
+		}
+		if f.Name == "contains" || f.Name == "json" {
+			conditions++
+		}
+	})
+	fieldName, fieldValue, isField := strings.Cut(*field, "=")
+	if len(positional) != 0 || *page < 1 || *limit < 1 || (paged && *cursor != "") ||
+		patterns > 1 || (ranged && patterns != 0) || conditions > 1 ||
+		(conditions != 0 && ranged) || (*field != "" && !isField) {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	start := strconv.Itoa(*page)
+	if *cursor != "" {
+		start = *cursor
+	}
+	var command []string
+	switch {
+	case ranged:
+		command = []string{"rangescan", *minKey, *maxKey, start, strconv.Itoa(*limit)}
+	case *regex != "":
+		command = []string{"scan", "regex", *regex, start, strconv.Itoa(*limit)}
+	case *match != "" || conditions != 0:
+		// the values are checked by the pattern scans, so a prefix becomes a glob
+		glob := *match
+		if glob == "" {
+			glob = globEscaper.Replace(*prefix) + "*"
+		}
+		command = []string{"scan", "match", glob, start, strconv.Itoa(*limit)}
+	default:
+		command = []string{"prefixscan", *prefix, start, strconv.Itoa(*limit)}
+	}
+	if *contains != "" {
+		command = append(command, "contains", *contains)
+	} else if *field != "" {
+		command = append(command, "json", fieldName, fieldValue)
+	}
+
+	e := makeEngine(cli)
+	if e == nil {
+		return 1
+	}
+	defer e.Close()
+
+	if e.Exec(command) != nil {
+		return 1
+	}
+	return 0
+}
+
+// globEscaper makes the wildcards of a prefix literal in a glob
+var globEscaper = strings.NewReplacer("\\", "\\\\", "*", "\\*", "?", "\\?", "[", "\\[")
+
+// aggregate runs count, du or bounds over a prefix or a range
+func aggregate(cli *cliOptions, name string, args []string) int {
+	fs := commandFlags(name, cli)
+	prefix := fs.String("prefix", "", "key prefix")
+	minKey := fs.String("min", "", "first key of the range")
+	maxKey := fs.String("max", "", "last key of the range")
+	approx := fs.Bool("approx", false, "estimate from the SSTable indexes")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return 2
+	}
+
+	ranged := false
+	fs.Visit(func(f *flag.Flag) {
+		ranged = ranged || f.Name == "min" || f.Name == "max"
+	})
+	if len(positional) != 0 || (ranged && *prefix != "") || (*approx && name == "bounds") {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	command := []string{name}
+	if *approx {
+		command = []string{Engine.APPROX, name}
+	}
+	if ranged {
+		command = append(command, *minKey, *maxKey)
+	} else {
+		command = append(command, *prefix)
+	}
+
+	e := makeEngine(cli)
+	if e == nil {
+		return 1
+	}
+	defer e.Close()
+
+	if e.Exec(command) != nil {
+		return 1
+	}
+	return 0
+}
+
+// serve runs the RESP or HTTP server on the address given after the command, or on the default one
+func serve(cli *cliOptions, args []string, http bool) int {
+	fs := commandFlags("serve", cli)
+	fs.BoolVar(&http, "http", http, "serve HTTP instead of RESP")
+	positional, err := parseFlags(fs, args)
+	if err != nil || len(positional) > 1 {
+		return 2
+	}
+
+	address := resp.DEFAULT_ADDRESS
+	if http {
+		address = rest.DEFAULT_ADDRESS
+	}
+	if len(positional) > 0 {
+		address = positional[0]
+	}
+
+	db := openDB(cli)
+	if db == nil {
+		return 1
+	}
+	defer db.Close()
+
+	fmt.Println("Listening on", address)
+	if http {
+		err = rest.MakeServer(db, address).ListenAndServe()
+	} else {
+		err = resp.MakeServer(db, address).ListenAndServe()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// bench writes and reads back keys and reports the rate of both
+func bench(cli *cliOptions, args []string) int {
+	fs := commandFlags("bench", cli)
+	entries := fs.Int("entries", 10000, "number of puts and gets")
+	keys := fs.Int("keys", 1000, "number of different keys")
+	valueSize := fs.Int("value-size", 100, "size of a value in bytes")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 0 || *entries < 1 || *keys < 1 || *valueSize < 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	db := openDB(cli)
+	if db == nil {
+		return 1
+	}
+	defer db.Close()
+
+	value := []byte(strings.Repeat("v", *valueSize))
+	benchStart := time.Now()
+	start := benchStart
+	for i := 0; i < *entries; i++ {
+		err := db.Put("bench"+strconv.Itoa(i%*keys), value)
+		if err != nil {
+			return report(cli, "bench", benchStart, nil, err)
+		}
+	}
+	putTime := time.Since(start)
+
+	start = time.Now()
+	for i := 0; i < *entries; i++ {
+		_, _, err := db.Get("bench" + strconv.Itoa(i%*keys))
+		if err != nil {
+			return report(cli, "bench", benchStart, nil, err)
+		}
+	}
+	getTime := time.Since(start)
+
+	return report(cli, "bench", benchStart, map[string]interface{}{
+		"entries":     *entries,
+		"put_seconds": putTime.Seconds(),
+		"puts_per_s":  float64(*entries) / putTime.Seconds(),
+		"get_seconds": getTime.Seconds(),
+		"gets_per_s":  float64(*entries) / getTime.Seconds(),
+	}, nil)
+}
+
+func compact(cli *cliOptions, args []string) int {
+	if !noArguments("compact", cli, args) {
+		return 2
+	}
+
+	db := openDB(cli)
+	if db == nil {
+		return 1
+	}
+	defer db.Close()
+
+	start := time.Now()
+	return report(cli, "compact", start, nil, db.Compact())
+}
+
+func verify(cli *cliOptions, args []string) int {
+	if !noArguments("verify", cli, args) {
+		return 2
+	}
+
+	db := openDB(cli)
+	if db == nil {
+		return 1
+	}
+	defer db.Close()
+
+	start := time.Now()
+	corrupted, err := db.Verify()
+	if err == nil && len(corrupted) > 0 {
+		err = fmt.Errorf("corrupted tables: %s", strings.Join(corrupted, ", "))
+	}
+	return report(cli, "verify", start, nil, err)
+}
+
+/*
+report prints the result of a database command like the engine prints its results and returns the exit code,
+the json output has the same fields as the output of the engine commands, timed from start.
+*/
+func report(cli *cliOptions, command string, start time.Time, result map[string]interface{}, err error) int {
+	if cli.output == Engine.OUTPUT_JSON {
+		out := map[string]interface{}{
+			"command": command,
+			"status":  Engine.STATUS_OK,
+			"time_us": time.Since(start).Microseconds(),
+		}
+		if err != nil {
+			out["status"] = Engine.STATUS_ERROR
+			out["error"] = err.Error()
+			out["code"] = Engine.ErrorCode(err)
+		} else if result != nil {
+			out["result"] = result
+		}
+		marshalled, _ := json.Marshal(out)
+		fmt.Println(string(marshalled))
+	} else if err != nil {
+		fmt.Println("ERR", err)
+	} else {
+		fmt.Println("OK")
+		names := make([]string, 0, len(result))
+		for name := range result {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name, result[name])
+		}
+	}
+
+	if err != nil {
+		return 1
+	}
+	return 0
 }
@@ -1,114 +1,319 @@
 package Engine
 
 import (
-	"key-value-engine/structs/config"
-	cache "key-value-engine/structs/lruCache"
-	"key-value-engine/structs/memtable"
-	"key-value-engine/structs/sstable"
+	"bufio"
+	"errors"
+	"io"
+	"key-value-engine/structs/scan"
 	"key-value-engine/structs/tokenBucket"
-	"key-value-engine/structs/wal"
-	"key-value-engine/structs/wputils"
+	"os"
+	"strings"
+	"time"
 )
 
+var errInvalidCommand = errors.New("invalid command")
+
+/*
+Engine is the command interpreter, a client of DB.
+It reads commands from the terminal with Main, or from a script or pipe with Batch.
+*/
 type Engine struct {
-	config           *config.Config
-	tokenBucket      *tokenBucket.TokenBucket
-	commitLog        *wal.WAL
-	sst              *sstable.SSTable
-	lruCache         *cache.LRUCache
-	memMan           *memtable.MemManager
-	walRestoreOffset int64
+	db          *DB
+	tokenBucket *tokenBucket.TokenBucket
+	input       *bufio.Reader // shared by every read, so no buffered line is lost
+	batch       bool
+	output      string         // OUTPUT_TEXT or OUTPUT_JSON
+	iterator    recordIterator // the iterator moved by next and stop, nil outside of iterator mode
 }
 
-func MakeEngine() *Engine {
-	cfg, err := config.MakeConfig()
+func MakeEngine(opts Options) *Engine {
+	db, err := Open(opts)
 	if err != nil {
 		displayError(err)
+		return nil
 	}
 
-	tb := tokenBucket.MakeTokenBucket(int64(cfg.TokenCapacity), int64(cfg.RefillCooldown))
+	tb := tokenBucket.MakeTokenBucket(int64(db.config.TokenCapacity), int64(db.config.RefillCooldown))
 
-	commitLog, _ := wal.MakeWAL(int64(cfg.WalSize))
+	return &Engine{
+		db:          db,
+		tokenBucket: tb,
+		output:      OUTPUT_TEXT,
+	}
+}
 
-	sst, _ := sstable.MakeSSTable(
-		int(cfg.SummaryIndexDensity),
-		cfg.MultipleFilesSST,
-		cfg.FilterPrecsion,
-		cfg.Compress,
-		int(cfg.MaxLsmLevels),
-		int(cfg.TablesToCompress),
-		cfg.CompressionType,
-		cfg.FirstLeveledSize,
-		cfg.LeveledInc,
-	)
+/*
+Main runs the interactive interpreter on the terminal until exit is entered or the input ends.
+Commands are rate limited by the token bucket, in the json output every command prints one object and no prompt is shown.
+*/
+func (e *Engine) Main() {
+	e.input = bufio.NewReader(os.Stdin)
 
-	lruCache := cache.NewLRUCache(int(cfg.CacheSize))
+	for {
+		input, err := e.readInput()
+		if err != nil {
+			e.stop(nil)
+			return
+		}
 
-	memMan := memtable.MakeMemTableManager(int(cfg.MemtableCount), int(cfg.MemtableSize), cfg.MemtableStructure, sst)
+		start := time.Now()
+		tokens, err := tokenize(input)
+		if err != nil {
+			e.respond("", reply{}, err, time.Since(start))
+			continue
+		}
+		if len(tokens) == 0 && !e.interactive() {
+			continue
+		}
+		option := e.checkCommand(tokens)
 
-	restore, err := wputils.Restore(memMan, commitLog)
-	if err != nil {
-		return nil
-	}
+		if option == OPTION_INVALID {
+			if e.interactive() {
+				showValidOptions()
+				e.pauseTerminal()
+			} else {
+				e.respond(commandName(tokens), reply{}, errInvalidCommand, time.Since(start))
+			}
+			continue
+		}
 
-	return &Engine{
-		config:           cfg,
-		tokenBucket:      tb,
-		commitLog:        commitLog,
-		sst:              sst,
-		lruCache:         lruCache,
-		memMan:           memMan,
-		walRestoreOffset: restore,
+		if option == OPTION_EXIT {
+			e.respond(commandName(tokens), reply{}, e.quit(), time.Since(start))
+			return
+		}
+
+		// moving an open iterator is not limited, the iterator command already took a token
+		if !movesIterator(option) {
+			tokenBytes, err := e.tokenBucket.TakeToken(1)
+			if err != nil {
+				e.respond(commandName(tokens), reply{}, err, time.Since(start))
+				continue
+			}
+			e.logToken(tokenBytes)
+		}
+
+		_ = e.run(option, tokens, start)
 	}
 }
 
-func (e *Engine) Main() {
+/*
+Batch runs the commands read from the input, one per line, until exit or the end of the input.
+Every command prints a machine-readable result, see printReply, empty lines and lines starting with # are skipped.
+Commands are not rate limited and structures are made with inline parameters only.
+
+Returns:
+  - error: The error of the first failed command, the commands after it are not run.
+*/
+func (e *Engine) Batch(input io.Reader) error {
+	e.input = bufio.NewReader(input)
+	e.batch = true
+
 	for {
-		input := getInput()
-		option := checkInput(input)
+		line, err := e.readInput()
+		if err == io.EOF {
+			return e.stop(nil)
+		}
+		if err != nil {
+			e.respond("", reply{}, err, 0)
+			return e.stop(err)
+		}
 
-		if option == OPTION_INVALID {
-			showValidOptions()
-			pauseTerminal()
+		if strings.HasPrefix(strings.TrimLeft(line, " \t"), "#") {
 			continue
 		}
-
-		tokenBytes, err := e.tokenBucket.TakeToken(1)
+		start := time.Now()
+		tokens, err := tokenize(line)
 		if err != nil {
-			displayError(err)
+			e.respond("", reply{}, err, time.Since(start))
+			return e.stop(err)
+		}
+		if len(tokens) == 0 {
 			continue
 		}
-		e.logToken(tokenBytes)
-
-		if option == OPTION_GET {
-			e.get(input)
-		} else if option == OPTION_PUT {
-			e.put(input)
-		} else if option == OPTION_DELETE {
-			e.delete(input)
-		} else if option == OPTION_EXIT {
-			e.quit()
-			return
-		} else if option == OPTION_MAKE {
-			e.makeStruct(input)
-		} else if option == OPTION_DESTROY {
-			e.destroy(input)
-		} else if option == OPTION_ADDTOSTRUCT {
-			e.populateStruct(input)
-		} else if option == OPTION_CHECKSTRUCT {
-			e.checkStruct(input)
-		} else if option == OPTION_FINGERPRINT {
-			e.storeFingerprint(input)
-		} else if option == OPTION_SIMHASH {
-			e.simhHash(input)
-		} else if option == OPTION_PREFIXSCAN {
-			e.prefixScan(input)
-		} else if option == OPTION_RANGESCAN {
-			e.rangeScan(input)
-		} else if option == OPTION_PREFIXITER {
-			e.prefixIterator(input)
-		} else if option == OPTION_RANGEITER {
-			e.rangeIterator(input)
+
+		option := e.checkCommand(tokens)
+		if option == OPTION_INVALID {
+			e.respond(commandName(tokens), reply{}, errInvalidCommand, time.Since(start))
+			return e.stop(errInvalidCommand)
 		}
+		if option == OPTION_EXIT {
+			err = e.quit()
+			e.respond(commandName(tokens), reply{}, err, time.Since(start))
+			return err
+		}
+
+		if err := e.run(option, tokens, start); err != nil {
+			return e.stop(err)
+		}
+	}
+}
+
+/*
+Exec runs a single command given as separate arguments, such as the arguments of the command line,
+and prints its result like Batch does. Arguments starting with hex: or b64: are decoded.
+Iterator commands are not supported, since there is no input to read next and stop from.
+
+Returns:
+  - error: The error of the command.
+*/
+func (e *Engine) Exec(args []string) error {
+	e.input = bufio.NewReader(strings.NewReader(""))
+	e.batch = true
+
+	start := time.Now()
+	tokens := make([][]byte, len(args))
+	for i, arg := range args {
+		token := []byte(arg)
+		if strings.HasPrefix(arg, HEX_PREFIX) || strings.HasPrefix(arg, BASE64_PREFIX) {
+			var err error
+			token, _, err = readLiteral(arg, 0)
+			if err != nil {
+				e.respond("", reply{}, err, time.Since(start))
+				return err
+			}
+		}
+		tokens[i] = token
+	}
+
+	option := e.checkCommand(tokens)
+	if option == OPTION_INVALID || option == OPTION_EXIT || option == OPTION_PREFIXITER || option == OPTION_RANGEITER {
+		e.respond(commandName(tokens), reply{}, errInvalidCommand, time.Since(start))
+		return errInvalidCommand
+	}
+
+	return e.run(option, tokens, start)
+}
+
+/*
+Close closes the database of the engine.
+*/
+func (e *Engine) Close() error {
+	return e.db.Close()
+}
+
+/*
+checkCommand returns the option of the tokenized command, see checkInput.
+The iterator commands (next, prev, seek, last and stop) are valid only while an iterator is open,
+the other commands but exit only while none is.
+*/
+func (e *Engine) checkCommand(tokens [][]byte) int {
+	option := checkInput(tokens)
+	if option == OPTION_INVALID || option == OPTION_EXIT {
+		return option
+	}
+
+	if movesIterator(option) != (e.iterator != nil) {
+		return OPTION_INVALID
+	}
+	return option
+}
+
+// movesIterator reports whether the option is one of the commands of the iterator mode
+func movesIterator(option int) bool {
+	switch option {
+	case OPTION_ITERNEXT, OPTION_ITERPREV, OPTION_ITERSEEK, OPTION_ITERLAST, OPTION_ITERSTOP:
+		return true
+	}
+	return false
+}
+
+// commandName names the command in the json output, structure, approx and scan commands are named with both words, like "bf check"
+func commandName(tokens [][]byte) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	name := string(tokens[0])
+	if len(tokens) > 1 && (name == STRUCT_BF || name == STRUCT_CMS || name == STRUCT_HLL || name == APPROX || name == SCAN) {
+		name += " " + string(tokens[1])
+	}
+	return name
+}
+
+// run executes the command and prints its result, timed from start
+func (e *Engine) run(option int, tokens [][]byte, start time.Time) error {
+	rep, err := e.execute(option, tokens)
+	e.respond(commandName(tokens), rep, err, time.Since(start))
+	return err
+}
+
+/*
+stop closes the database once the input ends or a command fails, an error of closing is printed as the result of exit.
+
+Returns:
+  - error: The error of the failed command if given, otherwise the error of closing.
+*/
+func (e *Engine) stop(err error) error {
+	closeErr := e.quit()
+	if closeErr != nil {
+		e.respond("exit", reply{}, closeErr, 0)
+	}
+
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// execute runs the command chosen by checkInput
+func (e *Engine) execute(option int, tokens [][]byte) (reply, error) {
+	switch option {
+	case OPTION_GET:
+		return e.get(tokens)
+	case OPTION_PUT:
+		return e.put(tokens)
+	case OPTION_DELETE:
+		return e.delete(tokens)
+	case OPTION_CAS:
+		return e.compareAndSwap(tokens)
+	case OPTION_SETNX:
+		return e.putIfAbsent(tokens)
+	case OPTION_DELIFEQ:
+		return e.deleteIfEquals(tokens)
+	case OPTION_MAKE:
+		return e.makeStruct(tokens)
+	case OPTION_DESTROY:
+		return e.destroy(tokens)
+	case OPTION_ADDTOSTRUCT:
+		return e.populateStruct(tokens)
+	case OPTION_CHECKSTRUCT:
+		return e.checkStruct(tokens)
+	case OPTION_FINGERPRINT:
+		return e.storeFingerprint(tokens)
+	case OPTION_SIMHASH:
+		return e.simhHash(tokens)
+	case OPTION_PREFIXSCAN:
+		return e.prefixScan(tokens)
+	case OPTION_RANGESCAN:
+		return e.rangeScan(tokens)
+	case OPTION_MATCHSCAN:
+		return e.filterScan(tokens, scan.MakeGlobFilter)
+	case OPTION_REGEXSCAN:
+		return e.filterScan(tokens, scan.MakeRegexFilter)
+	case OPTION_PREFIXITER:
+		return e.prefixIterator(tokens)
+	case OPTION_RANGEITER:
+		return e.rangeIterator(tokens)
+	case OPTION_ITERNEXT:
+		return e.iteratorNext()
+	case OPTION_ITERPREV:
+		return e.iteratorPrev()
+	case OPTION_ITERSEEK:
+		return e.iteratorSeek(tokens)
+	case OPTION_ITERLAST:
+		return e.iteratorLast()
+	case OPTION_ITERSTOP:
+		return e.iteratorStop()
+	case OPTION_COUNT:
+		return e.count(tokens[1:], false)
+	case OPTION_APPROXCOUNT:
+		return e.count(tokens[2:], true)
+	case OPTION_DU:
+		return e.diskUsage(tokens[1:], false)
+	case OPTION_APPROXDU:
+		return e.diskUsage(tokens[2:], true)
+	case OPTION_BOUNDS:
+		return e.bounds(tokens[1:])
 	}
+	return reply{}, errInvalidCommand
 }
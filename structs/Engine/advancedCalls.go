@@ -1,275 +1,162 @@
 package Engine
 
 import (
-	"encoding/binary"
+	"errors"
 	"fmt"
-	"key-value-engine/structs/bloomFilter"
-	"key-value-engine/structs/cms"
-	"key-value-engine/structs/hll"
-	"key-value-engine/structs/simHash"
 	"regexp"
 	"strconv"
-	"strings"
 )
 
-func (e *Engine) storeFingerprint(call string) {
-	parts := strings.Split(call, " ")
-	name := parts[1]
-	text := strings.Join(parts[2:], " ")
+var (
+	errInvalidParam    = errors.New("invalid input")
+	errMissingParams   = errors.New("structure parameters must be given inline")
+	errParamOutOfRange = errors.New("invalid input range")
 
-	fingerprint := simHash.SimHash([]byte(text))
-	fingerprintBytes := make([]byte, 8)
-	binary.LittleEndian.PutUint64(fingerprintBytes, uint64(fingerprint))
+	intParamRegex      = regexp.MustCompile(`^\d+$`)
+	fractionParamRegex = regexp.MustCompile(`^0\.\d+$`)
+)
 
-	key := "fingerprint " + name
+// makePrompts are the parameters asked for when a structure is made without inline parameters
+var makePrompts = map[string][]string{
+	STRUCT_BF:  {"Enter expected elements: ", "Enter precision: "},
+	STRUCT_CMS: {"Enter epsilon: ", "Enter delta: "},
+	STRUCT_HLL: {"Enter precision: "},
+}
 
-	err := e.writePath(key, fingerprintBytes, false)
-	if err != nil {
-		displayError(err)
-		return
-	}
+func (e *Engine) storeFingerprint(tokens [][]byte) (reply, error) {
+	name := string(tokens[1])
+	text := tokens[2]
 
+	err := e.db.StoreFingerprint(name, text)
+	return reply{}, err
 }
 
-func (e *Engine) simhHash(call string) {
-	parts := strings.Split(call, " ")
-	name1 := parts[1]
-	name2 := parts[2]
-	key1 := "fingerprint " + name1
-	key2 := "fingerprint " + name2
+func (e *Engine) simhHash(tokens [][]byte) (reply, error) {
+	name1 := string(tokens[1])
+	name2 := string(tokens[2])
 
-	rec1, err := e.readPath(key1)
-	if err != nil {
-		displayError(err)
-		return
-	}
-	if rec1 != nil {
-		if rec1.IsTombstone() {
-			return
-		}
-	} else {
-		return
-	}
-	rec2, err := e.readPath(key2)
+	sh, found, err := e.db.SimHash(name1, name2)
 	if err != nil {
-		displayError(err)
-		return
+		return reply{}, err
 	}
-	if rec2 != nil {
-		if rec2.IsTombstone() {
-			return
-		}
-	} else {
-		return
+	if !found {
+		return reply{missing: true}, nil
 	}
-
-	fingerprint1 := binary.LittleEndian.Uint64(rec1.GetValue())
-	fingerprint2 := binary.LittleEndian.Uint64(rec2.GetValue())
-
-	sh := simHash.HemingDistance(uint(fingerprint1), uint(fingerprint2))
-
-	fmt.Println(sh)
+	return reply{value: sh}, nil
 }
 
-func (e *Engine) makeStruct(call string) {
-	parts := strings.Split(call, " ")
-	structure := parts[0]
-	name := parts[2]
-
-	key := structure + " " + name
+/*
+makeStruct makes the structure with the parameters following its name,
+the interactive mode asks for them if they are not given.
+  - bf make {name} {expected_elements} {precision}
+  - cms make {name} {epsilon} {delta}
+  - hll make {name} {precision}
+*/
+func (e *Engine) makeStruct(tokens [][]byte) (reply, error) {
+	structure := string(tokens[0])
+	name := string(tokens[2])
+
+	params, err := e.structParams(structure, tokens[3:])
+	if err != nil {
+		return reply{}, err
+	}
 
-	var objBytes []byte
-	if structure == "bf" {
-		regEl := regexp.MustCompile(`^\d+$`)
-		regPrec := regexp.MustCompile(`^0\.\d+$`)
-		fmt.Print("Enter expected elements: ")
-		input := getInput()
-		if !regEl.MatchString(input) {
-			fmt.Println("invalid input")
-			return
-		}
-		expectedEl, _ := strconv.ParseInt(input, 10, 64)
-		fmt.Print("Enter precision: ")
-		input = getInput()
-		if !regPrec.MatchString(input) {
-			fmt.Println("invalid input")
-			return
+	if structure == STRUCT_BF {
+		if !intParamRegex.MatchString(params[0]) || !fractionParamRegex.MatchString(params[1]) {
+			return reply{}, errInvalidParam
 		}
-		precision, _ := strconv.ParseFloat(input, 64)
+		expectedEl, _ := strconv.ParseInt(params[0], 10, 64)
+		precision, _ := strconv.ParseFloat(params[1], 64)
 
-		obj := bloomFilter.MakeBloomFilter(uint64(expectedEl), precision)
-		objBytes = obj.BloomFilterToBytes()
-
-	} else if structure == "hll" {
-		regPr := regexp.MustCompile(`^\d+$`)
-		fmt.Print("Enter precision: ")
-		input := getInput()
-		if !regPr.MatchString(input) {
-			fmt.Println("invalid input")
-			return
+		err = e.db.MakeBloomFilter(name, uint64(expectedEl), precision)
+	} else if structure == STRUCT_HLL {
+		if !intParamRegex.MatchString(params[0]) {
+			return reply{}, errInvalidParam
 		}
-		precision, _ := strconv.ParseInt(input, 10, 64)
-		obj, err := hll.MakeHLL(uint8(precision))
-		if err != nil {
-			fmt.Println("invalid input range")
-			return
+		precision, _ := strconv.ParseInt(params[0], 10, 64)
+		if precision > 255 {
+			return reply{}, errParamOutOfRange
 		}
-		objBytes, _ = obj.HLLToBytes()
-	} else if structure == "cms" {
-		regFlt := regexp.MustCompile(`^0\.\d+$`)
-		fmt.Print("Enter epsilon: ")
-		input := getInput()
-		if !regFlt.MatchString(input) {
-			fmt.Println("invalid input")
-			return
-		}
-		epsilon, _ := strconv.ParseFloat(input, 64)
-		fmt.Print("Enter delta: ")
-		input = getInput()
-		if !regFlt.MatchString(input) {
-			fmt.Println("invalid input")
-			return
-		}
-		delta, _ := strconv.ParseFloat(input, 64)
-		if epsilon <= 0 || delta <= 0 {
-			fmt.Println("invalid input range")
-			return
+
+		err = e.db.MakeHLL(name, uint8(precision))
+	} else if structure == STRUCT_CMS {
+		if !fractionParamRegex.MatchString(params[0]) || !fractionParamRegex.MatchString(params[1]) {
+			return reply{}, errInvalidParam
 		}
+		epsilon, _ := strconv.ParseFloat(params[0], 64)
+		delta, _ := strconv.ParseFloat(params[1], 64)
 
-		obj := cms.MakeCMS(epsilon, delta)
-		objBytes = obj.CMSToBytes()
+		err = e.db.MakeCMS(name, epsilon, delta)
 	}
 
-	err := e.writePath(key, objBytes, false)
-	if err != nil {
-		displayError(err)
-		return
-	}
+	return reply{}, err
 }
 
-func (e *Engine) destroy(call string) {
-	parts := strings.Split(call, " ")
-	structure := parts[0]
-	name := parts[2]
-
-	key := structure + " " + name
-
-	rec, err := e.readPath(key)
-	if err != nil {
-		displayError(err)
-		return
+// structParams returns the inline parameters of the make command, or asks for them in the interactive mode with the text output
+func (e *Engine) structParams(structure string, inline [][]byte) ([]string, error) {
+	params := make([]string, 0, len(makePrompts[structure]))
+	if len(inline) > 0 {
+		for _, param := range inline {
+			params = append(params, string(param))
+		}
+		return params, nil
+	}
+	if !e.interactive() {
+		return nil, errMissingParams
 	}
-	if rec != nil {
-		err = e.writePath(rec.GetKey(), rec.GetValue(), true)
+
+	for _, prompt := range makePrompts[structure] {
+		fmt.Print(prompt)
+		input, err := e.readInput()
 		if err != nil {
-			displayError(err)
-			return
+			return nil, err
 		}
+		params = append(params, input)
 	}
+	return params, nil
 }
 
-func (e *Engine) populateStruct(call string) {
-	parts := strings.Split(call, " ")
-	name := parts[2]
-	structure := parts[0]
-	value := []byte(strings.Join(parts[3:], " "))
-
-	key := structure + " " + name
-
-	objRec, err := e.readPath(key)
-	if err != nil {
-		displayError(err)
-		return
-	}
-	if objRec != nil {
-		if objRec.IsTombstone() {
-			return
-		}
-	} else {
-		return
-	}
+func (e *Engine) destroy(tokens [][]byte) (reply, error) {
+	structure := string(tokens[0])
+	name := string(tokens[2])
 
-	objBytes := objRec.GetValue()
+	err := e.db.DestroyStruct(structure, name)
+	return reply{}, err
+}
 
-	if structure == "bf" {
-		obj, err := bloomFilter.BytesToBloomFilter(objBytes)
-		if err != nil {
-			displayError(err)
-			return
-		}
-		obj.Add(value)
-		objBytes = obj.BloomFilterToBytes()
-	} else if structure == "hll" {
-		obj, _ := hll.BytesToHLL(objBytes)
-		err := obj.Add(value)
-		if err != nil {
-			displayError(err)
-			return
-		}
-		objBytes, _ = obj.HLLToBytes()
-	} else if structure == "cms" {
-		obj, err := cms.BytesToCMS(objBytes)
-		if err != nil {
-			displayError(err)
-			return
-		}
-		obj.Add(value)
-		objBytes = obj.CMSToBytes()
-	}
+func (e *Engine) populateStruct(tokens [][]byte) (reply, error) {
+	name := string(tokens[2])
+	structure := string(tokens[0])
+	value := tokens[3]
 
-	err = e.writePath(key, objBytes, false)
-	if err != nil {
-		displayError(err)
-		return
-	}
+	err := e.db.MergeIntoStruct(structure, name, value)
+	return reply{}, err
 }
 
-func (e *Engine) checkStruct(call string) {
-	parts := strings.Split(call, " ")
-	name := parts[2]
-	structure := parts[0]
+func (e *Engine) checkStruct(tokens [][]byte) (reply, error) {
+	name := string(tokens[2])
+	structure := string(tokens[0])
 	var value []byte
-	if structure != "hll" {
-		value = []byte(strings.Join(parts[3:], " "))
+	if structure != STRUCT_HLL {
+		value = tokens[3]
 	}
 
-	key := structure + " " + name
+	var result interface{}
+	var err error
+	var found bool
+	if structure == STRUCT_BF {
+		result, found, err = e.db.BloomFilterCheck(name, value)
+	} else if structure == STRUCT_HLL {
+		result, found, err = e.db.HLLEstimate(name)
+	} else if structure == STRUCT_CMS {
+		result, found, err = e.db.CMSEstimate(name, value)
+	}
 
-	objRec, err := e.readPath(key)
 	if err != nil {
-		displayError(err)
-		return
+		return reply{}, err
 	}
-	if objRec != nil {
-		if objRec.IsTombstone() {
-			return
-		}
-	} else {
-		return
-	}
-
-	objBytes := objRec.GetValue()
-
-	if structure == "bf" {
-		obj, err := bloomFilter.BytesToBloomFilter(objBytes)
-		if err != nil {
-			displayError(err)
-			return
-		}
-		fmt.Println(obj.IsPresent(value))
-	} else if structure == "hll" {
-		obj, err := hll.BytesToHLL(objBytes)
-		if err != nil {
-			displayError(err)
-			return
-		}
-		fmt.Println(obj.Estimate())
-	} else if structure == "cms" {
-		obj, err := cms.BytesToCMS(objBytes)
-		if err != nil {
-			displayError(err)
-			return
-		}
-		fmt.Println(obj.Estimate(value))
+	if !found {
+		return reply{missing: true}, nil
 	}
+	return reply{value: result}, nil
 }
@@ -0,0 +1,65 @@
+package Engine
+
+import (
+	"key-value-engine/structs/scan"
+)
+
+// keyBounds is the first and the last key of a prefix or a range
+type keyBounds struct {
+	first string
+	last  string
+}
+
+// aggregates reports whether the option takes a prefix or the two ends of a range
+func aggregates(option int) bool {
+	switch option {
+	case OPTION_COUNT, OPTION_DU, OPTION_BOUNDS, OPTION_APPROXCOUNT, OPTION_APPROXDU:
+		return true
+	}
+	return false
+}
+
+// count runs count {prefix} or count {rangeMin} {rangeMax}, args are the tokens after the command name
+func (e *Engine) count(args [][]byte, approximate bool) (reply, error) {
+	stats, err := e.stats(args, approximate)
+	if err != nil {
+		return reply{}, err
+	}
+	return reply{value: stats.Count}, nil
+}
+
+// diskUsage runs du {prefix} or du {rangeMin} {rangeMax}, the result is in bytes
+func (e *Engine) diskUsage(args [][]byte, approximate bool) (reply, error) {
+	stats, err := e.stats(args, approximate)
+	if err != nil {
+		return reply{}, err
+	}
+	return reply{value: stats.Size}, nil
+}
+
+// bounds runs bounds {prefix} or bounds {rangeMin} {rangeMax}, the result is missing if there is no key
+func (e *Engine) bounds(args [][]byte) (reply, error) {
+	var first, last string
+	var found bool
+	var err error
+	if len(args) == 2 {
+		first, last, found, err = e.db.RangeBounds(string(args[0]), string(args[1]))
+	} else {
+		first, last, found, err = e.db.PrefixBounds(string(args[0]))
+	}
+	if err != nil {
+		return reply{}, err
+	}
+	if !found {
+		return reply{missing: true}, nil
+	}
+	return reply{value: keyBounds{first: first, last: last}}, nil
+}
+
+// stats aggregates the keys with the prefix, or within the range if two keys are given
+func (e *Engine) stats(args [][]byte, approximate bool) (scan.Stats, error) {
+	if len(args) == 2 {
+		return e.db.RangeStats(string(args[0]), string(args[1]), approximate)
+	}
+	return e.db.PrefixStats(string(args[0]), approximate)
+}
@@ -1,62 +1,79 @@
 package Engine
 
 import (
-	"fmt"
 	"strconv"
-	"strings"
 	"time"
 )
 
-func (e *Engine) put(call string) {
-	parts := strings.Split(call, " ")
-	key := parts[1]
-	value := []byte(strings.Join(parts[2:], " "))
+func (e *Engine) put(tokens [][]byte) (reply, error) {
+	key := string(tokens[1])
+	value := tokens[2]
 
-	err := e.writePath(key, value, false)
+	err := e.db.Put(key, value)
+	return reply{}, err
+}
+
+func (e *Engine) delete(tokens [][]byte) (reply, error) {
+	key := string(tokens[1])
+
+	err := e.db.Delete(key)
+	return reply{}, err
+}
+
+func (e *Engine) compareAndSwap(tokens [][]byte) (reply, error) {
+	key := string(tokens[1])
+	expected := tokens[2]
+	value := tokens[3]
+
+	swapped, err := e.db.CompareAndSwap(key, expected, value)
 	if err != nil {
-		displayError(err)
-		return
+		return reply{}, err
 	}
-
+	return reply{value: swapped}, nil
 }
 
-func (e *Engine) delete(call string) {
-	parts := strings.Split(call, " ")
-	key := parts[1]
+func (e *Engine) putIfAbsent(tokens [][]byte) (reply, error) {
+	key := string(tokens[1])
+	value := tokens[2]
 
-	rec, err := e.readPath(key)
+	stored, err := e.db.PutIfAbsent(key, value)
 	if err != nil {
-		displayError(err)
-		return
+		return reply{}, err
 	}
-	if rec != nil {
-		err := e.writePath(rec.GetKey(), rec.GetValue(), true)
-		if err != nil {
-			displayError(err)
-			return
-		}
+	return reply{value: stored}, nil
+}
+
+func (e *Engine) deleteIfEquals(tokens [][]byte) (reply, error) {
+	key := string(tokens[1])
+	expected := tokens[2]
+
+	deleted, err := e.db.DeleteIfEquals(key, expected)
+	if err != nil {
+		return reply{}, err
 	}
+	return reply{value: deleted}, nil
 }
 
-func (e *Engine) get(call string) {
-	parts := strings.Split(call, " ")
-	key := parts[1]
+func (e *Engine) get(tokens [][]byte) (reply, error) {
+	key := string(tokens[1])
 
-	rec, err := e.readPath(key)
+	value, found, err := e.db.Get(key)
 	if err != nil {
-		displayError(err)
-		return
+		return reply{}, err
 	}
-	if rec != nil {
-		fmt.Println(string(rec.GetValue()))
+	if !found {
+		return reply{missing: true}, nil
 	}
+	return reply{value: value}, nil
 }
 
-func (e *Engine) quit() {
-	return
+// quit stops the open iterator and closes the database
+func (e *Engine) quit() error {
+	e.closeIterator()
+	return e.db.Close()
 }
 
 func (e *Engine) logToken(tokenBytes []byte) {
-	key := "tokenLog " + strconv.FormatInt(time.Now().Unix(), 10)
-	e.writePath(key, tokenBytes, false)
+	key := TOKEN_LOG + " " + strconv.FormatInt(time.Now().Unix(), 10)
+	e.db.put(e.db.families[FAMILY_SYSTEM], key, tokenBytes)
 }
@@ -0,0 +1,213 @@
+package Engine
+
+import (
+	"errors"
+	"key-value-engine/structs/record"
+	"key-value-engine/structs/wputils"
+	"time"
+)
+
+/*
+WriteBatch collects puts, merges, deletes and range deletes that are applied atomically by DB.Write.
+The whole batch is written to the write-ahead log as a single entry with one checksum,
+so after a crash either all of its changes are restored or none of them.
+Changes can go to different column families, the batch stays atomic across them.
+
+A WriteBatch is not safe for concurrent use and can be reused after Reset.
+*/
+type WriteBatch struct {
+	entries []batchEntry
+}
+
+type batchEntry struct {
+	family   *ColumnFamily // nil for the default family
+	key      string
+	value    []byte
+	deleted  bool
+	merge    bool
+	expiring bool
+	ttl      time.Duration
+	rangeEnd *string // last key of a range delete
+}
+
+func MakeWriteBatch() *WriteBatch {
+	return &WriteBatch{}
+}
+
+/*
+Put adds storing the key-value pair to the batch.
+*/
+func (wb *WriteBatch) Put(key string, value []byte) {
+	wb.PutCF(nil, key, value)
+}
+
+/*
+PutWithTTL adds storing the key-value pair that expires after the ttl to the batch.
+The deadline is counted from the moment the batch is written.
+*/
+func (wb *WriteBatch) PutWithTTL(key string, value []byte, ttl time.Duration) {
+	wb.PutWithTTLCF(nil, key, value, ttl)
+}
+
+/*
+Merge adds storing the merge operand of the key to the batch, see DB.Merge.
+*/
+func (wb *WriteBatch) Merge(key string, operand []byte) {
+	wb.MergeCF(nil, key, operand)
+}
+
+/*
+Delete adds deleting the key to the batch.
+*/
+func (wb *WriteBatch) Delete(key string) {
+	wb.DeleteCF(nil, key)
+}
+
+/*
+DeleteRange adds deleting every key within [start, end] to the batch.
+*/
+func (wb *WriteBatch) DeleteRange(start, end string) {
+	wb.DeleteRangeCF(nil, start, end)
+}
+
+/*
+PutCF adds storing the key-value pair in the column family to the batch, a nil family is the default one.
+*/
+func (wb *WriteBatch) PutCF(cf *ColumnFamily, key string, value []byte) {
+	wb.entries = append(wb.entries, batchEntry{family: cf, key: key, value: value})
+}
+
+/*
+PutWithTTLCF adds storing the expiring key-value pair in the column family to the batch.
+*/
+func (wb *WriteBatch) PutWithTTLCF(cf *ColumnFamily, key string, value []byte, ttl time.Duration) {
+	wb.entries = append(wb.entries, batchEntry{family: cf, key: key, value: value, expiring: true, ttl: ttl})
+}
+
+/*
+MergeCF adds storing the merge operand of the key in the column family to the batch.
+*/
+func (wb *WriteBatch) MergeCF(cf *ColumnFamily, key string, operand []byte) {
+	wb.entries = append(wb.entries, batchEntry{family: cf, key: key, value: operand, merge: true})
+}
+
+/*
+DeleteCF adds deleting the key of the column family to the batch.
+*/
+func (wb *WriteBatch) DeleteCF(cf *ColumnFamily, key string) {
+	wb.entries = append(wb.entries, batchEntry{family: cf, key: key, deleted: true})
+}
+
+/*
+DeleteRangeCF adds deleting every key of the column family within [start, end] to the batch.
+*/
+func (wb *WriteBatch) DeleteRangeCF(cf *ColumnFamily, start, end string) {
+	wb.entries = append(wb.entries, batchEntry{family: cf, key: start, rangeEnd: &end})
+}
+
+/*
+Len returns the number of changes in the batch.
+*/
+func (wb *WriteBatch) Len() int {
+	return len(wb.entries)
+}
+
+/*
+Reset removes all changes from the batch.
+*/
+func (wb *WriteBatch) Reset() {
+	wb.entries = nil
+}
+
+/*
+Write applies all changes of the batch atomically, later changes of a key override earlier ones.
+Every change gets its own sequence number, in the order the changes were added.
+Writing an empty batch does nothing.
+
+Returns:
+  - error: wal.ErrRecordTooLarge if the batch does not fit into a WAL segment, ErrInvalidTTL if a ttl is not positive,
+    ErrInvalidRange if a range start is greater than its end, ErrNoMerge if no merge operator handles a merged key,
+    ErrNoFamily if a column family is dropped or belongs to another database, or any error during writing.
+    Nothing is applied when an error is returned.
+*/
+func (db *DB) Write(batch *WriteBatch) error {
+	if batch == nil {
+		return errors.New("batch is nil")
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	return db.applyBatch(batch)
+}
+
+// applyBatch writes the batch as one WAL entry, it must be called under the write lock
+func (db *DB) applyBatch(batch *WriteBatch) error {
+	if len(batch.entries) == 0 {
+		return nil
+	}
+
+	families := make([]*family, len(batch.entries))
+	for i, entry := range batch.entries {
+		f := db.defaultFamily
+		if entry.family != nil {
+			if entry.family.db != db || entry.family.family.dropped {
+				return ErrNoFamily
+			}
+			f = entry.family.family
+		}
+		families[i] = f
+
+		if entry.expiring && entry.ttl <= 0 {
+			return ErrInvalidTTL
+		}
+		if entry.rangeEnd != nil && entry.key > *entry.rangeEnd {
+			return ErrInvalidRange
+		}
+		if entry.merge && f.mergeOperator.For(entry.key) == nil {
+			return ErrNoMerge
+		}
+	}
+
+	now := time.Now()
+	records := make([]*record.Record, len(batch.entries))
+	for i, entry := range batch.entries {
+		if entry.expiring {
+			records[i] = record.MakeExpiringRecord(entry.key, entry.value, db.nextSeq(), now.Add(entry.ttl))
+		} else if entry.merge {
+			records[i] = record.MakeMergeRecord(entry.key, entry.value, db.nextSeq())
+		} else if entry.rangeEnd != nil {
+			records[i] = record.MakeRangeTombstone(entry.key, *entry.rangeEnd, db.nextSeq())
+		} else {
+			records[i] = record.MakeRecord(entry.key, entry.value, entry.deleted, db.nextSeq())
+		}
+	}
+
+	return db.writeBatch(families, records)
+}
+
+// writeBatch writes the records as one WAL entry, families[i] is the family of records[i]
+func (db *DB) writeBatch(families []*family, records []*record.Record) error {
+	members := make([]*record.Record, len(records))
+	for i, member := range records {
+		members[i] = families[i].walRecord(member)
+	}
+	rec := record.MakeBatchRecord(members)
+
+	newRestoreOffset, err := wputils.AddRecord(db.walFamilies, db.commitLog, db.walRestoreOffset, rec)
+	if err != nil {
+		return err
+	}
+
+	db.walRestoreOffset = newRestoreOffset
+
+	for i, member := range records {
+		families[i].cacheRecord(member)
+	}
+
+	return nil
+}
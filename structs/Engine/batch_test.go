@@ -0,0 +1,136 @@
+package Engine
+
+import (
+	"errors"
+	"fmt"
+	"key-value-engine/structs/wal"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// lastSegment returns the path and the size of the last WAL segment
+func lastSegment(t *testing.T, directory string) (string, int64) {
+	segments, err := filepath.Glob(filepath.Join(directory, "wal", "*.log"))
+	if err != nil || len(segments) == 0 {
+		t.Fatalf("no wal segments: %v", err)
+	}
+	sort.Strings(segments)
+
+	info, err := os.Stat(segments[len(segments)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return segments[len(segments)-1], info.Size()
+}
+
+func makeTestBatch(n int) *WriteBatch {
+	batch := MakeWriteBatch()
+	for i := 0; i < n; i++ {
+		batch.Put(fmt.Sprintf("batch:%02d", i), []byte("batch"))
+	}
+	batch.Delete("seed:00")
+	batch.DeleteRange("seed:05", "seed:07")
+	return batch
+}
+
+// checkBatch checks whether the keys written and deleted by makeTestBatch are as the batch left them or as before it
+func checkBatch(t *testing.T, db *DB, n int, applied bool) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("batch:%02d", i)
+		if _, found, err := db.Get(key); err != nil || found != applied {
+			t.Errorf("%s: found %v %v, want %v", key, found, err, applied)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("seed:%02d", i)
+		deleted := applied && (i == 0 || (i >= 5 && i <= 7))
+		if _, found, err := db.Get(key); err != nil || found == deleted {
+			t.Errorf("%s: found %v %v, want %v", key, found, err, !deleted)
+		}
+	}
+}
+
+// TestTornBatch cuts the WAL in the middle of a batch, reopening must restore none of its changes
+func TestTornBatch(t *testing.T) {
+	opts := testOptions(t, "btree")
+	opts.MemtableSize = 1000
+	db := openWithOptions(t, opts)
+	for i := 0; i < 10; i++ {
+		if err := db.Put(fmt.Sprintf("seed:%02d", i), []byte("seed")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	segment, before := lastSegment(t, opts.Directory)
+	if err := db.Write(makeTestBatch(20)); err != nil {
+		t.Fatal(err)
+	}
+	checkBatch(t, db, 20, true)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cut, after := lastSegment(t, opts.Directory)
+	if cut != segment || after <= before {
+		t.Fatalf("the batch is not at the end of %s: %s %d..%d", segment, cut, before, after)
+	}
+	if err := os.Truncate(segment, before+(after-before)/2); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openWithOptions(t, opts)
+	checkBatch(t, db, 20, false)
+
+	// the torn tail is not restored again once new records follow it
+	if err := db.Put("after", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db = openWithOptions(t, opts)
+	checkBatch(t, db, 20, false)
+	if _, found, err := db.Get("after"); err != nil || !found {
+		t.Errorf("write after the torn batch: found %v %v", found, err)
+	}
+}
+
+// TestBatchTooLarge checks that a batch not fitting into a WAL segment changes nothing, in memory or after reopening
+func TestBatchTooLarge(t *testing.T) {
+	opts := testOptions(t, "btree")
+	opts.MemtableSize = 1000
+	db := openWithOptions(t, opts)
+	for i := 0; i < 10; i++ {
+		if err := db.Put(fmt.Sprintf("seed:%02d", i), []byte("seed")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	segmentSize := int(db.Config().WalSize)
+	batch := makeTestBatch(20)
+	batch.Put("large", make([]byte, segmentSize))
+	if err := db.Write(batch); !errors.Is(err, wal.ErrRecordTooLarge) {
+		t.Fatalf("got %v, want ErrRecordTooLarge", err)
+	}
+	checkBatch(t, db, 20, false)
+	if _, found, _ := db.Get("large"); found {
+		t.Error("large key of the rejected batch is visible")
+	}
+
+	if err := db.Write(makeTestBatch(20)); err != nil {
+		t.Fatal(err)
+	}
+	checkBatch(t, db, 20, true)
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db = openWithOptions(t, opts)
+	checkBatch(t, db, 20, true)
+	if _, found, _ := db.Get("large"); found {
+		t.Error("large key of the rejected batch is restored")
+	}
+}
@@ -0,0 +1,501 @@
+package Engine
+
+import (
+	"encoding/json"
+	"errors"
+	"key-value-engine/structs/config"
+	"key-value-engine/structs/mergeOperator"
+	"key-value-engine/structs/record"
+	"key-value-engine/structs/scan"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+const (
+	FAMILY_OPTIONS_FILE = "OPTIONS.json"
+	FAMILY_DROPPED_FILE = "DROPPED"
+)
+
+var (
+	ErrNoFamily      = errors.New("column family does not exist")
+	ErrFamilyExists  = errors.New("column family already exists")
+	ErrFamilyDropped = errors.New("column family was dropped, its name can be used again after the database is reopened")
+	ErrInvalidFamily = errors.New("invalid column family name")
+
+	familyNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+/*
+ColumnFamilyOptions holds the settings of a column family created with DB.CreateColumnFamily.
+Zero values are taken from the configuration of the database, out of range values are replaced with their defaults.
+The settings are stored with the family, so it keeps them when the database is opened with another configuration.
+  - MemtableStructure: btree, skiplist or hashmap.
+  - MemtableSize: number of records in one memtable.
+  - MemtableCount: number of memtables kept in memory before the oldest one is flushed.
+  - CompressionType: size-tiered or leveled compaction of the SSTables.
+*/
+type ColumnFamilyOptions struct {
+	MemtableStructure string `json:"memtable_structure"`
+	MemtableSize      uint64 `json:"memtable_size"`
+	MemtableCount     uint64 `json:"memtable_count"`
+	CompressionType   string `json:"compression_type"`
+}
+
+// familyOptions is the content of the options file of a user family
+type familyOptions struct {
+	ColumnFamilyOptions
+	CreatedSeq uint64 `json:"created_seq"`
+}
+
+/*
+ColumnFamily is a handle to a named key space of the database.
+Every family has its own memtables, cache and SSTables, all of them share the write-ahead log,
+so a WriteBatch spanning several families is applied atomically.
+
+The methods behave like the methods of DB with the same name and return ErrNoFamily once the family is dropped.
+*/
+type ColumnFamily struct {
+	db     *DB
+	family *family
+}
+
+/*
+CreateColumnFamily creates a family with its own memtable and compaction settings.
+
+Parameters:
+  - name: Name of the family, made of letters, digits, '_' and '-'.
+  - opts: Settings of the family.
+
+Returns:
+  - *ColumnFamily: Handle to the created family.
+  - error: ErrInvalidFamily if the name is invalid or reserved, ErrFamilyExists if the family exists,
+    ErrFamilyDropped if it was dropped since the database was opened, or any error during creating its directory.
+*/
+func (db *DB) CreateColumnFamily(name string, opts ColumnFamilyOptions) (*ColumnFamily, error) {
+	if !familyNameRegex.MatchString(name) || isInternalFamily(name) {
+		return nil, ErrInvalidFamily
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	// the directory of a dropped family is removed when the database is opened again
+	directory := familyDirectory(db.directory, name)
+	if _, err := os.Stat(filepath.Join(directory, FAMILY_DROPPED_FILE)); err == nil {
+		return nil, ErrFamilyDropped
+	}
+	if _, err := os.Stat(directory); !os.IsNotExist(err) {
+		return nil, ErrFamilyExists
+	}
+
+	cfg := familyConfig(db.config, opts)
+	stored := familyOptions{
+		ColumnFamilyOptions: ColumnFamilyOptions{
+			MemtableStructure: cfg.MemtableStructure,
+			MemtableSize:      cfg.MemtableSize,
+			MemtableCount:     cfg.MemtableCount,
+			CompressionType:   cfg.CompressionType,
+		},
+		CreatedSeq: db.seq,
+	}
+
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return nil, err
+	}
+	err = writeFamilyOptions(directory, stored)
+	if err != nil {
+		_ = os.RemoveAll(directory)
+		return nil, err
+	}
+
+	f, err := openFamily(db.directory, name, cfg, mergeOperator.MakePrefixOperator(nil, db.mergeOperator))
+	if err != nil {
+		return nil, err
+	}
+	f.createdSeq = stored.CreatedSeq
+
+	db.families[name] = f
+	db.walFamilies[name] = f.walFamily()
+
+	return &ColumnFamily{db: db, family: f}, nil
+}
+
+/*
+ColumnFamily returns the handle to a family created with CreateColumnFamily, or to the default family.
+
+Returns:
+  - *ColumnFamily: Handle to the family.
+  - error: ErrNoFamily if the family does not exist.
+*/
+func (db *DB) ColumnFamily(name string) (*ColumnFamily, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	f := db.families[name]
+	if f == nil || (isInternalFamily(name) && name != FAMILY_DEFAULT) {
+		return nil, ErrNoFamily
+	}
+
+	return &ColumnFamily{db: db, family: f}, nil
+}
+
+/*
+ColumnFamilies returns the names of the default family and the families created with CreateColumnFamily, sorted.
+*/
+func (db *DB) ColumnFamilies() []string {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	names := []string{FAMILY_DEFAULT}
+	for name := range db.families {
+		if !isInternalFamily(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+/*
+DropColumnFamily removes a family created with CreateColumnFamily together with all of its keys.
+The family stops accepting reads and writes at once, its files are removed when the database is opened again,
+so iterators already reading from it can finish. Until then its name cannot be used again,
+CreateColumnFamily returns ErrFamilyDropped for it and ColumnFamily returns ErrNoFamily.
+
+Returns:
+  - error: ErrNoFamily if the family does not exist, ErrInvalidFamily for the default family,
+    or any error during marking the family as dropped.
+*/
+func (db *DB) DropColumnFamily(name string) error {
+	if isInternalFamily(name) {
+		return ErrInvalidFamily
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	f := db.families[name]
+	if f == nil {
+		return ErrNoFamily
+	}
+
+	err := os.WriteFile(filepath.Join(f.directory, FAMILY_DROPPED_FILE), nil, 0644)
+	if err != nil {
+		return err
+	}
+
+	// without the family its records are skipped and its memtables no longer hold back the WAL
+	f.dropped = true
+	delete(db.families, name)
+	delete(db.walFamilies, name)
+
+	return nil
+}
+
+// isInternalFamily reports whether the name belongs to a family the engine creates itself
+func isInternalFamily(name string) bool {
+	return name == FAMILY_DEFAULT || name == FAMILY_SKETCH || name == FAMILY_FINGERPRINT || name == FAMILY_SYSTEM
+}
+
+// familyConfig returns the configuration of the database with the settings of the family applied
+func familyConfig(cfg *config.Config, opts ColumnFamilyOptions) *config.Config {
+	familyCfg := *cfg
+	if opts.MemtableStructure != "" {
+		familyCfg.MemtableStructure = opts.MemtableStructure
+	}
+	if opts.MemtableSize != 0 {
+		familyCfg.MemtableSize = opts.MemtableSize
+	}
+	if opts.MemtableCount != 0 {
+		familyCfg.MemtableCount = opts.MemtableCount
+	}
+	if opts.CompressionType != "" {
+		familyCfg.CompressionType = opts.CompressionType
+	}
+	familyCfg.Validate()
+
+	return &familyCfg
+}
+
+// writeFamilyOptions writes the options file, it is synced and renamed into place so it is never partially written
+func writeFamilyOptions(directory string, opts familyOptions) error {
+	marshalled, err := json.MarshalIndent(opts, "", "  ")
+	if err != nil {
+		return errors.New("error converting column family options to json")
+	}
+
+	tmpPath := filepath.Join(directory, FAMILY_OPTIONS_FILE+".tmp")
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.New("error writing column family options")
+	}
+	_, err = file.Write(marshalled)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err != nil || closeErr != nil {
+		return errors.New("error writing column family options")
+	}
+
+	err = os.Rename(tmpPath, filepath.Join(directory, FAMILY_OPTIONS_FILE))
+	if err != nil {
+		return errors.New("error writing column family options")
+	}
+
+	return nil
+}
+
+func readFamilyOptions(directory string) (familyOptions, error) {
+	var opts familyOptions
+
+	data, err := os.ReadFile(filepath.Join(directory, FAMILY_OPTIONS_FILE))
+	if err != nil {
+		return opts, errors.New("error reading column family options")
+	}
+	err = json.Unmarshal(data, &opts)
+	if err != nil {
+		return opts, errors.New("error converting column family options")
+	}
+
+	return opts, nil
+}
+
+/*
+openUserFamilies opens the families created with CreateColumnFamily and removes the directories of dropped ones.
+A directory without the options file is left by a create that did not finish, it is removed as well,
+since no record is written to a family before its options are.
+It has to run before the WAL is restored, so the records of the families are replayed into them.
+*/
+func openUserFamilies(directory string, cfg *config.Config, operator mergeOperator.MergeOperator) (map[string]*family, error) {
+	entries, err := os.ReadDir(filepath.Join(directory, FAMILIES_DIRECTORY))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	families := make(map[string]*family)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || isInternalFamily(name) {
+			continue
+		}
+
+		familyDir := familyDirectory(directory, name)
+		_, droppedErr := os.Stat(filepath.Join(familyDir, FAMILY_DROPPED_FILE))
+		_, optionsErr := os.Stat(filepath.Join(familyDir, FAMILY_OPTIONS_FILE))
+		if droppedErr == nil || os.IsNotExist(optionsErr) {
+			if err := os.RemoveAll(familyDir); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		opts, err := readFamilyOptions(familyDir)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := openFamily(directory, name, familyConfig(cfg, opts.ColumnFamilyOptions), mergeOperator.MakePrefixOperator(nil, operator))
+		if err != nil {
+			return nil, err
+		}
+		f.createdSeq = opts.CreatedSeq
+		families[name] = f
+	}
+
+	return families, nil
+}
+
+/*
+Name returns the name of the family.
+*/
+func (cf *ColumnFamily) Name() string {
+	return cf.family.name
+}
+
+/*
+Get retrieves the value stored under the key in the family.
+*/
+func (cf *ColumnFamily) Get(key string) ([]byte, bool, error) {
+	return cf.db.get(cf.family, key)
+}
+
+/*
+MultiGet retrieves the values of several keys of the family at once, see DB.MultiGet.
+*/
+func (cf *ColumnFamily) MultiGet(keys []string) ([][]byte, []bool, error) {
+	return cf.db.multiGet(cf.family, keys)
+}
+
+/*
+Put stores the key-value pair in the family.
+*/
+func (cf *ColumnFamily) Put(key string, value []byte) error {
+	return cf.db.put(cf.family, key, value)
+}
+
+/*
+PutWithTTL stores the key-value pair in the family, the key is treated as absent once the ttl has passed.
+*/
+func (cf *ColumnFamily) PutWithTTL(key string, value []byte, ttl time.Duration) error {
+	return cf.db.putWithTTL(cf.family, key, value, ttl)
+}
+
+/*
+Delete marks the key of the family as deleted.
+*/
+func (cf *ColumnFamily) Delete(key string) error {
+	_, err := cf.db.delete(cf.family, key)
+	return err
+}
+
+/*
+DeleteIfExists marks the key of the family as deleted if it is present, and reports whether it was.
+*/
+func (cf *ColumnFamily) DeleteIfExists(key string) (bool, error) {
+	return cf.db.delete(cf.family, key)
+}
+
+/*
+CompareAndSwap stores the new value in the family only if the key currently holds the expected value.
+*/
+func (cf *ColumnFamily) CompareAndSwap(key string, expected, value []byte) (bool, error) {
+	return cf.db.compareAndSwap(cf.family, key, expected, value)
+}
+
+/*
+PutIfAbsent stores the key-value pair in the family only if the key is missing, deleted or expired.
+*/
+func (cf *ColumnFamily) PutIfAbsent(key string, value []byte) (bool, error) {
+	return cf.db.putIfAbsent(cf.family, key, value)
+}
+
+/*
+DeleteIfEquals deletes the key of the family only if it currently holds the expected value.
+*/
+func (cf *ColumnFamily) DeleteIfEquals(key string, expected []byte) (bool, error) {
+	return cf.db.deleteIfEquals(cf.family, key, expected)
+}
+
+/*
+Merge stores the merge operand of the key in the family, it uses the merge operator of the database.
+*/
+func (cf *ColumnFamily) Merge(key string, operand []byte) error {
+	return cf.db.merge(cf.family, key, operand)
+}
+
+/*
+DeleteRange deletes every key of the family within [start, end] with a single range tombstone.
+*/
+func (cf *ColumnFamily) DeleteRange(start, end string) error {
+	return cf.db.deleteRange(cf.family, start, end)
+}
+
+/*
+PrefixScan returns the records on the requested page of keys of the family starting with the prefix.
+*/
+func (cf *ColumnFamily) PrefixScan(prefix string, pageNumber, pageSize int) ([]*record.Record, error) {
+	return cf.db.prefixScan(cf.family, prefix, pageNumber, pageSize)
+}
+
+/*
+RangeScan returns the records on the requested page of keys of the family within [minRange, maxRange].
+*/
+func (cf *ColumnFamily) RangeScan(minRange, maxRange string, pageNumber, pageSize int) ([]*record.Record, error) {
+	return cf.db.rangeScan(cf.family, minRange, maxRange, pageNumber, pageSize)
+}
+
+/*
+PrefixScanAfter returns up to pageSize records with keys of the family starting with the prefix, after the cursor,
+and the cursor of the next page, see DB.PrefixScanAfter.
+*/
+func (cf *ColumnFamily) PrefixScanAfter(prefix string, after *string, pageSize int) ([]*record.Record, *string, error) {
+	return cf.db.prefixScanAfter(cf.family, prefix, after, pageSize)
+}
+
+/*
+RangeScanAfter returns up to pageSize records with keys of the family within [minRange, maxRange], after the cursor,
+and the cursor of the next page, see DB.PrefixScanAfter.
+*/
+func (cf *ColumnFamily) RangeScanAfter(minRange, maxRange string, after *string, pageSize int) ([]*record.Record, *string, error) {
+	return cf.db.rangeScanAfter(cf.family, minRange, maxRange, after, pageSize)
+}
+
+/*
+FilterScan returns the records on the requested page of the records of the family the filter keeps, see DB.FilterScan.
+*/
+func (cf *ColumnFamily) FilterScan(filter *scan.Filter, pageNumber, pageSize int) ([]*record.Record, error) {
+	return cf.db.filterScan(cf.family, filter, pageNumber, pageSize)
+}
+
+/*
+FilterScanAfter returns up to pageSize records of the family the filter keeps, after the cursor,
+and the cursor of the next page, see DB.PrefixScanAfter.
+*/
+func (cf *ColumnFamily) FilterScanAfter(filter *scan.Filter, after *string, pageSize int) ([]*record.Record, *string, error) {
+	return cf.db.filterScanAfter(cf.family, filter, after, pageSize)
+}
+
+/*
+PrefixStats counts the keys of the family starting with the prefix and the bytes they use, see DB.PrefixStats.
+*/
+func (cf *ColumnFamily) PrefixStats(prefix string, approximate bool) (scan.Stats, error) {
+	return cf.db.prefixStats(cf.family, prefix, approximate)
+}
+
+/*
+RangeStats counts the keys of the family within [minRange, maxRange] and the bytes they use, see DB.PrefixStats.
+*/
+func (cf *ColumnFamily) RangeStats(minRange, maxRange string, approximate bool) (scan.Stats, error) {
+	return cf.db.rangeStats(cf.family, minRange, maxRange, approximate)
+}
+
+/*
+PrefixBounds returns the first and the last live key of the family starting with the prefix.
+*/
+func (cf *ColumnFamily) PrefixBounds(prefix string) (string, string, bool, error) {
+	return cf.db.prefixBounds(cf.family, prefix)
+}
+
+/*
+RangeBounds returns the first and the last live key of the family within [minRange, maxRange].
+*/
+func (cf *ColumnFamily) RangeBounds(minRange, maxRange string) (string, string, bool, error) {
+	return cf.db.rangeBounds(cf.family, minRange, maxRange)
+}
+
+/*
+PrefixIterator returns an iterator over keys of the family starting with the prefix, reading from its own snapshot.
+Stop must be called to release the snapshot, like for the iterators of DB.
+*/
+func (cf *ColumnFamily) PrefixIterator(prefix string) (*scan.PrefixIterator, error) {
+	return cf.db.prefixIterator(cf.family, prefix)
+}
+
+/*
+RangeIterator returns an iterator over keys of the family within [minRange, maxRange], reading from its own snapshot.
+Stop must be called to release the snapshot, like for the iterators of DB.
+*/
+func (cf *ColumnFamily) RangeIterator(minRange, maxRange string) (*scan.RangeIterator, error) {
+	return cf.db.rangeIterator(cf.family, minRange, maxRange)
+}
@@ -0,0 +1,73 @@
+package Engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDroppedFamilyName(t *testing.T) {
+	opts := testOptions(t, "btree")
+	db := openWithOptions(t, opts)
+	cf, err := db.CreateColumnFamily("logs", ColumnFamilyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cf.Put("key", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.DropColumnFamily("logs"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.ColumnFamily("logs"); !errors.Is(err, ErrNoFamily) {
+		t.Errorf("ColumnFamily of a dropped family: got %v, want ErrNoFamily", err)
+	}
+	if _, err = db.CreateColumnFamily("logs", ColumnFamilyOptions{}); !errors.Is(err, ErrFamilyDropped) {
+		t.Errorf("CreateColumnFamily of a dropped family: got %v, want ErrFamilyDropped", err)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db = openWithOptions(t, opts)
+	cf, err = db.CreateColumnFamily("logs", ColumnFamilyOptions{})
+	if err != nil {
+		t.Fatalf("CreateColumnFamily after reopening: %v", err)
+	}
+	if _, found, err := cf.Get("key"); err != nil || found {
+		t.Errorf("key of the dropped family: found %v %v", found, err)
+	}
+}
+
+// TestUnfinishedFamilyCreate checks that a family directory left without options by a crash does not stop the database from opening
+func TestUnfinishedFamilyCreate(t *testing.T) {
+	opts := testOptions(t, "btree")
+	db := openWithOptions(t, opts)
+	if _, err := db.CreateColumnFamily("logs", ColumnFamilyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	unfinished := familyDirectory(opts.Directory, "events")
+	if err := os.MkdirAll(unfinished, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(unfinished, FAMILY_OPTIONS_FILE+".tmp"), []byte(`{"memtable_str`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openWithOptions(t, opts)
+	if _, err := os.Stat(unfinished); !os.IsNotExist(err) {
+		t.Errorf("the directory of the unfinished family was not removed: %v", err)
+	}
+	if _, err := db.ColumnFamily("logs"); err != nil {
+		t.Errorf("ColumnFamily of a finished family: %v", err)
+	}
+	if _, err := db.CreateColumnFamily("events", ColumnFamilyOptions{}); err != nil {
+		t.Errorf("CreateColumnFamily of the unfinished family: %v", err)
+	}
+}
@@ -24,29 +24,38 @@ const (
 	OPTION_PREFIXITER = 12
 	OPTION_RANGEITER  = 13
 
-	EXITREGEX = `^exit$`
+	OPTION_CAS     = 14
+	OPTION_SETNX   = 15
+	OPTION_DELIFEQ = 16
 
-	PUTREGEX    = `^put\s\w+\s.+$`
-	GETREGEX    = `^get\s\w+$`
-	DELETEREGEX = `^delete\s\w+$`
+	OPTION_ITERNEXT = 17
+	OPTION_ITERSTOP = 18
+	OPTION_ITERPREV = 19
+	OPTION_ITERSEEK = 20
+	OPTION_ITERLAST = 21
 
-	MAKEREGEX         = `^(bf|cms|hll) make \w+$`
-	DESTROYREGEX      = `^(bf|cms|hll) destroy \w+$`
-	ADDTOSTRUCTREGEX  = `^(bf|cms|hll) put \w+ .+$`
-	CHECKSTRUCTURE    = `^(bf|cms) check \w+ .+$`
-	CHECKSTRUCTUREHLL = `^hll check \w+$`
+	OPTION_COUNT       = 22
+	OPTION_DU          = 23
+	OPTION_BOUNDS      = 24
+	OPTION_APPROXCOUNT = 25
+	OPTION_APPROXDU    = 26
 
-	FINGERPRINTREGEX = `^fingerprint \w+ .+$`
-	SIMHASHREGEX     = `^simhash \w+ \w+$`
+	OPTION_MATCHSCAN = 27
+	OPTION_REGEXSCAN = 28
 
-	PREFIXSCANREGEX = `^prefixscan \w+ \d+ \d+$`
-	RANGESCANREGEX  = `^rangescan \w+-\w+ \d+ \d+$`
+	ITER_NEXT = "next"
+	ITER_STOP = "stop"
+	ITER_PREV = "prev"
+	ITER_SEEK = "seek"
+	ITER_LAST = "last"
 
-	PREFIXITERREGEX = `^prefixiterate \w+$`
-	RANGEITERREGEX  = `^rangeiterate \w+-\w+$`
+	CURSOR_PREFIX = "cursor:"
 
-	STOPREGEX = `^stop$`
-	NEXTREGEX = `^next$`
+	APPROX = "approx"
 
-	SYSTEMKEY = `(hll|cms|fingerprint|tokenLog|bf|)\s.+$`
+	SCAN           = "scan"
+	VALUE_CONTAINS = "contains"
+	VALUE_JSON     = "json"
+
+	TOKEN_LOG = "tokenLog"
 )
@@ -0,0 +1,460 @@
+package Engine
+
+import (
+	"errors"
+	"key-value-engine/structs/config"
+	"key-value-engine/structs/mergeOperator"
+	"key-value-engine/structs/record"
+	"key-value-engine/structs/scan"
+	"key-value-engine/structs/wal"
+	"key-value-engine/structs/wputils"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	DATA_DIRECTORY = "data"
+)
+
+var (
+	ErrClosed       = errors.New("database is closed")
+	ErrCorrupted    = errors.New("crc error")
+	ErrInvalidTTL   = errors.New("ttl must be positive")
+	ErrInvalidRange = errors.New("range start is greater than its end")
+	ErrNoMerge      = errors.New("no merge operator for the key")
+)
+
+/*
+Options holds the settings used when opening a DB.
+  - Directory: root directory of the write-ahead log, SSTables and memtable bookkeeping.
+  - Config: every engine setting, see config.Config.
+  - MergeOperator: operator folding the operands written with Merge to the default family and the families
+    created with DB.CreateColumnFamily, nil if Merge is not used.
+    Bloom filters, count-min sketches and hyperloglogs always use their own operators in the sketch family.
+
+Several databases can be opened in one process as long as their directories differ.
+*/
+type Options struct {
+	Directory     string
+	MergeOperator mergeOperator.MergeOperator
+	config.Config
+}
+
+/*
+DefaultOptions returns options with the default data directory and default configuration.
+*/
+func DefaultOptions() Options {
+	return Options{
+		Directory: DATA_DIRECTORY,
+		Config:    config.DefaultConfig(),
+	}
+}
+
+/*
+LoadOptions returns options with the given data directory and the configuration read from configPath.
+*/
+func LoadOptions(directory, configPath string) (Options, error) {
+	cfg, err := config.MakeConfig(configPath)
+	if cfg == nil {
+		return Options{}, err
+	}
+
+	return Options{
+		Directory: directory,
+		Config:    *cfg,
+	}, err
+}
+
+/*
+DB is the embeddable handle to the key-value store.
+It owns the write-ahead log and the column families, each with its own memtables, cache and SSTables.
+User data is kept in the default family, structures, fingerprints and engine data in families of their own,
+so they never show up in user reads and scans. More families can be created with CreateColumnFamily.
+
+DB is safe for concurrent use:
+  - reads (Get, scans and iterator creation) run concurrently under a read lock,
+  - writes go through a single pipeline under the write lock, one at a time,
+  - memtable switches, flushes and compactions happen inside a write,
+    so they never overlap with FindInMem or iterator creation,
+  - iterators read from a snapshot taken when they are created and can be used without holding the lock,
+    the snapshot is released by their Stop.
+
+Every record gets a sequence number from the write pipeline, a newer version of a key always has a greater one.
+The counter continues after the greatest sequence number found in the SSTables and the restored write-ahead log.
+*/
+type DB struct {
+	directory        string
+	config           *config.Config
+	commitLog        *wal.WAL
+	families         map[string]*family
+	defaultFamily    *family
+	walFamilies      map[string]*wputils.Family
+	walRestoreOffset int64
+	mergeOperator    mergeOperator.MergeOperator
+	seq              uint64
+	closed           bool
+	lock             sync.RWMutex
+}
+
+/*
+Open initializes all storage structures and restores memtables from the write-ahead log.
+Out of range settings are replaced with their defaults.
+
+Parameters:
+  - opts: Options used for opening the database.
+
+Returns:
+  - *DB: Pointer to the opened database.
+  - error: Error, if any, during initialization or restoration.
+*/
+func Open(opts Options) (*DB, error) {
+	cfg := opts.Config
+	cfg.Validate()
+
+	directory := opts.Directory
+	if directory == "" {
+		directory = DATA_DIRECTORY
+	}
+
+	commitLog, err := wal.MakeWAL(directory, int64(cfg.WalSize))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = os.Stat(filepath.Join(directory, FAMILIES_DIRECTORY))
+	migrate := os.IsNotExist(err)
+
+	operators := map[string]*mergeOperator.PrefixOperator{
+		FAMILY_DEFAULT: mergeOperator.MakePrefixOperator(nil, opts.MergeOperator),
+		FAMILY_SKETCH: mergeOperator.MakePrefixOperator(map[string]mergeOperator.MergeOperator{
+			structKey(STRUCT_BF, ""):  mergeOperator.MakeBloomFilterAddOperator(),
+			structKey(STRUCT_CMS, ""): mergeOperator.MakeCMSAddOperator(),
+			structKey(STRUCT_HLL, ""): mergeOperator.MakeHLLAddOperator(),
+		}, nil),
+		FAMILY_FINGERPRINT: mergeOperator.MakePrefixOperator(nil, nil),
+		FAMILY_SYSTEM:      mergeOperator.MakePrefixOperator(nil, nil),
+	}
+
+	families, err := openUserFamilies(directory, &cfg, opts.MergeOperator)
+	if err != nil {
+		return nil, err
+	}
+	if families == nil {
+		families = make(map[string]*family, len(operators))
+	}
+	for name, operator := range operators {
+		f, err := openFamily(directory, name, &cfg, operator)
+		if err != nil {
+			return nil, err
+		}
+		families[name] = f
+	}
+
+	var seq uint64
+	for _, f := range families {
+		if f.sst.LastSeq() > seq {
+			seq = f.sst.LastSeq()
+		}
+	}
+
+	logFamilies := walFamilies(families)
+	restore, err := wputils.Restore(logFamilies, commitLog)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range families {
+		if f.memMan.LastSeq() > seq {
+			seq = f.memMan.LastSeq()
+		}
+	}
+
+	db := &DB{
+		directory:        directory,
+		config:           &cfg,
+		commitLog:        commitLog,
+		families:         families,
+		defaultFamily:    families[FAMILY_DEFAULT],
+		walFamilies:      logFamilies,
+		walRestoreOffset: restore,
+		mergeOperator:    opts.MergeOperator,
+		seq:              seq,
+	}
+
+	if migrate {
+		err = db.migrateSystemKeys()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+/*
+Config returns a copy of the configuration the database was opened with.
+*/
+func (db *DB) Config() config.Config {
+	return *db.config
+}
+
+/*
+Get retrieves the value stored under the key.
+
+Returns:
+  - []byte: Value of the key.
+  - bool: Indicates whether the key was found.
+  - error: Error, if any, during reading.
+*/
+func (db *DB) Get(key string) ([]byte, bool, error) {
+	return db.get(db.defaultFamily, key)
+}
+
+/*
+MultiGet retrieves the values of several keys at once.
+Keys are looked up in the memtables and the cache first, the rest are read with every SSTable opened once.
+
+Returns:
+  - [][]byte: Value of each key, in the order of the keys.
+  - []bool: Indicates whether each key was found.
+  - error: Error, if any, during reading.
+*/
+func (db *DB) MultiGet(keys []string) ([][]byte, []bool, error) {
+	return db.multiGet(db.defaultFamily, keys)
+}
+
+/*
+Put stores the key-value pair, replacing any previous value of the key.
+*/
+func (db *DB) Put(key string, value []byte) error {
+	return db.put(db.defaultFamily, key, value)
+}
+
+/*
+PutWithTTL stores the key-value pair like Put, the key is treated as absent once the ttl has passed.
+Expired records are removed from the SSTables by compaction.
+
+Returns:
+  - error: Error if the ttl is not positive, or any error during writing.
+*/
+func (db *DB) PutWithTTL(key string, value []byte, ttl time.Duration) error {
+	return db.putWithTTL(db.defaultFamily, key, value, ttl)
+}
+
+/*
+Delete marks the key as deleted. Deleting a missing key is not an error.
+*/
+func (db *DB) Delete(key string) error {
+	_, err := db.delete(db.defaultFamily, key)
+	return err
+}
+
+/*
+DeleteIfExists marks the key as deleted if it is present.
+The check and the delete happen atomically with respect to other writers,
+so of concurrent deletes of a key only one reports it.
+
+Returns:
+  - bool: Indicates whether the key was present and deleted.
+  - error: Error, if any, during reading or writing.
+*/
+func (db *DB) DeleteIfExists(key string) (bool, error) {
+	return db.delete(db.defaultFamily, key)
+}
+
+/*
+CompareAndSwap stores the new value only if the key currently holds the expected value.
+The check and the write happen atomically with respect to other writers.
+
+Returns:
+  - bool: Indicates whether the value was swapped, false if the key is missing or holds another value.
+  - error: Error, if any, during reading or writing.
+*/
+func (db *DB) CompareAndSwap(key string, expected, value []byte) (bool, error) {
+	return db.compareAndSwap(db.defaultFamily, key, expected, value)
+}
+
+/*
+PutIfAbsent stores the key-value pair only if the key is missing, deleted or expired.
+The check and the write happen atomically with respect to other writers.
+
+Returns:
+  - bool: Indicates whether the value was stored.
+  - error: Error, if any, during reading or writing.
+*/
+func (db *DB) PutIfAbsent(key string, value []byte) (bool, error) {
+	return db.putIfAbsent(db.defaultFamily, key, value)
+}
+
+/*
+DeleteIfEquals deletes the key only if it currently holds the expected value.
+The check and the delete happen atomically with respect to other writers.
+
+Returns:
+  - bool: Indicates whether the key was deleted.
+  - error: Error, if any, during reading or writing.
+*/
+func (db *DB) DeleteIfEquals(key string, expected []byte) (bool, error) {
+	return db.deleteIfEquals(db.defaultFamily, key, expected)
+}
+
+/*
+Merge stores the operand as a merge record without reading the key.
+The operand is combined with the value of the key by the merge operator when the key is read,
+and folded into the value when the SSTables holding them are compacted.
+
+Returns:
+  - error: ErrNoMerge if no merge operator handles the key, or any error during writing.
+*/
+func (db *DB) Merge(key string, operand []byte) error {
+	return db.merge(db.defaultFamily, key, operand)
+}
+
+/*
+DeleteRange deletes every key within [start, end] with a single range tombstone,
+without reading the keys first. Keys written after it are not affected.
+
+Returns:
+  - error: ErrInvalidRange if start is greater than end, or any error during writing.
+*/
+func (db *DB) DeleteRange(start, end string) error {
+	return db.deleteRange(db.defaultFamily, start, end)
+}
+
+/*
+PrefixScan returns the records on the requested page of keys starting with the prefix.
+*/
+func (db *DB) PrefixScan(prefix string, pageNumber, pageSize int) ([]*record.Record, error) {
+	return db.prefixScan(db.defaultFamily, prefix, pageNumber, pageSize)
+}
+
+/*
+RangeScan returns the records on the requested page of keys within [minRange, maxRange].
+*/
+func (db *DB) RangeScan(minRange, maxRange string, pageNumber, pageSize int) ([]*record.Record, error) {
+	return db.rangeScan(db.defaultFamily, minRange, maxRange, pageNumber, pageSize)
+}
+
+/*
+PrefixScanAfter returns up to pageSize records with keys starting with the prefix, after the cursor.
+Unlike PrefixScan the page is found with a seek, so deep pages are as cheap as the first one
+and keys written between the calls do not shift the later pages.
+
+Parameters:
+  - prefix: Prefix of the keys.
+  - after: Cursor returned with the previous page, nil for the first page.
+  - pageSize: Maximum number of records on the page.
+
+Returns:
+  - []*record.Record: Records of the page.
+  - *string: Cursor of the next page, nil once there are no more records.
+  - error: Error, if any, during reading.
+*/
+func (db *DB) PrefixScanAfter(prefix string, after *string, pageSize int) ([]*record.Record, *string, error) {
+	return db.prefixScanAfter(db.defaultFamily, prefix, after, pageSize)
+}
+
+/*
+RangeScanAfter returns up to pageSize records with keys within [minRange, maxRange], after the cursor.
+The cursor works the same way as in PrefixScanAfter.
+*/
+func (db *DB) RangeScanAfter(minRange, maxRange string, after *string, pageSize int) ([]*record.Record, *string, error) {
+	return db.rangeScanAfter(db.defaultFamily, minRange, maxRange, after, pageSize)
+}
+
+/*
+FilterScan returns the records on the requested page of the records the filter keeps,
+made by scan.MakeGlobFilter or scan.MakeRegexFilter. Only the keys with the literal prefix of the pattern are read.
+*/
+func (db *DB) FilterScan(filter *scan.Filter, pageNumber, pageSize int) ([]*record.Record, error) {
+	return db.filterScan(db.defaultFamily, filter, pageNumber, pageSize)
+}
+
+/*
+FilterScanAfter returns up to pageSize records the filter keeps, after the cursor,
+the cursor works the same way as in PrefixScanAfter.
+*/
+func (db *DB) FilterScanAfter(filter *scan.Filter, after *string, pageSize int) ([]*record.Record, *string, error) {
+	return db.filterScanAfter(db.defaultFamily, filter, after, pageSize)
+}
+
+/*
+PrefixStats counts the keys starting with the prefix and the bytes they use.
+
+Parameters:
+  - prefix: Prefix of the keys.
+  - approximate: Estimates the result from the indexes of the SSTables instead of reading and merging the records,
+    every stored version is then counted and the size includes the headers of the records.
+
+Returns:
+  - scan.Stats: Number of keys and the summed sizes of their keys and values.
+  - error: Error, if any, during reading.
+*/
+func (db *DB) PrefixStats(prefix string, approximate bool) (scan.Stats, error) {
+	return db.prefixStats(db.defaultFamily, prefix, approximate)
+}
+
+/*
+RangeStats counts the keys within [minRange, maxRange] and the bytes they use, see PrefixStats.
+*/
+func (db *DB) RangeStats(minRange, maxRange string, approximate bool) (scan.Stats, error) {
+	return db.rangeStats(db.defaultFamily, minRange, maxRange, approximate)
+}
+
+/*
+PrefixBounds returns the first and the last live key starting with the prefix.
+
+Returns:
+  - string: First key.
+  - string: Last key.
+  - bool: Indicates whether any live key has the prefix.
+  - error: Error, if any, during reading.
+*/
+func (db *DB) PrefixBounds(prefix string) (string, string, bool, error) {
+	return db.prefixBounds(db.defaultFamily, prefix)
+}
+
+/*
+RangeBounds returns the first and the last live key within [minRange, maxRange], see PrefixBounds.
+*/
+func (db *DB) RangeBounds(minRange, maxRange string) (string, string, bool, error) {
+	return db.rangeBounds(db.defaultFamily, minRange, maxRange)
+}
+
+/*
+PrefixIterator returns an iterator over keys starting with the prefix.
+It reads from its own snapshot, so it does not see writes made after it was created.
+The snapshot is held until Stop is called, also after the last record, since the iterator can still move back.
+Tables made obsolete by a compaction stay on disk while it is held, so Stop must always be called.
+*/
+func (db *DB) PrefixIterator(prefix string) (*scan.PrefixIterator, error) {
+	return db.prefixIterator(db.defaultFamily, prefix)
+}
+
+/*
+RangeIterator returns an iterator over keys within [minRange, maxRange].
+It reads from its own snapshot, so it does not see writes made after it was created.
+The snapshot is held until Stop is called, also after the last record, since the iterator can still move back.
+Tables made obsolete by a compaction stay on disk while it is held, so Stop must always be called.
+*/
+func (db *DB) RangeIterator(minRange, maxRange string) (*scan.RangeIterator, error) {
+	return db.rangeIterator(db.defaultFamily, minRange, maxRange)
+}
+
+/*
+Close closes the database. Memtables do not need to be flushed since
+they are restored from the write-ahead log on the next Open.
+*/
+func (db *DB) Close() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	db.closed = true
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package Engine
+
+import (
+	"fmt"
+	"io/fs"
+	"key-value-engine/structs/sstable"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+const (
+	STABLE_KEYS = 100
+	WRITERS     = 4
+	READERS     = 4
+	WRITES      = 150
+)
+
+// testOptions returns options with tiny memtables in a temporary directory, so the writes of a test switch, flush and compact them often
+func testOptions(t *testing.T, structure string) Options {
+	opts := DefaultOptions()
+	opts.Directory = t.TempDir()
+	opts.MemtableSize = 16
+	opts.MemtableCount = 2
+	opts.MemtableStructure = structure
+	opts.TablesToCompress = 2
+	return opts
+}
+
+func openTestDB(t *testing.T, structure string) *DB {
+	return openWithOptions(t, testOptions(t, structure))
+}
+
+// openWithOptions opens the database and closes it at the end of the test, it is also used to reopen a closed one
+func openWithOptions(t *testing.T, opts Options) *DB {
+	db, err := Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+func stableKey(i int) string {
+	return fmt.Sprintf("stable:%03d", i)
+}
+
+/*
+TestConcurrentReadsAndWrites runs Get, PrefixIterator and RangeIterator while other goroutines write,
+so the memtables switch and flush and the SSTables compact under the readers. Run it with -race.
+The stable keys are written before and never changed, so every read must see all of them.
+*/
+func TestConcurrentReadsAndWrites(t *testing.T) {
+	for _, structure := range []string{"btree", "skiplist", "hashmap"} {
+		t.Run(structure, func(t *testing.T) {
+			db := openTestDB(t, structure)
+			for i := 0; i < STABLE_KEYS; i++ {
+				if err := db.Put(stableKey(i), []byte(stableKey(i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var writers, readers sync.WaitGroup
+			done := make(chan struct{})
+			for w := 0; w < WRITERS; w++ {
+				writers.Add(1)
+				go func(w int) {
+					defer writers.Done()
+					write(t, db, w)
+				}(w)
+			}
+			writers.Add(1)
+			go func() {
+				defer writers.Done()
+				for i := 0; i < 5; i++ {
+					if err := db.Compact(); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+			for r := 0; r < READERS; r++ {
+				readers.Add(1)
+				go func() {
+					defer readers.Done()
+					for {
+						select {
+						case <-done:
+							return
+						default:
+							read(t, db)
+						}
+					}
+				}()
+			}
+
+			writers.Wait()
+			close(done)
+			readers.Wait()
+			read(t, db)
+		})
+	}
+}
+
+// write puts, deletes and range deletes the hot keys of the writer
+func write(t *testing.T, db *DB, w int) {
+	for i := 0; i < WRITES; i++ {
+		key := fmt.Sprintf("hot:%d:%03d", w, i%50)
+		var err error
+		switch i % 10 {
+		case 7:
+			err = db.Delete(key)
+		case 9:
+			err = db.DeleteRange(fmt.Sprintf("hot:%d:000", w), fmt.Sprintf("hot:%d:010", w))
+		default:
+			err = db.Put(key, []byte(fmt.Sprint(i)))
+		}
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+}
+
+// read checks the stable keys with Get and both iterators, and that the hot keys come in order
+func read(t *testing.T, db *DB) {
+	for i := 0; i < STABLE_KEYS; i += 7 {
+		value, found, err := db.Get(stableKey(i))
+		if err != nil || !found || string(value) != stableKey(i) {
+			t.Errorf("get %s: %q %v %v", stableKey(i), value, found, err)
+			return
+		}
+	}
+
+	pit, err := db.PrefixIterator("stable:")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	count := 0
+	for rec := pit.Next(); rec != nil; rec = pit.Next() {
+		if rec.GetKey() != stableKey(count) {
+			t.Errorf("prefix iterator: got %s, want %s", rec.GetKey(), stableKey(count))
+			break
+		}
+		count++
+	}
+	pit.Stop()
+	if count != STABLE_KEYS && !t.Failed() {
+		t.Errorf("prefix iterator: got %d keys, want %d", count, STABLE_KEYS)
+	}
+
+	rit, err := db.RangeIterator("hot:", "hot:~")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	last := ""
+	for rec := rit.Next(); rec != nil; rec = rit.Next() {
+		if rec.GetKey() <= last {
+			t.Errorf("range iterator: %s after %s", rec.GetKey(), last)
+			break
+		}
+		last = rec.GetKey()
+	}
+	rit.Stop()
+}
+
+// TestUnreadableIndex checks that a table whose index cannot be read fails estimates and iterators instead of skipping its keys
+func TestUnreadableIndex(t *testing.T) {
+	opts := testOptions(t, "btree")
+	opts.MultipleFilesSST = true
+	db := openWithOptions(t, opts)
+	for i := 0; i < STABLE_KEYS; i++ {
+		if err := db.Put(stableKey(i), []byte(stableKey(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed := 0
+	err := filepath.WalkDir(opts.Directory, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.Name() == sstable.INDEXNAME {
+			removed++
+			return os.Remove(path)
+		}
+		return err
+	})
+	if err != nil || removed == 0 {
+		t.Fatalf("removing the indexes: %d removed, %v", removed, err)
+	}
+
+	if _, err = db.PrefixStats("stable:", true); err == nil {
+		t.Error("estimate without the indexes returned no error")
+	}
+
+	for _, backward := range []bool{false, true} {
+		pit, err := db.PrefixIterator("stable:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if backward {
+			pit.SeekToLast()
+			for pit.Prev() != nil {
+			}
+		} else {
+			for pit.Next() != nil {
+			}
+		}
+		if pit.Err() == nil {
+			t.Errorf("iterator without the indexes, backward %v: no error", backward)
+		}
+		pit.Stop()
+	}
+}
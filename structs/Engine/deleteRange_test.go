@@ -0,0 +1,164 @@
+package Engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// model is the expected content of the "k:" keys
+type model map[string]string
+
+func rangeKey(i int) string {
+	return fmt.Sprintf("k:%02d", i)
+}
+
+func (m model) put(t *testing.T, db *DB, i int, value string) {
+	if err := db.Put(rangeKey(i), []byte(value)); err != nil {
+		t.Fatal(err)
+	}
+	m[rangeKey(i)] = value
+}
+
+func (m model) deleteRange(t *testing.T, db *DB, start, end int) {
+	if err := db.DeleteRange(rangeKey(start), rangeKey(end)); err != nil {
+		t.Fatal(err)
+	}
+	for i := start; i <= end; i++ {
+		delete(m, rangeKey(i))
+	}
+}
+
+// check compares Get, MultiGet, the prefix iterator and the prefix scan of the "k:" keys with the model
+func (m model) check(t *testing.T, db *DB, stage string, keys int) {
+	t.Helper()
+
+	var all []string
+	for i := 0; i < keys; i++ {
+		all = append(all, rangeKey(i))
+	}
+	values, found, err := db.MultiGet(all)
+	if err != nil {
+		t.Fatalf("%s: multiget: %v", stage, err)
+	}
+	for i, key := range all {
+		want, present := m[key]
+		value, ok, err := db.Get(key)
+		if err != nil || ok != present || string(value) != want {
+			t.Errorf("%s: get %s: got %q %v %v, want %q %v", stage, key, value, ok, err, want, present)
+		}
+		if found[i] != present || string(values[i]) != want {
+			t.Errorf("%s: multiget %s: got %q %v, want %q %v", stage, key, values[i], found[i], want, present)
+		}
+	}
+
+	var want []string
+	for key, value := range m {
+		want = append(want, key+"="+value)
+	}
+	sort.Strings(want)
+
+	pit, err := db.PrefixIterator("k:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var iterated []string
+	for rec := pit.Next(); rec != nil; rec = pit.Next() {
+		iterated = append(iterated, rec.GetKey()+"="+string(rec.GetValue()))
+	}
+	pit.Stop()
+	if strings.Join(iterated, " ") != strings.Join(want, " ") {
+		t.Errorf("%s: iterator: got %v, want %v", stage, iterated, want)
+	}
+
+	recs, err := db.PrefixScan("k:", 1, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scanned []string
+	for _, rec := range recs {
+		scanned = append(scanned, rec.GetKey()+"="+string(rec.GetValue()))
+	}
+	if strings.Join(scanned, " ") != strings.Join(want, " ") {
+		t.Errorf("%s: scan: got %v, want %v", stage, scanned, want)
+	}
+}
+
+func TestDeleteRangeInMemtable(t *testing.T) {
+	opts := testOptions(t, "btree")
+	opts.MemtableSize = 1000
+	db := openWithOptions(t, opts)
+
+	m := model{}
+	for i := 0; i < 20; i++ {
+		m.put(t, db, i, "v1")
+	}
+	m.deleteRange(t, db, 5, 14)
+	m.check(t, db, "deleted", 20)
+
+	m.put(t, db, 7, "v2")
+	m.check(t, db, "put after the range", 20)
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db = openWithOptions(t, opts)
+	m.check(t, db, "reopened", 20)
+}
+
+/*
+TestDeleteRangeInSSTables deletes keys that are already in the SSTables, then moves the tombstone itself
+through flushes, compactions above the older tables and a full compaction that drops it at the bottom level.
+*/
+func TestDeleteRangeInSSTables(t *testing.T) {
+	for _, compaction := range []string{"size-tiered", "leveled"} {
+		t.Run(compaction, func(t *testing.T) {
+			opts := testOptions(t, "skiplist")
+			opts.CompressionType = compaction
+			db := openWithOptions(t, opts)
+
+			m := model{}
+			for i := 0; i < 40; i++ {
+				m.put(t, db, i, "v1")
+			}
+			if err := db.Compact(); err != nil {
+				t.Fatal(err)
+			}
+			m.deleteRange(t, db, 10, 29)
+			m.check(t, db, "tombstone in the memtable", 40)
+
+			m.put(t, db, 15, "v2")
+			m.check(t, db, "put after the range", 40)
+
+			// the filler flushes the tombstone and compacts the new tables above the table holding the keys
+			for i := 0; i < 100; i++ {
+				if err := db.Put(fmt.Sprintf("filler:%03d", i), []byte("x")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			m.check(t, db, "tombstone flushed", 40)
+
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			db = openWithOptions(t, opts)
+			m.check(t, db, "reopened", 40)
+
+			if err := db.Compact(); err != nil {
+				t.Fatal(err)
+			}
+			m.check(t, db, "compacted", 40)
+
+			m.put(t, db, 20, "v3")
+			if err := db.Compact(); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			db = openWithOptions(t, opts)
+			m.check(t, db, "compacted and reopened", 40)
+		})
+	}
+}
@@ -0,0 +1,514 @@
+package Engine
+
+import (
+	"bytes"
+	"key-value-engine/structs/config"
+	cache "key-value-engine/structs/lruCache"
+	"key-value-engine/structs/memtable"
+	"key-value-engine/structs/mergeOperator"
+	"key-value-engine/structs/record"
+	"key-value-engine/structs/scan"
+	"key-value-engine/structs/sstable"
+	"key-value-engine/structs/wputils"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+Column families of a database, each one is a separate key space:
+  - default: user data, the keys of every Get, Put, scan and iterator of DB,
+  - sketch: bloom filters, count-min sketches and hyperloglogs, keyed by structure and name,
+  - fingerprint: simhash fingerprints, keyed by name,
+  - system: data of the engine itself, such as the token bucket log.
+
+Families created with DB.CreateColumnFamily are kept next to the internal ones.
+*/
+const (
+	FAMILY_DEFAULT     = record.DEFAULT_FAMILY
+	FAMILY_SKETCH      = "sketch"
+	FAMILY_FINGERPRINT = "fingerprint"
+	FAMILY_SYSTEM      = "system"
+
+	FAMILIES_DIRECTORY = "families"
+)
+
+/*
+family holds the memtables, cache and SSTables of one column family.
+The default family is kept in the root of the data directory, the others in families/{name},
+all of them share the write-ahead log and the sequence numbers of the database.
+*/
+type family struct {
+	name          string
+	directory     string
+	memMan        *memtable.MemManager
+	sst           *sstable.SSTable
+	lruCache      *cache.LRUCache
+	mergeOperator *mergeOperator.PrefixOperator
+	createdSeq    uint64 // sequence number the family was created at, older records of its name belong to a dropped family
+	dropped       bool
+}
+
+// familyDirectory returns the directory of the family within the data directory
+func familyDirectory(directory, name string) string {
+	if name == FAMILY_DEFAULT {
+		return directory
+	}
+	return filepath.Join(directory, FAMILIES_DIRECTORY, name)
+}
+
+// openFamily opens the SSTables of the family and creates its memtables and cache, the memtables are filled by restoring the WAL
+func openFamily(directory, name string, cfg *config.Config, operator *mergeOperator.PrefixOperator) (*family, error) {
+	directory = familyDirectory(directory, name)
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+
+	sst, err := sstable.MakeSSTable(
+		directory,
+		int(cfg.SummaryIndexDensity),
+		cfg.MultipleFilesSST,
+		cfg.FilterPrecsion,
+		cfg.Compress,
+		int(cfg.MaxLsmLevels),
+		int(cfg.TablesToCompress),
+		cfg.CompressionType,
+		cfg.FirstLeveledSize,
+		cfg.LeveledInc,
+		operator,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &family{
+		name:          name,
+		directory:     directory,
+		memMan:        memtable.MakeMemTableManager(int(cfg.MemtableCount), int(cfg.MemtableSize), cfg.MemtableStructure, sst),
+		sst:           sst,
+		lruCache:      cache.NewLRUCache(int(cfg.CacheSize)),
+		mergeOperator: operator,
+	}, nil
+}
+
+// walFamilies returns the memtable managers of the families for restoring and writing the shared WAL
+func walFamilies(families map[string]*family) map[string]*wputils.Family {
+	walFamilies := make(map[string]*wputils.Family, len(families))
+	for name, f := range families {
+		walFamilies[name] = f.walFamily()
+	}
+	return walFamilies
+}
+
+// checkFamily returns the error of an operation on the family, it must be called while holding the lock
+func (db *DB) checkFamily(f *family) error {
+	if db.closed {
+		return ErrClosed
+	}
+	if f.dropped {
+		return ErrNoFamily
+	}
+	return nil
+}
+
+// walFamily returns the memtable manager of the family for restoring and writing the shared WAL
+func (f *family) walFamily() *wputils.Family {
+	return &wputils.Family{Directory: f.directory, Manager: f.memMan, CreatedSeq: f.createdSeq}
+}
+
+// get reads the key from the family
+func (db *DB) get(f *family, key string) ([]byte, bool, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return nil, false, err
+	}
+
+	rec, err := db.readPath(f, key)
+	if err != nil {
+		return nil, false, err
+	}
+	if rec == nil {
+		return nil, false, nil
+	}
+
+	return rec.GetValue(), true, nil
+}
+
+// multiGet reads the keys from the family
+func (db *DB) multiGet(f *family, keys []string) ([][]byte, []bool, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return nil, nil, err
+	}
+
+	records, err := db.multiReadPath(f, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make([][]byte, len(keys))
+	found := make([]bool, len(keys))
+	for i, rec := range records {
+		if rec != nil {
+			values[i], found[i] = rec.GetValue(), true
+		}
+	}
+
+	return values, found, nil
+}
+
+// put stores the key-value pair in the family
+func (db *DB) put(f *family, key string, value []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return err
+	}
+
+	return db.writePath(f, key, value, false)
+}
+
+// putWithTTL stores the expiring key-value pair in the family
+func (db *DB) putWithTTL(f *family, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return err
+	}
+
+	return db.writeRecord(f, record.MakeExpiringRecord(key, value, db.nextSeq(), time.Now().Add(ttl)))
+}
+
+// delete deletes the key from the family and reports whether it was present
+func (db *DB) delete(f *family, key string) (bool, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return false, err
+	}
+
+	rec, err := db.readPath(f, key)
+	if err != nil {
+		return false, err
+	}
+	if rec == nil {
+		return false, nil
+	}
+
+	return true, db.writePath(f, rec.GetKey(), rec.GetValue(), true)
+}
+
+// compareAndSwap stores the value in the family if the key holds the expected one
+func (db *DB) compareAndSwap(f *family, key string, expected, value []byte) (bool, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return false, err
+	}
+
+	rec, err := db.readPath(f, key)
+	if err != nil {
+		return false, err
+	}
+	if rec == nil || !bytes.Equal(rec.GetValue(), expected) {
+		return false, nil
+	}
+
+	return true, db.writePath(f, key, value, false)
+}
+
+// putIfAbsent stores the key-value pair in the family if the key is absent
+func (db *DB) putIfAbsent(f *family, key string, value []byte) (bool, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return false, err
+	}
+
+	rec, err := db.readPath(f, key)
+	if err != nil {
+		return false, err
+	}
+	if rec != nil {
+		return false, nil
+	}
+
+	return true, db.writePath(f, key, value, false)
+}
+
+// deleteIfEquals deletes the key from the family if it holds the expected value
+func (db *DB) deleteIfEquals(f *family, key string, expected []byte) (bool, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return false, err
+	}
+
+	rec, err := db.readPath(f, key)
+	if err != nil {
+		return false, err
+	}
+	if rec == nil || !bytes.Equal(rec.GetValue(), expected) {
+		return false, nil
+	}
+
+	return true, db.writePath(f, rec.GetKey(), rec.GetValue(), true)
+}
+
+// merge stores the merge operand of the key in the family
+func (db *DB) merge(f *family, key string, operand []byte) error {
+	if f.mergeOperator.For(key) == nil {
+		return ErrNoMerge
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return err
+	}
+
+	return db.writeRecord(f, record.MakeMergeRecord(key, operand, db.nextSeq()))
+}
+
+// deleteRange writes a range tombstone over [start, end] to the family
+func (db *DB) deleteRange(f *family, start, end string) error {
+	if start > end {
+		return ErrInvalidRange
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return err
+	}
+
+	return db.writeRecord(f, record.MakeRangeTombstone(start, end, db.nextSeq()))
+}
+
+// prefixScan returns a page of the keys of the family starting with the prefix
+func (db *DB) prefixScan(f *family, prefix string, pageNumber, pageSize int) ([]*record.Record, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return nil, err
+	}
+
+	return scan.PrefixScan(prefix, pageNumber, pageSize, f.memMan, f.sst), nil
+}
+
+// rangeScan returns a page of the keys of the family within [minRange, maxRange]
+func (db *DB) rangeScan(f *family, minRange, maxRange string, pageNumber, pageSize int) ([]*record.Record, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return nil, err
+	}
+
+	return scan.RangeScan(minRange, maxRange, pageNumber, pageSize, f.memMan, f.sst), nil
+}
+
+// prefixScanAfter returns a page of the keys of the family starting with the prefix after the cursor, and the cursor of the next page
+func (db *DB) prefixScanAfter(f *family, prefix string, after *string, pageSize int) ([]*record.Record, *string, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return nil, nil, err
+	}
+
+	records, next := scan.PrefixScanAfter(prefix, after, pageSize, f.memMan, f.sst)
+	return records, next, nil
+}
+
+// rangeScanAfter returns a page of the keys of the family within [minRange, maxRange] after the cursor, and the cursor of the next page
+func (db *DB) rangeScanAfter(f *family, minRange, maxRange string, after *string, pageSize int) ([]*record.Record, *string, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return nil, nil, err
+	}
+
+	records, next := scan.RangeScanAfter(minRange, maxRange, after, pageSize, f.memMan, f.sst)
+	return records, next, nil
+}
+
+// filterScan returns a page of the keys of the family the filter keeps
+func (db *DB) filterScan(f *family, filter *scan.Filter, pageNumber, pageSize int) ([]*record.Record, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return nil, err
+	}
+
+	return scan.FilterScan(filter, pageNumber, pageSize, f.memMan, f.sst), nil
+}
+
+// filterScanAfter returns a page of the keys of the family the filter keeps after the cursor, and the cursor of the next page
+func (db *DB) filterScanAfter(f *family, filter *scan.Filter, after *string, pageSize int) ([]*record.Record, *string, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return nil, nil, err
+	}
+
+	records, next := scan.FilterScanAfter(filter, after, pageSize, f.memMan, f.sst)
+	return records, next, nil
+}
+
+// prefixStats counts the keys of the family starting with the prefix and their sizes, estimating them if approximate is set
+func (db *DB) prefixStats(f *family, prefix string, approximate bool) (scan.Stats, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return scan.Stats{}, err
+	}
+
+	if approximate {
+		return scan.EstimatePrefixStats(prefix, f.memMan, f.sst)
+	}
+	return scan.PrefixStats(prefix, f.memMan, f.sst), nil
+}
+
+// rangeStats counts the keys of the family within [minRange, maxRange] and their sizes, estimating them if approximate is set
+func (db *DB) rangeStats(f *family, minRange, maxRange string, approximate bool) (scan.Stats, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return scan.Stats{}, err
+	}
+
+	if approximate {
+		return scan.EstimateRangeStats(minRange, maxRange, f.memMan, f.sst)
+	}
+	return scan.RangeStats(minRange, maxRange, f.memMan, f.sst), nil
+}
+
+// prefixBounds returns the first and the last live key of the family starting with the prefix
+func (db *DB) prefixBounds(f *family, prefix string) (string, string, bool, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return "", "", false, err
+	}
+
+	first, last, found := scan.PrefixBounds(prefix, f.memMan, f.sst)
+	return first, last, found, nil
+}
+
+// rangeBounds returns the first and the last live key of the family within [minRange, maxRange]
+func (db *DB) rangeBounds(f *family, minRange, maxRange string) (string, string, bool, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return "", "", false, err
+	}
+
+	first, last, found := scan.RangeBounds(minRange, maxRange, f.memMan, f.sst)
+	return first, last, found, nil
+}
+
+// prefixIterator returns an iterator over the keys of the family starting with the prefix, reading from its own snapshot
+func (db *DB) prefixIterator(f *family, prefix string) (*scan.PrefixIterator, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return nil, err
+	}
+
+	snapshot := db.newSnapshot(f)
+	release := func() { _ = snapshot.Release() }
+
+	return scan.MakePrefixIterateOver(snapshot.prefixIterators(prefix), snapshot.rangeTombstones, f.mergeOperator, release), nil
+}
+
+// rangeIterator returns an iterator over the keys of the family within [minRange, maxRange], reading from its own snapshot
+func (db *DB) rangeIterator(f *family, minRange, maxRange string) (*scan.RangeIterator, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if err := db.checkFamily(f); err != nil {
+		return nil, err
+	}
+
+	snapshot := db.newSnapshot(f)
+	release := func() { _ = snapshot.Release() }
+
+	return scan.MakeRangeIterateOver(snapshot.rangeIterators(minRange, maxRange), snapshot.rangeTombstones, f.mergeOperator, release), nil
+}
+
+/*
+migrateSystemKeys moves the structures, fingerprints and token logs that were stored as "bf name",
+"fingerprint name", "tokenLog time"... keys of the default family, before the families were introduced,
+into their own families. It runs once, when the families directory is created.
+*/
+func (db *DB) migrateSystemKeys() error {
+	moves := []struct {
+		prefix string
+		target *family
+		trim   bool // whether the prefix is removed from the key in the target family
+	}{
+		{structKey(STRUCT_BF, ""), db.families[FAMILY_SKETCH], false},
+		{structKey(STRUCT_CMS, ""), db.families[FAMILY_SKETCH], false},
+		{structKey(STRUCT_HLL, ""), db.families[FAMILY_SKETCH], false},
+		{STRUCT_FINGERPRINT + " ", db.families[FAMILY_FINGERPRINT], true},
+		{TOKEN_LOG + " ", db.families[FAMILY_SYSTEM], false},
+	}
+
+	for _, move := range moves {
+		iter, err := db.PrefixIterator(move.prefix)
+		if err != nil {
+			return err
+		}
+
+		var records []*record.Record
+		for rec := iter.Next(); rec != nil; rec = iter.Next() {
+			records = append(records, rec)
+		}
+		iter.Stop()
+
+		for _, rec := range records {
+			key := rec.GetKey()
+			if move.trim {
+				key = strings.TrimPrefix(key, move.prefix)
+			}
+
+			err = db.put(move.target, key, rec.GetValue())
+			if err != nil {
+				return err
+			}
+			_, err = db.delete(db.defaultFamily, rec.GetKey())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -1,77 +1,84 @@
 package Engine
 
 import (
-	"fmt"
-	"key-value-engine/structs/scan"
-	"regexp"
-	"strings"
+	"key-value-engine/structs/record"
 )
 
-func (e *Engine) prefixIterator(call string) {
-	parts := strings.Split(call, " ")
-	prefix := parts[1]
-
-	iter := scan.MakePrefixIterate(prefix, e.memMan, e.sst)
-
-	nextRegex := regexp.MustCompile(NEXTREGEX)
-	stopRegex := regexp.MustCompile(STOPREGEX)
-	systemNameRegex := regexp.MustCompile(SYSTEMKEY)
-
-	for {
-		input := getInput()
-
-		if stopRegex.MatchString(input) {
-			return
-		} else if nextRegex.MatchString(input) {
-			next := iter.Next()
-
-			for next != nil && systemNameRegex.MatchString(next.GetKey()) {
-				next = iter.Next()
-			}
-
-			if next != nil {
-				fmt.Printf("key: %s\tvalue: %s\n", next.GetKey(), next.GetValue())
-			} else {
-				fmt.Println("END")
-				return
-			}
-		} else {
-			showValidOptions()
-			pauseTerminal()
-		}
+// recordIterator is the iterator moved in iterator mode
+type recordIterator interface {
+	Next() *record.Record
+	Prev() *record.Record
+	Seek(key string)
+	SeekToLast()
+	Stop()
+}
+
+func (e *Engine) prefixIterator(tokens [][]byte) (reply, error) {
+	prefix := string(tokens[1])
+
+	iter, err := e.db.PrefixIterator(prefix)
+	if err != nil {
+		return reply{}, err
+	}
+
+	e.iterator = iter
+	return reply{}, nil
+}
+
+func (e *Engine) rangeIterator(tokens [][]byte) (reply, error) {
+	rangeMin := string(tokens[1])
+	rangeMax := string(tokens[2])
+
+	iter, err := e.db.RangeIterator(rangeMin, rangeMax)
+	if err != nil {
+		return reply{}, err
+	}
+
+	e.iterator = iter
+	return reply{}, nil
+}
+
+// iteratorNext returns the next record of the open iterator, the iterator mode ends once it is exhausted
+func (e *Engine) iteratorNext() (reply, error) {
+	next := e.iterator.Next()
+	if next == nil {
+		e.closeIterator()
+		return reply{end: true}, nil
 	}
+
+	return reply{value: next}, nil
+}
+
+// iteratorPrev returns the previous record of the open iterator, the iterator mode ends once there are no earlier records
+func (e *Engine) iteratorPrev() (reply, error) {
+	prev := e.iterator.Prev()
+	if prev == nil {
+		e.closeIterator()
+		return reply{end: true}, nil
+	}
+
+	return reply{value: prev}, nil
+}
+
+func (e *Engine) iteratorSeek(tokens [][]byte) (reply, error) {
+	e.iterator.Seek(string(tokens[1]))
+	return reply{}, nil
+}
+
+func (e *Engine) iteratorLast() (reply, error) {
+	e.iterator.SeekToLast()
+	return reply{}, nil
+}
+
+func (e *Engine) iteratorStop() (reply, error) {
+	e.closeIterator()
+	return reply{}, nil
 }
 
-func (e *Engine) rangeIterator(call string) {
-	parts := strings.Split(call, " ")
-	ranges := strings.Split(parts[1], "-")
-
-	iter := scan.MakeRangeIterate(ranges[0], ranges[1], e.memMan, e.sst)
-
-	nextRegex := regexp.MustCompile(NEXTREGEX)
-	stopRegex := regexp.MustCompile(STOPREGEX)
-	systemNameRegex := regexp.MustCompile(SYSTEMKEY)
-	for {
-		input := getInput()
-		if stopRegex.MatchString(input) {
-			return
-		} else if nextRegex.MatchString(input) {
-			next := iter.Next()
-
-			for next != nil && systemNameRegex.MatchString(next.GetKey()) {
-				next = iter.Next()
-			}
-
-			if next != nil {
-				fmt.Printf("key: %s\t value:%s\n", next.GetKey(), next.GetValue())
-			} else {
-				fmt.Println("END")
-				return
-			}
-
-		} else {
-			showValidOptions()
-			pauseTerminal()
-		}
+// closeIterator stops the open iterator, if any, and leaves the iterator mode
+func (e *Engine) closeIterator() {
+	if e.iterator != nil {
+		e.iterator.Stop()
+		e.iterator = nil
 	}
 }
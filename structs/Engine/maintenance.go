@@ -0,0 +1,64 @@
+package Engine
+
+import (
+	"key-value-engine/structs/wputils"
+	"sort"
+)
+
+/*
+Compact flushes the memtables of every column family and merges the SSTables of each family into a single table,
+dropping deleted, expired and overwritten versions. Writes wait until it is done.
+
+Returns:
+  - error: Error, if any, during flushing or compaction.
+*/
+func (db *DB) Compact() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	err := wputils.FlushAll(db.walFamilies, db.commitLog)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range db.families {
+		err = f.sst.CompactAll()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Verify checks the SSTables of every column family against their merkle trees.
+
+Returns:
+  - []string: Directories of the tables whose data is corrupted, sorted.
+  - error: Error, if any, during reading the tables.
+*/
+func (db *DB) Verify() ([]string, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	var corrupted []string
+	for _, f := range db.families {
+		tables, err := f.sst.Verify()
+		if err != nil {
+			return nil, err
+		}
+		corrupted = append(corrupted, tables...)
+	}
+	sort.Strings(corrupted)
+
+	return corrupted, nil
+}
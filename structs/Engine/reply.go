@@ -0,0 +1,280 @@
+package Engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"key-value-engine/structs/hll"
+	"key-value-engine/structs/record"
+	"key-value-engine/structs/scan"
+	"key-value-engine/structs/tokenBucket"
+	"key-value-engine/structs/wal"
+	"time"
+)
+
+const (
+	OUTPUT_TEXT = "text"
+	OUTPUT_JSON = "json"
+
+	STATUS_OK        = "ok"
+	STATUS_NOT_FOUND = "not_found"
+	STATUS_END       = "end"
+	STATUS_ERROR     = "error"
+
+	CODE_INVALID_COMMAND  = "invalid_command"
+	CODE_INVALID_ARGUMENT = "invalid_argument"
+	CODE_RATE_LIMITED     = "rate_limited"
+	CODE_TOO_LARGE        = "too_large"
+	CODE_CORRUPTED        = "corrupted"
+	CODE_CLOSED           = "closed"
+	CODE_INTERNAL         = "internal"
+)
+
+var errInvalidOutput = errors.New("output must be text or json")
+
+// errorCodes are the codes of the known errors in the json output, any other error is CODE_INTERNAL
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{errInvalidCommand, CODE_INVALID_COMMAND},
+	{errUnterminatedQuote, CODE_INVALID_COMMAND},
+	{errInvalidEscape, CODE_INVALID_COMMAND},
+	{errInvalidHex, CODE_INVALID_COMMAND},
+	{errInvalidBase64, CODE_INVALID_COMMAND},
+	{errInvalidParam, CODE_INVALID_ARGUMENT},
+	{errParamOutOfRange, CODE_INVALID_ARGUMENT},
+	{errMissingParams, CODE_INVALID_ARGUMENT},
+	{errBloomFilterParams, CODE_INVALID_ARGUMENT},
+	{errCMSParams, CODE_INVALID_ARGUMENT},
+	{errUnknownStructure, CODE_INVALID_ARGUMENT},
+	{hll.ErrPrecision, CODE_INVALID_ARGUMENT},
+	{ErrInvalidTTL, CODE_INVALID_ARGUMENT},
+	{ErrInvalidRange, CODE_INVALID_ARGUMENT},
+	{errInvalidCursor, CODE_INVALID_ARGUMENT},
+	{scan.ErrInvalidPattern, CODE_INVALID_ARGUMENT},
+	{tokenBucket.ErrRateLimited, CODE_RATE_LIMITED},
+	{wal.ErrRecordTooLarge, CODE_TOO_LARGE},
+	{ErrCorrupted, CODE_CORRUPTED},
+	{wal.ErrChecksum, CODE_CORRUPTED},
+	{ErrClosed, CODE_CLOSED},
+}
+
+/*
+reply is the result of a command.
+The value is []byte, bool, a number, keyBounds, *record.Record or []*record.Record, nil if the command has no result.
+*/
+type reply struct {
+	value   interface{}
+	missing bool   // the key, structure or fingerprint does not exist
+	end     bool   // the iterator has no more records
+	cursor  string // cursor of the next page of a scan, empty on the last page
+}
+
+/*
+jsonReply is the result of a command in the json output.
+Status is ok, not_found, end (an exhausted iterator) or error, the time is measured from reading the command to its result.
+Cursor is set for scans that have a next page.
+*/
+type jsonReply struct {
+	Command string      `json:"command"`
+	Status  string      `json:"status"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"`
+	Cursor  string      `json:"cursor,omitempty"`
+	TimeUs  int64       `json:"time_us"`
+}
+
+// jsonRecord is a key-value pair in the json output, binary keys and values are written as hex: literals
+type jsonRecord struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// jsonBounds is the result of bounds in the json output
+type jsonBounds struct {
+	First string `json:"first"`
+	Last  string `json:"last"`
+}
+
+/*
+SetOutput chooses how the results of commands are printed, text (the default) or json.
+In the json output every command prints exactly one object on its own line, also in the interactive mode.
+*/
+func (e *Engine) SetOutput(output string) error {
+	if output != OUTPUT_TEXT && output != OUTPUT_JSON {
+		return errInvalidOutput
+	}
+	e.output = output
+	return nil
+}
+
+// interactive reports whether the output is meant for a person, so prompts, help and error boxes are shown
+func (e *Engine) interactive() bool {
+	return !e.batch && e.output == OUTPUT_TEXT
+}
+
+/*
+respond prints the result of the command in the output of the engine.
+
+Parameters:
+  - command: Name of the command, the structure commands are named with the structure, like "bf check".
+  - rep: Result of the command, ignored if err is not nil.
+  - err: Error of the command.
+  - elapsed: Time the command took.
+*/
+func (e *Engine) respond(command string, rep reply, err error, elapsed time.Duration) {
+	if e.output == OUTPUT_JSON {
+		printJSON(makeJSONReply(command, rep, err, elapsed))
+		return
+	}
+
+	if err != nil {
+		if e.batch {
+			fmt.Println("ERR", err)
+		} else {
+			displayError(err)
+		}
+		return
+	}
+	if e.batch {
+		printReply(rep)
+	} else {
+		showReply(rep)
+	}
+}
+
+// showReply prints the result of a command in the interactive mode, nothing is printed for a missing key
+func showReply(rep reply) {
+	if rep.end {
+		fmt.Println("END")
+		return
+	}
+	if rep.missing || rep.value == nil {
+		return
+	}
+
+	switch value := rep.value.(type) {
+	case []byte:
+		fmt.Println(formatBytes(value))
+	case keyBounds:
+		fmt.Printf("first: %s\tlast: %s\n", formatBytes([]byte(value.first)), formatBytes([]byte(value.last)))
+	case *record.Record:
+		fmt.Printf("key: %s\tvalue: %s\n", formatBytes([]byte(value.GetKey())), formatBytes(value.GetValue()))
+	case []*record.Record:
+		for i, rec := range value {
+			fmt.Printf("%d. key: %s\tvalue: %s\n", i+1, formatBytes([]byte(rec.GetKey())), formatBytes(rec.GetValue()))
+		}
+		if rep.cursor != "" {
+			fmt.Println("next page:", rep.cursor)
+		}
+	default:
+		fmt.Println(value)
+	}
+}
+
+/*
+printReply prints the result of a command in the text output of the batch mode:
+  - OK for a command without a result,
+  - OK {value} for a value, a boolean or a number,
+  - NIL for a missing key, structure or fingerprint,
+  - OK {key} {value} for the record returned by next or prev of an iterator, END once there are no more records,
+  - OK {first} {last} for the first and the last key of bounds,
+  - OK {count} followed by one "{key} {value}" line per record for scans,
+    OK {count} {cursor} if the scan has a next page.
+
+Keys and values are written as tokens, so they are read back by the tokenizer unchanged.
+*/
+func printReply(rep reply) {
+	if rep.end {
+		fmt.Println("END")
+		return
+	}
+	if rep.missing {
+		fmt.Println("NIL")
+		return
+	}
+
+	switch value := rep.value.(type) {
+	case nil:
+		fmt.Println("OK")
+	case []byte:
+		fmt.Println("OK", formatToken(value))
+	case keyBounds:
+		fmt.Println("OK", formatToken([]byte(value.first)), formatToken([]byte(value.last)))
+	case *record.Record:
+		fmt.Println("OK", formatToken([]byte(value.GetKey())), formatToken(value.GetValue()))
+	case []*record.Record:
+		if rep.cursor != "" {
+			fmt.Println("OK", len(value), rep.cursor)
+		} else {
+			fmt.Println("OK", len(value))
+		}
+		for _, rec := range value {
+			fmt.Println(formatToken([]byte(rec.GetKey())), formatToken(rec.GetValue()))
+		}
+	default:
+		fmt.Println("OK", value)
+	}
+}
+
+func makeJSONReply(command string, rep reply, err error, elapsed time.Duration) jsonReply {
+	result := jsonReply{Command: command, TimeUs: elapsed.Microseconds()}
+
+	if err != nil {
+		result.Status = STATUS_ERROR
+		result.Error = err.Error()
+		result.Code = ErrorCode(err)
+	} else if rep.end {
+		result.Status = STATUS_END
+	} else if rep.missing {
+		result.Status = STATUS_NOT_FOUND
+	} else {
+		result.Status = STATUS_OK
+		result.Result = jsonValue(rep.value)
+		result.Cursor = rep.cursor
+	}
+	return result
+}
+
+/*
+ErrorCode returns the code of the error in the json output,
+so clients do not depend on the wording of error messages.
+*/
+func ErrorCode(err error) string {
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			return known.code
+		}
+	}
+	return CODE_INTERNAL
+}
+
+// jsonValue converts the value of a reply to the value written in the json output
+func jsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case []byte:
+		return formatBytes(value)
+	case keyBounds:
+		return jsonBounds{First: formatBytes([]byte(value.first)), Last: formatBytes([]byte(value.last))}
+	case *record.Record:
+		return jsonRecord{Key: formatBytes([]byte(value.GetKey())), Value: formatBytes(value.GetValue())}
+	case []*record.Record:
+		records := make([]jsonRecord, len(value))
+		for i, rec := range value {
+			records[i] = jsonValue(rec).(jsonRecord)
+		}
+		return records
+	}
+	return value
+}
+
+func printJSON(value interface{}) {
+	marshalled, err := json.Marshal(value)
+	if err != nil {
+		fmt.Printf("{\"status\":\"error\",\"error\":\"error converting result to json\",\"code\":%q,\"time_us\":0}\n", CODE_INTERNAL)
+		return
+	}
+	fmt.Println(string(marshalled))
+}
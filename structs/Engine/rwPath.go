@@ -1,70 +1,108 @@
 package Engine
 
 import (
-	"errors"
+	"key-value-engine/structs/mergeOperator"
 	"key-value-engine/structs/record"
 	"key-value-engine/structs/wputils"
 )
 
-func (e *Engine) writePath(key string, value []byte, deleted bool) error {
-	rec := record.MakeRecord(key, value, deleted)
+func (db *DB) writePath(f *family, key string, value []byte, deleted bool) error {
+	return db.writeRecord(f, record.MakeRecord(key, value, deleted, db.nextSeq()))
+}
 
-	newRestoreOffset, err := wputils.AddRecord(e.memMan, e.commitLog, e.walRestoreOffset, rec)
+func (db *DB) writeRecord(f *family, rec *record.Record) error {
+	newRestoreOffset, err := wputils.AddRecord(db.walFamilies, db.commitLog, db.walRestoreOffset, f.walRecord(rec))
 	if err != nil {
 		return err
 	}
 
-	e.walRestoreOffset = newRestoreOffset
+	db.walRestoreOffset = newRestoreOffset
 
-	e.lruCache.Put(rec)
+	f.cacheRecord(rec)
 
 	return nil
 }
 
-func (e *Engine) readPath(key string) (*record.Record, error) {
-	fnd, rec := e.memMan.FindInMem(key)
+// walRecord returns the record as it is written to the shared WAL, records of other families than the default are wrapped
+func (f *family) walRecord(rec *record.Record) *record.Record {
+	if f.name == FAMILY_DEFAULT {
+		return rec
+	}
+	return record.MakeFamilyRecord(f.name, rec)
+}
+
+// cacheRecord keeps the cache of the family in line with a written record
+func (f *family) cacheRecord(rec *record.Record) {
+	if rec.IsRangeTombstone() {
+		f.lruCache.RemoveRange(rec.GetKey(), rec.GetRangeEnd())
+		return
+	}
+	f.lruCache.Put(rec)
+}
+
+// nextSeq returns the sequence number of the next record, it must be called under the write lock
+func (db *DB) nextSeq() uint64 {
+	db.seq++
+	return db.seq
+}
+
+func (db *DB) readPath(f *family, key string) (*record.Record, error) {
+	fnd, rec := f.memMan.FindInMem(key)
 	if fnd {
-		if rec.IsTombstone() {
+		if rec.IsMerge() {
+			var err error
+			rec, err = db.mergedRecord(f, key)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !rec.IsLive() {
 			return nil, nil
 		}
 
 		crc := record.CrcHash(rec.GetValue())
 
 		if crc != rec.GetCrc() {
-			return nil, errors.New("crc error")
+			return nil, ErrCorrupted
 		}
 
 		return rec, nil
 	}
 
-	rec, _ = e.lruCache.Get(key)
+	rec, _ = f.lruCache.Get(key)
 	if rec != nil {
-		if rec.IsTombstone() {
+		if !rec.IsLive() {
 			return nil, nil
 		}
 
 		crc := record.CrcHash(rec.GetValue())
 
 		if crc != rec.GetCrc() {
-			return nil, errors.New("crc error")
+			return nil, ErrCorrupted
 		}
 
 		return rec, nil
 	}
 
-	rec, err := e.sst.Get(key)
+	rec, err := f.sst.Get(key)
 	if err != nil {
 		return nil, err
 	}
+	if rec != nil && rec.IsMerge() {
+		rec, err = db.mergedRecord(f, key)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if rec != nil {
-		if rec.IsTombstone() {
+		if !rec.IsLive() {
 			return nil, nil
 		}
 
 		crc := record.CrcHash(rec.GetValue())
 
 		if crc != rec.GetCrc() {
-			return nil, errors.New("crc error")
+			return nil, ErrCorrupted
 		}
 
 		return rec, nil
@@ -72,3 +110,82 @@ func (e *Engine) readPath(key string) (*record.Record, error) {
 
 	return nil, nil
 }
+
+/*
+multiReadPath reads the keys like readPath, the keys missing from the memtables and the cache
+are looked up in the SSTables together, so every table is opened once.
+
+Returns:
+  - []*record.Record: Live record of each key in the order of the keys, nil for a missing or deleted key.
+  - error: Error, if any, during reading.
+*/
+func (db *DB) multiReadPath(f *family, keys []string) ([]*record.Record, error) {
+	records := make([]*record.Record, len(keys))
+
+	var sstKeys []string
+	var sstPositions []int
+	for i, key := range keys {
+		fnd, rec := f.memMan.FindInMem(key)
+		if !fnd {
+			rec, _ = f.lruCache.Get(key)
+		}
+		if rec == nil {
+			sstKeys = append(sstKeys, key)
+			sstPositions = append(sstPositions, i)
+			continue
+		}
+		records[i] = rec
+	}
+
+	if len(sstKeys) > 0 {
+		sstRecords, err := f.sst.MultiGet(sstKeys)
+		if err != nil {
+			return nil, err
+		}
+		for j, rec := range sstRecords {
+			records[sstPositions[j]] = rec
+		}
+	}
+
+	for i, rec := range records {
+		if rec == nil {
+			continue
+		}
+		if rec.IsMerge() {
+			var err error
+			rec, err = db.mergedRecord(f, keys[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !rec.IsLive() {
+			records[i] = nil
+			continue
+		}
+
+		if record.CrcHash(rec.GetValue()) != rec.GetCrc() {
+			return nil, ErrCorrupted
+		}
+		records[i] = rec
+	}
+
+	return records, nil
+}
+
+// mergedRecord folds the merge records of the key with its older versions in the memtables and SSTables
+func (db *DB) mergedRecord(f *family, key string) (*record.Record, error) {
+	versions, rangeSeq := f.memMan.FindVersionsInMem(key)
+	if len(versions) == 0 || versions[len(versions)-1].IsMerge() {
+		sstVersions, err := f.sst.GetVersions(key)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, sstVersions...)
+
+		if seq := record.CoveringSeq(f.sst.GetSSTRangeTombstones(), key); seq > rangeSeq {
+			rangeSeq = seq
+		}
+	}
+
+	return mergeOperator.Fold(f.mergeOperator, key, versions, rangeSeq, true), nil
+}
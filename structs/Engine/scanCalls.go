@@ -1,51 +1,142 @@
 package Engine
 
 import (
-	"fmt"
+	"encoding/base64"
+	"errors"
+	"key-value-engine/structs/record"
 	"key-value-engine/structs/scan"
-	"regexp"
 	"strconv"
 	"strings"
 )
 
-func (e *Engine) prefixScan(call string) {
-	parts := strings.Split(call, " ")
-	prefix := parts[1]
-	pageNumSTR := parts[2]
-	pageSizeSTR := parts[3]
+var errInvalidCursor = errors.New("invalid cursor")
 
-	pageNum, _ := strconv.ParseInt(pageNumSTR, 10, 64)
-	pageSize, _ := strconv.ParseInt(pageSizeSTR, 10, 64)
+/*
+prefixScan runs prefixscan {prefix} {page|cursor} {page_size}.
+The first page and the pages read with a cursor return the cursor of the next page,
+the other page numbers are counted from the first key and return no cursor.
+*/
+func (e *Engine) prefixScan(tokens [][]byte) (reply, error) {
+	prefix := string(tokens[1])
+	pageSize, _ := strconv.ParseInt(string(tokens[3]), 10, 64)
 
-	systemNameRegex := regexp.MustCompile(SYSTEMKEY)
+	after, pageNum, err := scanStart(tokens[2])
+	if err != nil {
+		return reply{}, err
+	}
+	if after == nil && pageNum != 1 {
+		res, err := e.db.PrefixScan(prefix, int(pageNum), int(pageSize))
+		if err != nil {
+			return reply{}, err
+		}
+		return reply{value: res}, nil
+	}
 
-	res := scan.PrefixScan(prefix, int(pageNum), int(pageSize), e.memMan, e.sst)
+	res, next, err := e.db.PrefixScanAfter(prefix, after, int(pageSize))
+	if err != nil {
+		return reply{}, err
+	}
+	return scanReply(res, next), nil
+}
+
+/*
+rangeScan runs rangescan {rangeMin} {rangeMax} {page|cursor} {page_size},
+the cursor is returned the same way as in prefixScan.
+*/
+func (e *Engine) rangeScan(tokens [][]byte) (reply, error) {
+	rangeMin := string(tokens[1])
+	rangeMax := string(tokens[2])
+	pageSize, _ := strconv.ParseInt(string(tokens[4]), 10, 64)
 
-	for i, rec := range res {
-		if systemNameRegex.MatchString(rec.GetKey()) {
-			continue
+	after, pageNum, err := scanStart(tokens[3])
+	if err != nil {
+		return reply{}, err
+	}
+	if after == nil && pageNum != 1 {
+		res, err := e.db.RangeScan(rangeMin, rangeMax, int(pageNum), int(pageSize))
+		if err != nil {
+			return reply{}, err
 		}
-		fmt.Printf("%d. key: %s\tvalue: %s\n", i+1, rec.GetKey(), rec.GetValue())
+		return reply{value: res}, nil
 	}
+
+	res, next, err := e.db.RangeScanAfter(rangeMin, rangeMax, after, int(pageSize))
+	if err != nil {
+		return reply{}, err
+	}
+	return scanReply(res, next), nil
 }
 
-func (e *Engine) rangeScan(call string) {
-	parts := strings.Split(call, " ")
-	ranges := strings.Split(parts[1], "-")
-	pageNumSTR := parts[2]
-	pageSizeSTR := parts[3]
+/*
+filterScan runs scan match {glob} or scan regex {regex} followed by {page|cursor} {page_size},
+and optionally by contains {text} or json {field} {value}, the cursor is returned the same way as in prefixScan.
+*/
+func (e *Engine) filterScan(tokens [][]byte, makeFilter func(pattern string) (*scan.Filter, error)) (reply, error) {
+	filter, err := makeFilter(string(tokens[2]))
+	if err != nil {
+		return reply{}, err
+	}
+	if len(tokens) > 5 {
+		condition := tokens[5:]
+		if string(condition[0]) == VALUE_CONTAINS {
+			filter.SetValueContains(condition[1])
+		} else {
+			filter.SetValueField(string(condition[1]), string(condition[2]))
+		}
+	}
+	pageSize, _ := strconv.ParseInt(string(tokens[4]), 10, 64)
 
-	pageNum, _ := strconv.ParseInt(pageNumSTR, 10, 64)
-	pageSize, _ := strconv.ParseInt(pageSizeSTR, 10, 64)
+	after, pageNum, err := scanStart(tokens[3])
+	if err != nil {
+		return reply{}, err
+	}
+	if after == nil && pageNum != 1 {
+		res, err := e.db.FilterScan(filter, int(pageNum), int(pageSize))
+		if err != nil {
+			return reply{}, err
+		}
+		return reply{value: res}, nil
+	}
 
-	systemNameRegex := regexp.MustCompile(SYSTEMKEY)
+	res, next, err := e.db.FilterScanAfter(filter, after, int(pageSize))
+	if err != nil {
+		return reply{}, err
+	}
+	return scanReply(res, next), nil
+}
 
-	res := scan.RangeScan(ranges[0], ranges[1], int(pageNum), int(pageSize), e.memMan, e.sst)
+/*
+scanStart reads the page token of a scan, either a page number or a cursor returned by an earlier scan.
 
-	for i, rec := range res {
-		if systemNameRegex.MatchString(rec.GetKey()) {
-			continue
-		}
-		fmt.Printf("%d. key: %s\tvalue: %s\n", i+1, rec.GetKey(), rec.GetValue())
+Returns:
+  - *string: Key the page starts after, nil for a page number.
+  - int64: Page number, 0 for a cursor.
+  - error: errInvalidCursor if the cursor is malformed.
+*/
+func scanStart(token []byte) (*string, int64, error) {
+	if !isCursor(token) {
+		pageNum, _ := strconv.ParseInt(string(token), 10, 64)
+		return nil, pageNum, nil
+	}
+
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(string(token), CURSOR_PREFIX))
+	if err != nil {
+		return nil, 0, errInvalidCursor
+	}
+	after := string(key)
+	return &after, 0, nil
+}
+
+// isCursor reports whether the page token of a scan is a cursor
+func isCursor(token []byte) bool {
+	return strings.HasPrefix(string(token), CURSOR_PREFIX)
+}
+
+// scanReply returns the records of a scan with the cursor of the next page, the cursor is opaque to the user
+func scanReply(records []*record.Record, next *string) reply {
+	rep := reply{value: records}
+	if next != nil {
+		rep.cursor = CURSOR_PREFIX + base64.RawURLEncoding.EncodeToString([]byte(*next))
 	}
+	return rep
 }
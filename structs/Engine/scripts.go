@@ -14,7 +14,7 @@ func (e *Engine) PopulateScript(entries int, differentKeys int) {
 		k := i % differentKeys
 		key := keys[k]
 
-		e.put("put " + key + " " + key + key + key + key)
+		e.put([][]byte{[]byte("put"), []byte(key), []byte(key + key + key + key)})
 
 		//if i%5 == 0 && k%10 == 0 {
 		//	e.delete("delete " + key)
@@ -0,0 +1,187 @@
+package Engine
+
+import (
+	"errors"
+	"key-value-engine/structs/iterator"
+	"key-value-engine/structs/memtable"
+	"key-value-engine/structs/mergeOperator"
+	"key-value-engine/structs/record"
+	"key-value-engine/structs/scan"
+	"sort"
+	"sync"
+)
+
+var ErrSnapshotReleased = errors.New("snapshot is released")
+
+/*
+Snapshot is a consistent read view of the database at one sequence number.
+Writes made after the snapshot was taken are not visible through it.
+
+It keeps a copy of the memtables and pins the SSTables that existed when it was taken,
+so compaction keeps those tables on disk until the snapshot is released.
+Release must be called once the snapshot is no longer used, after its iterators are done.
+*/
+type Snapshot struct {
+	db              *DB
+	family          *family
+	seq             uint64
+	memory          []*record.Record
+	tables          []string
+	rangeTombstones []*record.Record
+	released        bool
+	lock            sync.Mutex
+}
+
+/*
+NewSnapshot pins the current state of the database.
+
+Returns:
+  - *Snapshot: Snapshot of the database, it must be released with Release.
+  - error: ErrClosed if the database is closed.
+*/
+func (db *DB) NewSnapshot() (*Snapshot, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	return db.newSnapshot(db.defaultFamily), nil
+}
+
+// newSnapshot pins the state of the family, it must be called while holding the lock
+func (db *DB) newSnapshot(f *family) *Snapshot {
+	tables := f.sst.Pin()
+
+	return &Snapshot{
+		db:              db,
+		family:          f,
+		seq:             db.seq,
+		memory:          f.memMan.Freeze(),
+		tables:          tables,
+		rangeTombstones: append(f.memMan.GetRangeTombstones(), f.sst.GetRangeTombstones(tables)...),
+	}
+}
+
+/*
+Seq returns the sequence number of the last write visible through the snapshot.
+*/
+func (s *Snapshot) Seq() uint64 {
+	return s.seq
+}
+
+/*
+Release unpins the tables of the snapshot so compaction can remove them.
+Releasing a snapshot more than once is not an error.
+*/
+func (s *Snapshot) Release() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.released {
+		return nil
+	}
+	s.released = true
+	s.memory = nil
+	s.rangeTombstones = nil
+
+	return s.family.sst.Unpin(s.tables)
+}
+
+// isReleased reports whether Release was called
+func (s *Snapshot) isReleased() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.released
+}
+
+/*
+GetAt retrieves the value the key had when the snapshot was taken.
+
+Returns:
+  - []byte: Value of the key.
+  - bool: Indicates whether the key was found.
+  - error: ErrSnapshotReleased if the snapshot is released, or an error during reading.
+*/
+func (db *DB) GetAt(snapshot *Snapshot, key string) ([]byte, bool, error) {
+	if snapshot.db != db {
+		return nil, false, errors.New("snapshot belongs to another database")
+	}
+	if snapshot.isReleased() {
+		return nil, false, ErrSnapshotReleased
+	}
+
+	rec := snapshot.find(key)
+	if rec == nil || rec.IsMerge() {
+		versions, err := snapshot.family.sst.GetVersionsFrom(key, snapshot.tables)
+		if err != nil {
+			return nil, false, err
+		}
+		if rec != nil {
+			versions = append([]*record.Record{rec}, versions...)
+		}
+		rec = mergeOperator.Fold(snapshot.family.mergeOperator, key, versions, record.CoveringSeq(snapshot.rangeTombstones, key), true)
+	}
+	if rec == nil || !rec.IsLive() || rec.CoveredBy(snapshot.rangeTombstones) {
+		return nil, false, nil
+	}
+
+	if record.CrcHash(rec.GetValue()) != rec.GetCrc() {
+		return nil, false, ErrCorrupted
+	}
+
+	return rec.GetValue(), true, nil
+}
+
+// find returns the version of the key in the memtable copy, or nil if the key was not in the memtables
+func (s *Snapshot) find(key string) *record.Record {
+	i := sort.Search(len(s.memory), func(i int) bool {
+		return s.memory[i].GetKey() >= key
+	})
+	if i < len(s.memory) && s.memory[i].GetKey() == key {
+		return s.memory[i]
+	}
+	return nil
+}
+
+/*
+PrefixIteratorAt returns an iterator over keys starting with the prefix, as they were when the snapshot was taken.
+The iterator must not be used after the snapshot is released.
+*/
+func (db *DB) PrefixIteratorAt(snapshot *Snapshot, prefix string) (*scan.PrefixIterator, error) {
+	if snapshot.db != db {
+		return nil, errors.New("snapshot belongs to another database")
+	}
+	if snapshot.isReleased() {
+		return nil, ErrSnapshotReleased
+	}
+
+	return scan.MakePrefixIterateOver(snapshot.prefixIterators(prefix), snapshot.rangeTombstones, snapshot.family.mergeOperator, nil), nil
+}
+
+/*
+RangeIteratorAt returns an iterator over keys within [minRange, maxRange], as they were when the snapshot was taken.
+The iterator must not be used after the snapshot is released.
+*/
+func (db *DB) RangeIteratorAt(snapshot *Snapshot, minRange, maxRange string) (*scan.RangeIterator, error) {
+	if snapshot.db != db {
+		return nil, errors.New("snapshot belongs to another database")
+	}
+	if snapshot.isReleased() {
+		return nil, ErrSnapshotReleased
+	}
+
+	return scan.MakeRangeIterateOver(snapshot.rangeIterators(minRange, maxRange), snapshot.rangeTombstones, snapshot.family.mergeOperator, nil), nil
+}
+
+func (s *Snapshot) prefixIterators(prefix string) []iterator.Iterator {
+	iterators := s.family.sst.GetPinnedPrefixIterators(s.tables, prefix)
+	return append(iterators, memtable.MakeSortedPrefixIterator(s.memory, prefix))
+}
+
+func (s *Snapshot) rangeIterators(minRange, maxRange string) []iterator.Iterator {
+	iterators := s.family.sst.GetPinnedRangeIterators(s.tables, minRange, maxRange)
+	return append(iterators, memtable.MakeSortedRangeIterator(s.memory, minRange, maxRange))
+}
@@ -0,0 +1,427 @@
+package Engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"key-value-engine/structs/bloomFilter"
+	"key-value-engine/structs/cms"
+	"key-value-engine/structs/hll"
+	"key-value-engine/structs/mergeOperator"
+	"key-value-engine/structs/simHash"
+)
+
+const (
+	STRUCT_BF          = "bf"
+	STRUCT_CMS         = "cms"
+	STRUCT_HLL         = "hll"
+	STRUCT_FINGERPRINT = "fingerprint"
+
+	// MAX_CMS_INCREMENT is the largest count CMSIncrBy adds to an item at once
+	MAX_CMS_INCREMENT = 1 << 32
+)
+
+var (
+	errBloomFilterParams = errors.New("invalid bloom filter parameters")
+	errCMSParams         = errors.New("invalid count-min sketch parameters")
+	errCMSIncrement      = errors.New("invalid count-min sketch increment")
+	errUnknownStructure  = errors.New("unknown structure")
+)
+
+// structKey returns the key under which the structure is stored in the sketch family
+func structKey(structure, name string) string {
+	return structure + " " + name
+}
+
+/*
+MakeBloomFilter stores a new, empty bloom filter under the name, replacing an existing one.
+
+Parameters:
+  - name: Name of the bloom filter.
+  - expectedEl: Number of elements the filter is expected to hold.
+  - precision: Accepted false positive probability, between 0 and 1.
+*/
+func (db *DB) MakeBloomFilter(name string, expectedEl uint64, precision float64) error {
+	if expectedEl == 0 || precision <= 0 || precision >= 1 {
+		return errBloomFilterParams
+	}
+
+	obj := bloomFilter.MakeBloomFilter(expectedEl, precision)
+
+	return db.put(db.families[FAMILY_SKETCH], structKey(STRUCT_BF, name), obj.BloomFilterToBytes())
+}
+
+/*
+MakeCMS stores a new, empty count-min sketch under the name, replacing an existing one.
+
+Parameters:
+  - name: Name of the count-min sketch.
+  - epsilon: Accuracy of the sketch, between 0 and 1.
+  - delta: Failure probability of the sketch, between 0 and 1.
+*/
+func (db *DB) MakeCMS(name string, epsilon, delta float64) error {
+	if epsilon <= 0 || epsilon >= 1 || delta <= 0 || delta >= 1 {
+		return errCMSParams
+	}
+
+	obj := cms.MakeCMS(epsilon, delta)
+
+	return db.put(db.families[FAMILY_SKETCH], structKey(STRUCT_CMS, name), obj.CMSToBytes())
+}
+
+/*
+MakeHLL stores a new, empty hyperloglog under the name, replacing an existing one.
+
+Parameters:
+  - name: Name of the hyperloglog.
+  - precision: Number of bits used for register indexing.
+*/
+func (db *DB) MakeHLL(name string, precision uint8) error {
+	obj, err := hll.MakeHLL(precision)
+	if err != nil {
+		return err
+	}
+
+	objBytes, err := obj.HLLToBytes()
+	if err != nil {
+		return err
+	}
+
+	return db.put(db.families[FAMILY_SKETCH], structKey(STRUCT_HLL, name), objBytes)
+}
+
+/*
+DestroyStruct deletes the structure (bf, cms, hll or fingerprint) stored under the name.
+*/
+func (db *DB) DestroyStruct(structure, name string) error {
+	f, key := db.families[FAMILY_SKETCH], structKey(structure, name)
+	if structure == STRUCT_FINGERPRINT {
+		f, key = db.families[FAMILY_FINGERPRINT], name
+	}
+	_, err := db.delete(f, key)
+	return err
+}
+
+/*
+AddToStruct adds the values to the bf, cms or hll stored under the name.
+Reading, changing and writing back the structure is done under the write lock,
+so concurrent additions are not lost.
+
+Returns:
+  - bool: Indicates whether the structure was found.
+  - error: Error, if any, during the update.
+*/
+func (db *DB) AddToStruct(structure, name string, values ...[]byte) (bool, error) {
+	return db.updateStruct(structure, name, nil, func(objBytes []byte) ([]byte, error) {
+		objBytes, _, err := addValues(structure, objBytes, values)
+		return objBytes, err
+	})
+}
+
+/*
+StructParams are the parameters a missing structure is created with by AddOrCreateStruct.
+Only the parameters of the created structure are used.
+*/
+type StructParams struct {
+	// Capacity and ErrorRate are the expected elements and the false positive probability of a bloom filter
+	Capacity  uint64
+	ErrorRate float64
+	// Precision is the number of bits a hyperloglog uses for register indexing
+	Precision uint8
+}
+
+/*
+AddOrCreateStruct adds the values to the bf or hll stored under the name, creating it with the parameters if it is missing.
+The creation and the addition are done in one step under the write lock,
+so a structure created by a concurrent call is never replaced.
+
+Returns:
+  - bool: Indicates whether the structure changed, that is it was created, a value was not yet in the bloom filter,
+    or the estimate of the hyperloglog changed.
+  - error: Error, if any, during the update.
+*/
+func (db *DB) AddOrCreateStruct(structure, name string, params StructParams, values ...[]byte) (bool, error) {
+	var create func() ([]byte, error)
+	switch structure {
+	case STRUCT_BF:
+		if params.Capacity == 0 || params.ErrorRate <= 0 || params.ErrorRate >= 1 {
+			return false, errBloomFilterParams
+		}
+		create = func() ([]byte, error) {
+			return bloomFilter.MakeBloomFilter(params.Capacity, params.ErrorRate).BloomFilterToBytes(), nil
+		}
+	case STRUCT_HLL:
+		create = func() ([]byte, error) {
+			obj, err := hll.MakeHLL(params.Precision)
+			if err != nil {
+				return nil, err
+			}
+			return obj.HLLToBytes()
+		}
+	default:
+		return false, errUnknownStructure
+	}
+
+	created := false
+	changed := false
+	_, err := db.updateStruct(structure, name, func() ([]byte, error) {
+		created = true
+		return create()
+	}, func(objBytes []byte) ([]byte, error) {
+		var err error
+		objBytes, changed, err = addValues(structure, objBytes, values)
+		return objBytes, err
+	})
+
+	return created || changed, err
+}
+
+/*
+CMSIncrBy adds each item to the count-min sketch stored under the name as many times as its count,
+the counters are raised by the count at once instead of adding the item count times.
+
+Parameters:
+  - name: Name of the count-min sketch.
+  - items: Items to count.
+  - counts: Count of each item, at most MAX_CMS_INCREMENT.
+
+Returns:
+  - bool: Indicates whether the count-min sketch was found.
+  - error: Error, if any, during the update.
+*/
+func (db *DB) CMSIncrBy(name string, items [][]byte, counts []uint64) (bool, error) {
+	if len(items) != len(counts) {
+		return false, errCMSIncrement
+	}
+	for _, count := range counts {
+		if count > MAX_CMS_INCREMENT {
+			return false, errCMSIncrement
+		}
+	}
+
+	return db.updateStruct(STRUCT_CMS, name, nil, func(objBytes []byte) ([]byte, error) {
+		obj, err := cms.BytesToCMS(objBytes)
+		if err != nil {
+			return nil, err
+		}
+		for i, item := range items {
+			obj.AddCount(item, counts[i])
+		}
+		return obj.CMSToBytes(), nil
+	})
+}
+
+/*
+updateStruct reads the structure stored under the name, changes it with update and writes it back under the write lock.
+A missing structure is made by create, or left missing if create is nil.
+
+Returns:
+  - bool: Indicates whether the structure was found or created.
+  - error: Error, if any, during the update.
+*/
+func (db *DB) updateStruct(structure, name string, create func() ([]byte, error), update func([]byte) ([]byte, error)) (bool, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.closed {
+		return false, ErrClosed
+	}
+
+	sketches := db.families[FAMILY_SKETCH]
+	key := structKey(structure, name)
+
+	objRec, err := db.readPath(sketches, key)
+	if err != nil {
+		return false, err
+	}
+
+	var objBytes []byte
+	if objRec != nil {
+		objBytes = objRec.GetValue()
+	} else if create == nil {
+		return false, nil
+	} else {
+		objBytes, err = create()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	objBytes, err = update(objBytes)
+	if err != nil {
+		return true, err
+	}
+
+	return true, db.writePath(sketches, key, objBytes, false)
+}
+
+/*
+addValues adds the values to the serialized bf, cms or hll.
+
+Returns:
+  - []byte: The serialized structure with the values.
+  - bool: Indicates whether a value was not yet in the bloom filter or the estimate of the hyperloglog changed,
+    it is always true for a count-min sketch.
+  - error: Error, if any, during the addition.
+*/
+func addValues(structure string, objBytes []byte, values [][]byte) ([]byte, bool, error) {
+	changed := false
+
+	if structure == STRUCT_BF {
+		obj, err := bloomFilter.BytesToBloomFilter(objBytes)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, value := range values {
+			if !obj.IsPresent(value) {
+				changed = true
+			}
+			obj.Add(value)
+		}
+		objBytes = obj.BloomFilterToBytes()
+	} else if structure == STRUCT_HLL {
+		obj, err := hll.BytesToHLL(objBytes)
+		if err != nil {
+			return nil, false, err
+		}
+		before := obj.Estimate()
+		for _, value := range values {
+			err = obj.Add(value)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		changed = obj.Estimate() != before
+		objBytes, err = obj.HLLToBytes()
+		if err != nil {
+			return nil, false, err
+		}
+	} else if structure == STRUCT_CMS {
+		obj, err := cms.BytesToCMS(objBytes)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, value := range values {
+			obj.Add(value)
+		}
+		changed = true
+		objBytes = obj.CMSToBytes()
+	} else {
+		return nil, false, errUnknownStructure
+	}
+
+	return objBytes, changed, nil
+}
+
+/*
+MergeIntoStruct adds the values to the bf, cms or hll stored under the name without reading it,
+the values are written as a merge operand and added to the structure when it is read or compacted.
+Values added to a missing structure are dropped.
+*/
+func (db *DB) MergeIntoStruct(structure, name string, values ...[]byte) error {
+	if structure != STRUCT_BF && structure != STRUCT_CMS && structure != STRUCT_HLL {
+		return errUnknownStructure
+	}
+
+	return db.merge(db.families[FAMILY_SKETCH], structKey(structure, name), mergeOperator.EncodeElements(values...))
+}
+
+/*
+BloomFilterCheck checks whether the value might be in the bloom filter.
+
+Returns:
+  - bool: Indicates whether the value might be present.
+  - bool: Indicates whether the bloom filter was found.
+  - error: Error, if any, during reading.
+*/
+func (db *DB) BloomFilterCheck(name string, value []byte) (bool, bool, error) {
+	objBytes, found, err := db.get(db.families[FAMILY_SKETCH], structKey(STRUCT_BF, name))
+	if err != nil || !found {
+		return false, found, err
+	}
+
+	obj, err := bloomFilter.BytesToBloomFilter(objBytes)
+	if err != nil {
+		return false, true, err
+	}
+
+	return obj.IsPresent(value), true, nil
+}
+
+/*
+CMSEstimate estimates how many times the value was added to the count-min sketch.
+
+Returns:
+  - uint64: Estimated count of the value.
+  - bool: Indicates whether the count-min sketch was found.
+  - error: Error, if any, during reading.
+*/
+func (db *DB) CMSEstimate(name string, value []byte) (uint64, bool, error) {
+	objBytes, found, err := db.get(db.families[FAMILY_SKETCH], structKey(STRUCT_CMS, name))
+	if err != nil || !found {
+		return 0, found, err
+	}
+
+	obj, err := cms.BytesToCMS(objBytes)
+	if err != nil {
+		return 0, true, err
+	}
+
+	return obj.Estimate(value), true, nil
+}
+
+/*
+HLLEstimate estimates the number of distinct values added to the hyperloglog.
+
+Returns:
+  - float64: Estimated cardinality.
+  - bool: Indicates whether the hyperloglog was found.
+  - error: Error, if any, during reading.
+*/
+func (db *DB) HLLEstimate(name string) (float64, bool, error) {
+	objBytes, found, err := db.get(db.families[FAMILY_SKETCH], structKey(STRUCT_HLL, name))
+	if err != nil || !found {
+		return 0, found, err
+	}
+
+	obj, err := hll.BytesToHLL(objBytes)
+	if err != nil {
+		return 0, true, err
+	}
+
+	return obj.Estimate(), true, nil
+}
+
+/*
+StoreFingerprint stores the simhash fingerprint of the text under the name.
+*/
+func (db *DB) StoreFingerprint(name string, text []byte) error {
+	fingerprint := simHash.SimHash(text)
+	fingerprintBytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(fingerprintBytes, uint64(fingerprint))
+
+	return db.put(db.families[FAMILY_FINGERPRINT], name, fingerprintBytes)
+}
+
+/*
+SimHash calculates the hamming distance between two stored fingerprints.
+
+Returns:
+  - uint: Hamming distance of the fingerprints.
+  - bool: Indicates whether both fingerprints were found.
+  - error: Error, if any, during reading.
+*/
+func (db *DB) SimHash(name1, name2 string) (uint, bool, error) {
+	value1, found, err := db.get(db.families[FAMILY_FINGERPRINT], name1)
+	if err != nil || !found {
+		return 0, false, err
+	}
+	value2, found, err := db.get(db.families[FAMILY_FINGERPRINT], name2)
+	if err != nil || !found {
+		return 0, false, err
+	}
+
+	fingerprint1 := binary.LittleEndian.Uint64(value1)
+	fingerprint2 := binary.LittleEndian.Uint64(value2)
+
+	return simHash.HemingDistance(uint(fingerprint1), uint(fingerprint2)), true, nil
+}
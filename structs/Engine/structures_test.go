@@ -0,0 +1,101 @@
+package Engine
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestAddOrCreateStructConcurrently checks that concurrent first additions to a missing structure all land in one structure
+func TestAddOrCreateStructConcurrently(t *testing.T) {
+	db := openTestDB(t, "btree")
+
+	var wg sync.WaitGroup
+	for w := 0; w < WRITERS; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			value := []byte(fmt.Sprint(w, ":element"))
+			if _, err := db.AddOrCreateStruct(STRUCT_BF, "bf", StructParams{Capacity: 100, ErrorRate: 0.01}, value); err != nil {
+				t.Error(err)
+			}
+			if _, err := db.AddOrCreateStruct(STRUCT_HLL, "hll", StructParams{Precision: 10}, value); err != nil {
+				t.Error(err)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for w := 0; w < WRITERS; w++ {
+		present, found, err := db.BloomFilterCheck("bf", []byte(fmt.Sprint(w, ":element")))
+		if err != nil || !found || !present {
+			t.Errorf("bloom filter lost %d:element: %v %v %v", w, present, found, err)
+		}
+	}
+	estimate, found, err := db.HLLEstimate("hll")
+	if err != nil || !found || estimate < WRITERS-0.5 || estimate > WRITERS+0.5 {
+		t.Errorf("hyperloglog: got %v %v %v, want %d elements", estimate, found, err, WRITERS)
+	}
+
+	changed, err := db.AddOrCreateStruct(STRUCT_BF, "bf", StructParams{Capacity: 100, ErrorRate: 0.01}, []byte("0:element"))
+	if err != nil || changed {
+		t.Errorf("adding a present element: got %v %v, want false", changed, err)
+	}
+}
+
+func TestCMSIncrBy(t *testing.T) {
+	db := openTestDB(t, "btree")
+
+	found, err := db.CMSIncrBy("missing", [][]byte{[]byte("x")}, []uint64{1})
+	if err != nil || found {
+		t.Errorf("missing sketch: got %v %v", found, err)
+	}
+
+	if err := db.MakeCMS("cms", 0.01, 0.01); err != nil {
+		t.Fatal(err)
+	}
+	found, err = db.CMSIncrBy("cms", [][]byte{[]byte("x"), []byte("y")}, []uint64{MAX_CMS_INCREMENT, 3})
+	if err != nil || !found {
+		t.Fatalf("got %v %v", found, err)
+	}
+	estimate, _, err := db.CMSEstimate("cms", []byte("x"))
+	if err != nil || estimate < MAX_CMS_INCREMENT {
+		t.Errorf("estimate of x: got %d %v, want at least %d", estimate, err, uint64(MAX_CMS_INCREMENT))
+	}
+
+	if _, err = db.CMSIncrBy("cms", [][]byte{[]byte("x")}, []uint64{MAX_CMS_INCREMENT + 1}); err == nil {
+		t.Error("count above MAX_CMS_INCREMENT was accepted")
+	}
+}
+
+// TestDeleteIfExistsConcurrently checks that of concurrent deletes of a key exactly one reports it
+func TestDeleteIfExistsConcurrently(t *testing.T) {
+	db := openTestDB(t, "btree")
+	if err := db.Put("key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	deleted := 0
+	for w := 0; w < WRITERS; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found, err := db.DeleteIfExists("key")
+			if err != nil {
+				t.Error(err)
+			}
+			if found {
+				mu.Lock()
+				deleted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if deleted != 1 {
+		t.Errorf("got %d deletes, want 1", deleted)
+	}
+}
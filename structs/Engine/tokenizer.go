@@ -0,0 +1,231 @@
+package Engine
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	HEX_PREFIX    = "hex:"
+	BASE64_PREFIX = "b64:"
+)
+
+var (
+	errUnterminatedQuote = errors.New("unterminated quoted string")
+	errInvalidEscape     = errors.New("invalid escape sequence")
+	errInvalidHex        = errors.New("invalid hex literal")
+	errInvalidBase64     = errors.New("invalid base64 literal")
+)
+
+/*
+tokenize splits a command line into tokens separated by unquoted whitespace.
+
+  - "double quoted" parts keep their whitespace and support the escapes \\ \" \' \n \r \t \0 and \xHH
+  - 'single quoted' parts are taken literally
+  - outside quotes the same escapes are supported, and "\ " keeps a space inside the token
+  - a token starting with hex: or b64: is decoded from hex or standard base64
+
+Quoted and unquoted parts next to each other form one token, so any byte string can be written,
+"hex:..." in quotes is a plain string.
+*/
+func tokenize(input string) ([][]byte, error) {
+	var tokens [][]byte
+	i := 0
+	for {
+		for i < len(input) && isSpace(input[i]) {
+			i++
+		}
+		if i == len(input) {
+			return tokens, nil
+		}
+
+		var token []byte
+		var err error
+		if strings.HasPrefix(input[i:], HEX_PREFIX) || strings.HasPrefix(input[i:], BASE64_PREFIX) {
+			token, i, err = readLiteral(input, i)
+		} else {
+			token, i, err = readToken(input, i)
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+// readLiteral decodes the hex: or b64: token starting at i and returns the position after it
+func readLiteral(input string, i int) ([]byte, int, error) {
+	end := i
+	for end < len(input) && !isSpace(input[end]) {
+		end++
+	}
+
+	prefix := input[i : i+len(HEX_PREFIX)]
+	literal := input[i+len(prefix) : end]
+	if prefix == HEX_PREFIX {
+		token, err := hex.DecodeString(literal)
+		if err != nil {
+			return nil, end, errInvalidHex
+		}
+		return token, end, nil
+	}
+
+	token, err := base64.StdEncoding.DecodeString(literal)
+	if err != nil {
+		return nil, end, errInvalidBase64
+	}
+	return token, end, nil
+}
+
+// readToken reads the quoted and unquoted parts of the token starting at i and returns the position after it
+func readToken(input string, i int) ([]byte, int, error) {
+	token := []byte{}
+	for i < len(input) && !isSpace(input[i]) {
+		c := input[i]
+		if c == '\'' {
+			end := strings.IndexByte(input[i+1:], '\'')
+			if end < 0 {
+				return nil, i, errUnterminatedQuote
+			}
+			token = append(token, input[i+1:i+1+end]...)
+			i += end + 2
+		} else if c == '"' {
+			i++
+			for {
+				if i == len(input) {
+					return nil, i, errUnterminatedQuote
+				}
+				if input[i] == '"' {
+					i++
+					break
+				}
+				if input[i] == '\\' {
+					var b byte
+					var err error
+					b, i, err = readEscape(input, i)
+					if err != nil {
+						return nil, i, err
+					}
+					token = append(token, b)
+					continue
+				}
+				token = append(token, input[i])
+				i++
+			}
+		} else if c == '\\' {
+			if i+1 < len(input) && input[i+1] == ' ' {
+				token = append(token, ' ')
+				i += 2
+				continue
+			}
+			var b byte
+			var err error
+			b, i, err = readEscape(input, i)
+			if err != nil {
+				return nil, i, err
+			}
+			token = append(token, b)
+		} else {
+			token = append(token, c)
+			i++
+		}
+	}
+	return token, i, nil
+}
+
+// readEscape decodes the escape sequence starting with the backslash at i and returns the position after it
+func readEscape(input string, i int) (byte, int, error) {
+	if i+1 == len(input) {
+		return 0, i, errInvalidEscape
+	}
+
+	switch input[i+1] {
+	case '\\', '"', '\'':
+		return input[i+1], i + 2, nil
+	case 'n':
+		return '\n', i + 2, nil
+	case 'r':
+		return '\r', i + 2, nil
+	case 't':
+		return '\t', i + 2, nil
+	case '0':
+		return 0, i + 2, nil
+	case 'x':
+		if i+4 > len(input) {
+			return 0, i, errInvalidEscape
+		}
+		b, err := hex.DecodeString(input[i+2 : i+4])
+		if err != nil {
+			return 0, i, errInvalidEscape
+		}
+		return b[0], i + 4, nil
+	}
+	return 0, i, errInvalidEscape
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+/*
+formatBytes returns the bytes as text if they are printable, otherwise as a hex: literal,
+so binary keys and values are displayed in a form the tokenizer reads back.
+*/
+func formatBytes(data []byte) string {
+	if !utf8.Valid(data) {
+		return HEX_PREFIX + hex.EncodeToString(data)
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && r != '\t' {
+			return HEX_PREFIX + hex.EncodeToString(data)
+		}
+	}
+	return string(data)
+}
+
+/*
+formatToken returns the bytes as a token the tokenizer reads back unchanged.
+Plain printable text is returned as it is, anything else is double quoted with the non-printable bytes escaped.
+*/
+func formatToken(data []byte) string {
+	plain := len(data) > 0 && utf8.Valid(data) &&
+		!strings.HasPrefix(string(data), HEX_PREFIX) && !strings.HasPrefix(string(data), BASE64_PREFIX)
+	for _, r := range string(data) {
+		if !plain {
+			break
+		}
+		plain = unicode.IsPrint(r) && r != ' ' && r != '"' && r != '\'' && r != '\\'
+	}
+	if plain {
+		return string(data)
+	}
+
+	var token strings.Builder
+	token.WriteByte('"')
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		switch {
+		case r == '"' || r == '\\':
+			token.WriteByte('\\')
+			token.WriteRune(r)
+		case r == '\n':
+			token.WriteString("\\n")
+		case r == '\t':
+			token.WriteString("\\t")
+		case r == utf8.RuneError || !unicode.IsPrint(r):
+			for _, b := range data[:size] {
+				token.WriteString("\\x" + hex.EncodeToString([]byte{b}))
+			}
+		default:
+			token.WriteRune(r)
+		}
+		data = data[size:]
+	}
+	token.WriteByte('"')
+
+	return token.String()
+}
@@ -0,0 +1,183 @@
+package Engine
+
+import "errors"
+
+var ErrTxnDone = errors.New("transaction is already committed or rolled back")
+
+/*
+ConflictError is returned by Commit when a key read by the transaction was changed by another writer
+after the transaction started. Nothing is applied, the transaction can be retried from Begin.
+*/
+type ConflictError struct {
+	Key string
+}
+
+func (e *ConflictError) Error() string {
+	return "transaction conflict on key '" + e.Key + "'"
+}
+
+/*
+Txn is an optimistic transaction.
+Reads see the database as it was when the transaction started, together with the transaction's own writes.
+Writes are buffered and applied atomically by Commit, which fails with a ConflictError
+if any key read by the transaction was changed in the meantime.
+
+A Txn is not safe for concurrent use, it must be finished with Commit or Rollback.
+*/
+type Txn struct {
+	db       *DB
+	snapshot *Snapshot
+	reads    map[string]bool // read keys, true if the key was found
+	writes   map[string]txnWrite
+	batch    *WriteBatch
+	done     bool
+}
+
+type txnWrite struct {
+	value   []byte
+	deleted bool
+}
+
+/*
+Begin starts a transaction reading from the current state of the database.
+
+Returns:
+  - *Txn: The started transaction.
+  - error: ErrClosed if the database is closed.
+*/
+func (db *DB) Begin() (*Txn, error) {
+	snapshot, err := db.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Txn{
+		db:       db,
+		snapshot: snapshot,
+		reads:    make(map[string]bool),
+		writes:   make(map[string]txnWrite),
+		batch:    MakeWriteBatch(),
+	}, nil
+}
+
+/*
+Get retrieves the value of the key as seen by the transaction, the key is added to the read set.
+
+Returns:
+  - []byte: Value of the key.
+  - bool: Indicates whether the key was found.
+  - error: ErrTxnDone if the transaction is finished, or an error during reading.
+*/
+func (txn *Txn) Get(key string) ([]byte, bool, error) {
+	if txn.done {
+		return nil, false, ErrTxnDone
+	}
+
+	if write, exists := txn.writes[key]; exists {
+		return write.value, !write.deleted, nil
+	}
+
+	value, found, err := txn.db.GetAt(txn.snapshot, key)
+	if err != nil {
+		return nil, false, err
+	}
+	txn.reads[key] = txn.reads[key] || found
+	return value, found, nil
+}
+
+/*
+Put stores the key-value pair when the transaction commits.
+*/
+func (txn *Txn) Put(key string, value []byte) error {
+	if txn.done {
+		return ErrTxnDone
+	}
+
+	txn.writes[key] = txnWrite{value: value}
+	txn.batch.Put(key, value)
+	return nil
+}
+
+/*
+Delete deletes the key when the transaction commits.
+*/
+func (txn *Txn) Delete(key string) error {
+	if txn.done {
+		return ErrTxnDone
+	}
+
+	txn.writes[key] = txnWrite{deleted: true}
+	txn.batch.Delete(key)
+	return nil
+}
+
+/*
+Commit checks that no key read by the transaction changed since it started
+and applies all of its writes atomically as one WAL entry.
+The transaction is finished afterwards, even if it fails.
+
+Returns:
+  - error: *ConflictError if a read key changed, ErrTxnDone if the transaction is already finished,
+    or any error during writing.
+*/
+func (txn *Txn) Commit() error {
+	if txn.done {
+		return ErrTxnDone
+	}
+	defer txn.finish()
+
+	db := txn.db
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	for key, found := range txn.reads {
+		seq, err := db.latestSeq(db.defaultFamily, key)
+		if err != nil {
+			return err
+		}
+		// a key that was found and has no version left was deleted, and the tombstone compacted away with it
+		if seq > txn.snapshot.Seq() || (found && seq == 0) {
+			return &ConflictError{Key: key}
+		}
+	}
+
+	return db.applyBatch(txn.batch)
+}
+
+/*
+Rollback discards the writes of the transaction. Rolling back a finished transaction does nothing.
+*/
+func (txn *Txn) Rollback() {
+	if txn.done {
+		return
+	}
+	txn.finish()
+}
+
+func (txn *Txn) finish() {
+	txn.done = true
+	txn.writes = nil
+	txn.batch = nil
+	_ = txn.snapshot.Release()
+}
+
+// latestSeq returns the sequence number of the newest version of the key, including deletes, 0 if it was never written
+func (db *DB) latestSeq(f *family, key string) (uint64, error) {
+	found, rec := f.memMan.FindInMem(key)
+	if !found {
+		var err error
+		rec, err = f.sst.Get(key)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if rec == nil {
+		return 0, nil
+	}
+
+	return rec.GetSeq(), nil
+}
@@ -0,0 +1,219 @@
+package Engine
+
+import (
+	"errors"
+	"testing"
+)
+
+// conflicts runs the change of another writer between the read of the key by a transaction and its commit
+func conflicts(t *testing.T, db *DB, key string, change func() error) error {
+	txn, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = txn.Get(key); err != nil {
+		t.Fatal(err)
+	}
+	if err = txn.Put("txn:result", []byte("written")); err != nil {
+		t.Fatal(err)
+	}
+	if err = change(); err != nil {
+		t.Fatal(err)
+	}
+	return txn.Commit()
+}
+
+func TestTxnConflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		change func(db *DB) error
+	}{
+		{"write-write", "present", func(db *DB) error {
+			return db.Put("present", []byte("other"))
+		}},
+		{"delete", "present", func(db *DB) error {
+			return db.Delete("present")
+		}},
+		{"read absent, inserted", "absent", func(db *DB) error {
+			return db.Put("absent", []byte("other"))
+		}},
+		{"range delete", "present", func(db *DB) error {
+			return db.DeleteRange("pre", "pro")
+		}},
+		{"delete compacted away", "present", func(db *DB) error {
+			if err := db.Delete("present"); err != nil {
+				return err
+			}
+			return db.Compact()
+		}},
+		{"range delete in the tables", "present", func(db *DB) error {
+			if err := db.Compact(); err != nil {
+				return err
+			}
+			if err := db.DeleteRange("pre", "pro"); err != nil {
+				return err
+			}
+			return db.Compact()
+		}},
+		{"batch", "present", func(db *DB) error {
+			batch := MakeWriteBatch()
+			batch.Put("unrelated", []byte("x"))
+			batch.Put("present", []byte("other"))
+			return db.Write(batch)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := openTestDB(t, "btree")
+			if err := db.Put("present", []byte("value")); err != nil {
+				t.Fatal(err)
+			}
+
+			err := conflicts(t, db, test.key, func() error {
+				return test.change(db)
+			})
+			var conflict *ConflictError
+			if !errors.As(err, &conflict) || conflict.Key != test.key {
+				t.Fatalf("got %v, want a conflict on %s", err, test.key)
+			}
+			if _, found, err := db.Get("txn:result"); err != nil || found {
+				t.Errorf("write of the conflicting transaction was applied: %v %v", found, err)
+			}
+		})
+	}
+}
+
+// TestTxnNoConflict checks that changes to keys the transaction did not read, or only wrote, do not conflict
+func TestTxnNoConflict(t *testing.T) {
+	db := openTestDB(t, "btree")
+	if err := db.Put("present", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	txn, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = txn.Get("present"); err != nil {
+		t.Fatal(err)
+	}
+	if err = txn.Put("written", []byte("txn")); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Put("written", []byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.DeleteRange("x", "z"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = txn.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if value, _, _ := db.Get("written"); string(value) != "txn" {
+		t.Errorf("got %q, want the value of the transaction", value)
+	}
+}
+
+// TestTxnCommitAppliesAll checks that the transaction reads its own writes and the snapshot, and that Commit applies every write
+func TestTxnCommitAppliesAll(t *testing.T) {
+	db := openTestDB(t, "btree")
+	for _, key := range []string{"a", "b", "c"} {
+		if err := db.Put(key, []byte("old")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	txn, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Put("c", []byte("after begin")); err != nil {
+		t.Fatal(err)
+	}
+	if value, _, _ := txn.Get("c"); string(value) != "old" {
+		t.Errorf("transaction read %q, want the value at Begin", value)
+	}
+
+	_ = txn.Put("a", []byte("new"))
+	_ = txn.Delete("b")
+	_ = txn.Put("d", []byte("new"))
+	if value, found, _ := txn.Get("b"); found {
+		t.Errorf("transaction read its deleted key: %q", value)
+	}
+	if value, _, _ := txn.Get("d"); string(value) != "new" {
+		t.Errorf("transaction read %q, want its own write", value)
+	}
+
+	for _, key := range []string{"a", "d"} {
+		if value, _, _ := db.Get(key); string(value) == "new" {
+			t.Errorf("write to %s is visible before Commit", key)
+		}
+	}
+
+	// c was read after another writer changed it, so the commit fails and nothing is applied
+	if err = txn.Commit(); err == nil {
+		t.Fatal("commit after a conflicting write succeeded")
+	}
+	if value, _, _ := db.Get("a"); string(value) != "old" {
+		t.Errorf("a: got %q after a failed commit", value)
+	}
+
+	txn, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = txn.Put("a", []byte("new"))
+	_ = txn.Delete("b")
+	_ = txn.Put("d", []byte("new"))
+	if err = txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"a": "new", "c": "after begin", "d": "new"}
+	for _, key := range []string{"a", "b", "c", "d"} {
+		value, found, err := db.Get(key)
+		if err != nil || found != (want[key] != "") || string(value) != want[key] {
+			t.Errorf("%s: got %q %v %v, want %q", key, value, found, err, want[key])
+		}
+	}
+}
+
+func TestTxnDone(t *testing.T) {
+	db := openTestDB(t, "btree")
+
+	for _, finish := range []string{"commit", "rollback"} {
+		txn, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = txn.Put("key", []byte(finish))
+		if finish == "commit" {
+			if err = txn.Commit(); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			txn.Rollback()
+		}
+
+		if _, _, err = txn.Get("key"); !errors.Is(err, ErrTxnDone) {
+			t.Errorf("get after %s: got %v, want ErrTxnDone", finish, err)
+		}
+		if err = txn.Put("key", nil); !errors.Is(err, ErrTxnDone) {
+			t.Errorf("put after %s: got %v, want ErrTxnDone", finish, err)
+		}
+		if err = txn.Delete("key"); !errors.Is(err, ErrTxnDone) {
+			t.Errorf("delete after %s: got %v, want ErrTxnDone", finish, err)
+		}
+		if err = txn.Commit(); !errors.Is(err, ErrTxnDone) {
+			t.Errorf("commit after %s: got %v, want ErrTxnDone", finish, err)
+		}
+		txn.Rollback()
+	}
+
+	if value, _, _ := db.Get("key"); string(value) != "commit" {
+		t.Errorf("got %q, want the write of the committed transaction only", value)
+	}
+}
@@ -1,71 +1,162 @@
 package Engine
 
 import (
-	"bufio"
 	"fmt"
-	"os"
+	"io"
 	"regexp"
 	"strings"
 )
 
-func checkInput(input string) int {
-	getRegex := regexp.MustCompile(GETREGEX)
-	deleteRegex := regexp.MustCompile(DELETEREGEX)
-	putRegex := regexp.MustCompile(PUTREGEX)
-	exitRegex := regexp.MustCompile(EXITREGEX)
-	makeRegex := regexp.MustCompile(MAKEREGEX)
-	destroyRegex := regexp.MustCompile(DESTROYREGEX)
-	fingerprintRegex := regexp.MustCompile(FINGERPRINTREGEX)
-	addToStructRegex := regexp.MustCompile(ADDTOSTRUCTREGEX)
-	checkRegex := regexp.MustCompile(CHECKSTRUCTURE)
-	checkHllRegex := regexp.MustCompile(CHECKSTRUCTUREHLL)
-	simhashRegex := regexp.MustCompile(SIMHASHREGEX)
-	prefixscanRegex := regexp.MustCompile(PREFIXSCANREGEX)
-	rangescanRegex := regexp.MustCompile(RANGESCANREGEX)
-	prefixiterRegex := regexp.MustCompile(PREFIXITERREGEX)
-	rangeiterRegex := regexp.MustCompile(RANGEITERREGEX)
-
-	if getRegex.MatchString(input) {
-		return OPTION_GET
-	} else if deleteRegex.MatchString(input) {
-		return OPTION_DELETE
-	} else if putRegex.MatchString(input) {
-		return OPTION_PUT
-	} else if exitRegex.MatchString(input) {
-		return OPTION_EXIT
-	} else if makeRegex.MatchString(input) {
-		return OPTION_MAKE
-	} else if destroyRegex.MatchString(input) {
-		return OPTION_DESTROY
-	} else if fingerprintRegex.MatchString(input) {
-		return OPTION_FINGERPRINT
-	} else if addToStructRegex.MatchString(input) {
-		return OPTION_ADDTOSTRUCT
-	} else if checkRegex.MatchString(input) || checkHllRegex.MatchString(input) {
-		return OPTION_CHECKSTRUCT
-	} else if simhashRegex.MatchString(input) {
-		return OPTION_SIMHASH
-	} else if prefixscanRegex.MatchString(input) {
-		return OPTION_PREFIXSCAN
-	} else if rangescanRegex.MatchString(input) {
-		return OPTION_RANGESCAN
-	} else if prefixiterRegex.MatchString(input) {
-		return OPTION_PREFIXITER
-	} else if rangeiterRegex.MatchString(input) {
-		return OPTION_RANGEITER
-	} else {
+// command is the option chosen by a command name and the number of tokens the command takes, including the name
+type command struct {
+	option int
+	tokens int
+}
+
+var commands = map[string]command{
+	"exit":          {OPTION_EXIT, 1},
+	"get":           {OPTION_GET, 2},
+	"put":           {OPTION_PUT, 3},
+	"delete":        {OPTION_DELETE, 2},
+	"cas":           {OPTION_CAS, 4},
+	"setnx":         {OPTION_SETNX, 3},
+	"delifeq":       {OPTION_DELIFEQ, 3},
+	"fingerprint":   {OPTION_FINGERPRINT, 3},
+	"simhash":       {OPTION_SIMHASH, 3},
+	"prefixscan":    {OPTION_PREFIXSCAN, 4},
+	"rangescan":     {OPTION_RANGESCAN, 5},
+	"prefixiterate": {OPTION_PREFIXITER, 2},
+	"rangeiterate":  {OPTION_RANGEITER, 3},
+	ITER_NEXT:       {OPTION_ITERNEXT, 1},
+	ITER_STOP:       {OPTION_ITERSTOP, 1},
+	ITER_PREV:       {OPTION_ITERPREV, 1},
+	ITER_SEEK:       {OPTION_ITERSEEK, 2},
+	ITER_LAST:       {OPTION_ITERLAST, 1},
+	"count":         {OPTION_COUNT, 2},
+	"du":            {OPTION_DU, 2},
+	"bounds":        {OPTION_BOUNDS, 2},
+}
+
+// scanCommands are the commands following scan, the key pattern can be followed by a value condition
+var scanCommands = map[string]command{
+	"match": {OPTION_MATCHSCAN, 5},
+	"regex": {OPTION_REGEXSCAN, 5},
+}
+
+// approxCommands are the commands following approx, they estimate instead of reading every record
+var approxCommands = map[string]command{
+	"count": {OPTION_APPROXCOUNT, 3},
+	"du":    {OPTION_APPROXDU, 3},
+}
+
+// structCommands are the commands following the structure name (bf, cms or hll)
+var structCommands = map[string]command{
+	"make":    {OPTION_MAKE, 3},
+	"destroy": {OPTION_DESTROY, 3},
+	"put":     {OPTION_ADDTOSTRUCT, 4},
+	"check":   {OPTION_CHECKSTRUCT, 4},
+}
+
+// makeParams is the number of inline parameters of the make command of each structure
+var makeParams = map[string]int{
+	STRUCT_BF:  2,
+	STRUCT_CMS: 2,
+	STRUCT_HLL: 1,
+}
+
+var numberRegex = regexp.MustCompile(`^\d+$`)
+
+// checkInput returns the option of the tokenized command, OPTION_INVALID if it is unknown or has wrong arguments
+func checkInput(tokens [][]byte) int {
+	if len(tokens) == 0 {
+		return OPTION_INVALID
+	}
+
+	name := string(tokens[0])
+	cmd, ok := commands[name]
+	if name == STRUCT_BF || name == STRUCT_CMS || name == STRUCT_HLL {
+		if len(tokens) < 2 {
+			return OPTION_INVALID
+		}
+		cmd, ok = structCommands[string(tokens[1])]
+		if ok && cmd.option == OPTION_CHECKSTRUCT && name == STRUCT_HLL {
+			// a hyperloglog is checked without data
+			cmd.tokens--
+		}
+		if ok && cmd.option == OPTION_MAKE && len(tokens) == cmd.tokens+makeParams[name] {
+			// the parameters are given inline instead of being asked for
+			cmd.tokens = len(tokens)
+		}
+	}
+	if name == APPROX {
+		if len(tokens) < 2 {
+			return OPTION_INVALID
+		}
+		cmd, ok = approxCommands[string(tokens[1])]
+	}
+	if name == SCAN {
+		if len(tokens) < 2 {
+			return OPTION_INVALID
+		}
+		cmd, ok = scanCommands[string(tokens[1])]
+		if ok && len(tokens) > cmd.tokens && valueCondition(tokens[cmd.tokens:]) {
+			cmd.tokens = len(tokens)
+		}
+	}
+	if ok && aggregates(cmd.option) && len(tokens) == cmd.tokens+1 {
+		// the two ends of a range are given instead of a prefix
+		cmd.tokens++
+	}
+	if !ok || len(tokens) != cmd.tokens {
 		return OPTION_INVALID
 	}
+
+	switch cmd.option {
+	case OPTION_PREFIXSCAN, OPTION_RANGESCAN:
+		// the page number or cursor and the page size are the last two tokens
+		if !validPage(tokens[len(tokens)-2], tokens[len(tokens)-1]) {
+			return OPTION_INVALID
+		}
+	case OPTION_MATCHSCAN, OPTION_REGEXSCAN:
+		// the page number or cursor and the page size follow the pattern
+		if !validPage(tokens[3], tokens[4]) {
+			return OPTION_INVALID
+		}
+	}
+
+	return cmd.option
+}
+
+// validPage reports whether the tokens are a page number or a cursor and a page size
+func validPage(page, pageSize []byte) bool {
+	return (numberRegex.Match(page) || isCursor(page)) && numberRegex.Match(pageSize)
+}
+
+// valueCondition reports whether the tokens are contains {text} or json {field} {value}
+func valueCondition(tokens [][]byte) bool {
+	name := string(tokens[0])
+	return (name == VALUE_CONTAINS && len(tokens) == 2) || (name == VALUE_JSON && len(tokens) == 3)
 }
 
-func getInput() string {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print(PROMPTCAHAR)
-	input, _ := reader.ReadString('\n')
+/*
+readInput reads the next line of the input, the prompt is printed only in the interactive mode with the text output.
+
+Returns:
+  - string: The line without the line ending.
+  - error: io.EOF once the input is exhausted.
+*/
+func (e *Engine) readInput() (string, error) {
+	if e.interactive() {
+		fmt.Print(PROMPTCAHAR)
+	}
+	input, err := e.input.ReadString('\n')
+	if err != nil && (err != io.EOF || input == "") {
+		return "", err
+	}
 	input = strings.TrimRight(input, "\n")
 	input = strings.TrimRight(input, "\r")
 
-	return input
+	return input, nil
 }
 
 func showValidOptions() {
@@ -73,10 +164,18 @@ func showValidOptions() {
 	fmt.Println("You must use one of the following commands:")
 	fmt.Println()
 	fmt.Println("exit -> exits program")
+	fmt.Println("keys and values can be \"quoted\", escaped with \\n, \\t, \\xHH... or given as hex:{hex} or b64:{base64}")
+	fmt.Println()
 	fmt.Println("get {key} -> gets the value")
 	fmt.Println("put {key} {value} -> stores the key-value pair")
+	fmt.Println("cas {key} {expected} {value} -> stores the value if the key holds the expected one")
+	fmt.Println("setnx {key} {value} -> stores the key-value pair if the key does not exist")
+	fmt.Println("delifeq {key} {expected} -> deletes the key if it holds the expected value")
 	fmt.Println()
-	fmt.Println("(bf|cms|hll) make {name} -> makes structrue")
+	fmt.Println("(bf|cms|hll) make {name} -> makes structrue, asking for its parameters")
+	fmt.Println("bf make {name} {expected_elements} {precision} -> makes bloom filter")
+	fmt.Println("cms make {name} {epsilon} {delta} -> makes count-min sketch")
+	fmt.Println("hll make {name} {precision} -> makes hyperloglog")
 	fmt.Println("(bf|cms|hll) destroy {name} -> destroys structure")
 	fmt.Println("(bf|cms|hll) put {name} {data} -> adds data to structure")
 	fmt.Println("(bf|cms|hll) check {name} {data} -> checks the structure by data")
@@ -85,19 +184,30 @@ func showValidOptions() {
 	fmt.Println("simhash {fingerprint_name} {fingerprint_name} -> calculates simhash for fingerprints")
 	fmt.Println()
 	fmt.Println("prefixscan {prefix} {page} {page_size} -> does prefix scann")
-	fmt.Println("rangescan {rangeMin}-{rangeMax} {page} {page_size} -> does range scann")
+	fmt.Println("rangescan {rangeMin} {rangeMax} {page} {page_size} -> does range scann")
+	fmt.Println("scan match {glob} {page} {page_size} -> scans the keys matching the glob, like user:*:session")
+	fmt.Println("scan regex {regex} {page} {page_size} -> scans the keys the regex matches, ^ makes it seek to its prefix")
+	fmt.Println("  scan match and scan regex can end with contains {text} or json {field} {value} to check the values")
+	fmt.Println("the first page returns a cursor:... token, given instead of the page it reads the next page")
+	fmt.Println()
+	fmt.Println("count {prefix} | count {rangeMin} {rangeMax} -> counts the keys")
+	fmt.Println("du {prefix} | du {rangeMin} {rangeMax} -> sums the sizes of the keys and values")
+	fmt.Println("bounds {prefix} | bounds {rangeMin} {rangeMax} -> gets the first and the last key")
+	fmt.Println("approx (count|du) ... -> estimates from the SSTable indexes, counting every stored version")
 	fmt.Println()
 	fmt.Println("prefixiterate {prefix} -> enters prefix iterator")
-	fmt.Println("rangeiterate {rangeMin}-{rangeMax} -> enters range iterator")
+	fmt.Println("rangeiterate {rangeMin} {rangeMax} -> enters range iterator")
 	fmt.Println("next -> gets nex element when in iterator mode")
+	fmt.Println("prev -> gets previous element when in iterator mode")
+	fmt.Println("seek {key} -> moves before the first key not less than the given one, in iterator mode")
+	fmt.Println("last -> moves after the last element, so prev gets it, in iterator mode")
 	fmt.Println("stop -> stop exits iterator mode")
 	fmt.Println("---------------------------------------------------------------------------------------------------")
 }
 
-func pauseTerminal() {
-	reader := bufio.NewReader(os.Stdin)
+func (e *Engine) pauseTerminal() {
 	fmt.Println("PRESS ENTER")
-	_, _ = reader.ReadString('\n')
+	_, _ = e.input.ReadString('\n')
 }
 
 func displayError(err error) {
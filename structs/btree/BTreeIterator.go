@@ -3,6 +3,7 @@ package btree
 import (
 	"key-value-engine/structs/iterator"
 	"key-value-engine/structs/record"
+	"sort"
 	"strings"
 )
 
@@ -45,7 +46,6 @@ func (bt *BTree) NewBTreeRangeIterator(minRange, maxRange string) iterator.Itera
 // NewBTreePrefixIterator creates a new iterator for the given B-tree.
 func (bt *BTree) NewBTreePrefixIterator(prefix string) iterator.Iterator {
 	keys := make([]*record.Record, 0)
-	keys = bt.GetSorted()
 	keys = bt.innerSorted(nil, keys)
 
 	index := 0
@@ -65,22 +65,61 @@ func (bt *BTree) NewBTreePrefixIterator(prefix string) iterator.Iterator {
 }
 
 func (iter *BTreeIterator) Valid() bool {
-	return iter.position < len(iter.keys) && iter.checkStopCondition()
+	return iter.position >= 0 && iter.position < len(iter.keys) && iter.checkStopCondition()
 }
 
 func (iter *BTreeIterator) Next() {
 	iter.position++
 }
 
+func (iter *BTreeIterator) Prev() {
+	iter.position--
+}
+
+// Seek moves the iterator to the first record with a key not less than the given one.
+func (iter *BTreeIterator) Seek(key string) {
+	key = iter.startKey(key)
+	iter.position = sort.Search(len(iter.keys), func(i int) bool {
+		return iter.keys[i].GetKey() >= key
+	})
+}
+
+// SeekToLast moves the iterator to the last record.
+func (iter *BTreeIterator) SeekToLast() {
+	iter.position = sort.Search(len(iter.keys), func(i int) bool {
+		return iter.pastEnd(iter.keys[i].GetKey())
+	}) - 1
+}
+
 func (iter *BTreeIterator) Get() *record.Record {
 	return iter.keys[iter.position]
 }
 
 func (iter *BTreeIterator) checkStopCondition() bool {
+	key := iter.keys[iter.position].GetKey()
 	if iter.rangeIterator {
-		return iter.keys[iter.position].GetKey() <= iter.maxRange
+		return key >= iter.minRange && key <= iter.maxRange
 	} else {
-		return strings.HasPrefix(iter.keys[iter.position].GetKey(), iter.prefix)
+		return strings.HasPrefix(key, iter.prefix)
+	}
+
+}
+
+// startKey returns the key a seek starts from, keys before the range or the prefix are never visited
+func (iter *BTreeIterator) startKey(key string) string {
+	if iter.rangeIterator && key < iter.minRange {
+		return iter.minRange
+	}
+	if !iter.rangeIterator && key < iter.prefix {
+		return iter.prefix
 	}
+	return key
+}
 
+// pastEnd reports whether the key comes after the range or the keys with the prefix
+func (iter *BTreeIterator) pastEnd(key string) bool {
+	if iter.rangeIterator {
+		return key > iter.maxRange
+	}
+	return key > iter.prefix && !strings.HasPrefix(key, iter.prefix)
 }
@@ -66,6 +66,21 @@ func (cms *CMS) Add(element []byte) {
 	}
 }
 
+/*
+AddCount increments the counters of a given element by count, like calling Add count times.
+
+Parameters:
+  - cms: Pointer to the CMS instance to which the element's count should be incremented.
+  - element: Byte slice representing the element whose count needs to be increased.
+  - count: Number by which the element's count is increased.
+*/
+func (cms *CMS) AddCount(element []byte, count uint64) {
+	for i, hf := range cms.hashFunctions {
+		index := hf.hash(element) % uint64(cms.m)
+		cms.data[i][index] += count
+	}
+}
+
 /*
 Estimate returns the approximate count of a given element in the Count-Min Sketch (CMS) data structure.
 
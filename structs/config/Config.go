@@ -4,11 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
+	"path/filepath"
 )
 
 const (
 	CONFIG_DIR  = "conf"
-	CONFIG_PATH = "conf" + string(os.PathSeparator) + "config.json"
+	CONFIG_PATH = CONFIG_DIR + string(os.PathSeparator) + "config.json"
 
 	DEFAULT_WALSIZE             = 1048576
 	DEFAULT_MEMTABLESIZE        = 1000
@@ -51,31 +52,11 @@ type Config struct {
 	LeveledInc          uint64  `json:"leveled_inc"`
 }
 
-func MakeConfig() (*Config, error) {
-	var cfgDefault Config
-
-	cfg := Config{
-		WalSize:             DEFAULT_WALSIZE,
-		MemtableSize:        DEFAULT_MEMTABLESIZE,
-		MemtableCount:       DEFAULT_MEMTABLECOUNT,
-		MemtableStructure:   DEFAULT_MEMTABLESTRUCT,
-		BTreeDegree:         DEFAULT_BTREEDEGREE,
-		SkipListMaxHeight:   DEFAULT_SKIPLISTMAXHEIGHT,
-		CacheSize:           DEFAULT_CACHESIZE,
-		MultipleFilesSST:    DEFAULT_FILESSST,
-		SummaryIndexDensity: DEFAULT_SUMMARYINDEXDENSITY,
-		Compress:            DEFAULT_DO_COMPRESSION,
-		CompressionType:     DEFAULT_COMPRESSIONTYPE,
-		MaxLsmLevels:        DEFAULT_MAXLSMLEVELS,
-		TablesToCompress:    DEFAULT_TABLESTOCOMPRESS,
-		TokenCapacity:       DEFAULT_TOKENCAPACITY,
-		RefillCooldown:      DEFAULT_REFILLCOOLDOWN,
-		FilterPrecsion:      DEFAULT_FILTERPRECISION,
-		FirstLeveledSize:    DEFAULT_FIRST_LEVELED_SIZE,
-		LeveledInc:          DEAFAULT_LEVELED_INC,
-	}
-
-	cfgDefault = Config{
+/*
+DefaultConfig returns the configuration filled with default values.
+*/
+func DefaultConfig() Config {
+	return Config{
 		WalSize:             DEFAULT_WALSIZE,
 		MemtableSize:        DEFAULT_MEMTABLESIZE,
 		MemtableCount:       DEFAULT_MEMTABLECOUNT,
@@ -95,33 +76,43 @@ func MakeConfig() (*Config, error) {
 		FirstLeveledSize:    DEFAULT_FIRST_LEVELED_SIZE,
 		LeveledInc:          DEAFAULT_LEVELED_INC,
 	}
+}
 
-	if _, err := os.Stat(CONFIG_DIR); os.IsNotExist(err) {
-		if err := os.MkdirAll(CONFIG_DIR, 0755); err != nil {
+/*
+MakeConfig reads the configuration from the json file at the given path.
+Missing or invalid values are replaced with defaults and the result is written back to the file.
+*/
+func MakeConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	cfgDefault := DefaultConfig()
+
+	configDir := filepath.Dir(path)
+	if _, err := os.Stat(configDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(configDir, 0755); err != nil {
 			return &cfgDefault, errors.New("error creating conf directory")
 		}
 	}
 
-	if _, err := os.Stat(CONFIG_PATH); !os.IsNotExist(err) {
-		configData, err := os.ReadFile(CONFIG_PATH)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		configData, err := os.ReadFile(path)
 		if err != nil {
 			return &cfgDefault, errors.New("error reading config file")
 		}
 
 		err = json.Unmarshal(configData, &cfg)
 		if err != nil {
-			err := cfgDefault.writeConfig()
+			err := cfgDefault.writeConfig(path)
 			if err != nil {
 				return &cfgDefault, err
 			}
 			return &cfgDefault, errors.New("error converting json file")
 		}
 
-		cfg.validate()
+		cfg.Validate()
 
 	}
 
-	err := cfg.writeConfig()
+	err := cfg.writeConfig(path)
 	if err != nil {
 		return nil, err
 	}
@@ -130,7 +121,10 @@ func MakeConfig() (*Config, error) {
 
 }
 
-func (cfg *Config) validate() {
+/*
+Validate replaces every out of range value with its default.
+*/
+func (cfg *Config) Validate() {
 	if cfg.WalSize < 750 {
 		cfg.WalSize = DEFAULT_WALSIZE
 	}
@@ -196,7 +190,39 @@ func (cfg *Config) validate() {
 	}
 }
 
-func (cfg *Config) writeConfig() error {
+/*
+Set overrides one setting, named as in the json file. The value is read as json,
+a value that is not valid json is taken as a string. Validate should be called after the overrides.
+*/
+func (cfg *Config) Set(name, value string) error {
+	marshalled, err := json.Marshal(cfg)
+	if err != nil {
+		return errors.New("error converting config to json")
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(marshalled, &fields)
+	if err != nil {
+		return errors.New("error converting config to json")
+	}
+	if _, ok := fields[name]; !ok {
+		return errors.New("unknown config setting '" + name + "'")
+	}
+
+	raw := []byte(value)
+	if !json.Valid(raw) {
+		raw, _ = json.Marshal(value)
+	}
+	override := map[string]json.RawMessage{name: raw}
+	marshalled, _ = json.Marshal(override)
+
+	err = json.Unmarshal(marshalled, cfg)
+	if err != nil {
+		return errors.New("invalid value of config setting '" + name + "'")
+	}
+	return nil
+}
+
+func (cfg *Config) writeConfig(path string) error {
 	// Marshal the modified config back to JSON
 	marshalled, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
@@ -205,7 +231,7 @@ func (cfg *Config) writeConfig() error {
 	}
 
 	// Write the JSON data to the file
-	err = os.WriteFile(CONFIG_PATH, marshalled, 0644)
+	err = os.WriteFile(path, marshalled, 0644)
 	if err != nil {
 		return errors.New("error writing config to file")
 	}
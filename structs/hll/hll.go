@@ -16,6 +16,8 @@ const (
 	HLL_HEADER_SIZE   = HLL_P_SIZE + HLL_M_SIZE
 )
 
+var ErrPrecision = errors.New("hll illegal precision")
+
 func firstKbits(value, k uint64) uint64 {
 	return value >> (64 - k)
 }
@@ -41,7 +43,7 @@ Returns:
 */
 func MakeHLL(p uint8) (*HyperLogLog, error) {
 	if p < HLL_MIN_PRECISION || p > HLL_MAX_PRECISION {
-		return nil, errors.New("hll illegal precision")
+		return nil, ErrPrecision
 	}
 
 	m := uint64(math.Pow(2, float64(p)))
@@ -136,7 +138,7 @@ Returns:
 func (hll *HyperLogLog) HLLToBytes() ([]byte, error) {
 	// Check if precision is within valid range
 	if hll.P < HLL_MIN_PRECISION || hll.P > HLL_MAX_PRECISION {
-		return nil, errors.New("hll illegal precision")
+		return nil, ErrPrecision
 	}
 
 	// Serialize M, P, and Reg into a byte slice
@@ -2,8 +2,17 @@ package iterator
 
 import "key-value-engine/structs/record"
 
+/*
+Iterator walks the records of a memtable or an SSTable within a range or with a prefix, in key order.
+Next and Prev move from a valid position only, a seek can be used in any position.
+*/
 type Iterator interface {
 	Valid() bool
 	Next()
+	Prev()
 	Get() *record.Record
+	// Seek moves to the first record with a key not less than the given one
+	Seek(key string)
+	// SeekToLast moves to the last record
+	SeekToLast()
 }
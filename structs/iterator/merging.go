@@ -0,0 +1,154 @@
+package iterator
+
+import (
+	"container/heap"
+	"key-value-engine/structs/record"
+)
+
+/*
+Forward is the part of an iterator a merge needs, the readers of whole tables in a compaction only move forward.
+*/
+type Forward interface {
+	Valid() bool
+	Next()
+	Get() *record.Record
+}
+
+/*
+MergingIterator merges sorted iterators into one, keeping them in a heap ordered by their current records.
+The records come in key order, the versions of a key newest first, so each step costs O(log k) for k iterators.
+Records with the same key and sequence number come in the order of the iterators, so the merge is deterministic.
+*/
+type MergingIterator struct {
+	iterators []Forward
+	heap      mergeHeap
+}
+
+/*
+MakeMergingIterator merges the iterators from their current records.
+
+Parameters:
+  - iterators: Iterators of the merge, in ascending key order or in descending order if descending is set.
+  - descending: The iterators move from greater keys to smaller ones, like the iterators returned by Reversed.
+*/
+func MakeMergingIterator(iterators []Forward, descending bool) *MergingIterator {
+	mi := &MergingIterator{
+		iterators: iterators,
+		heap:      mergeHeap{descending: descending},
+	}
+	mi.Reset()
+	return mi
+}
+
+// Reset orders the iterators again, it is called after the iterators were moved outside of the merge, like by a seek
+func (mi *MergingIterator) Reset() {
+	mi.heap.items = mi.heap.items[:0]
+	for i, it := range mi.iterators {
+		if it.Valid() {
+			mi.heap.items = append(mi.heap.items, heapItem{iterator: it, rec: it.Get(), index: i})
+		}
+	}
+	heap.Init(&mi.heap)
+}
+
+func (mi *MergingIterator) Valid() bool {
+	return len(mi.heap.items) > 0
+}
+
+// Get returns the first record in the order of the merge
+func (mi *MergingIterator) Get() *record.Record {
+	if !mi.Valid() {
+		return nil
+	}
+	return mi.heap.items[0].rec
+}
+
+// Next moves past the current record, only the iterator holding it is moved
+func (mi *MergingIterator) Next() {
+	if !mi.Valid() {
+		return
+	}
+
+	top := &mi.heap.items[0]
+	top.iterator.Next()
+	if !top.iterator.Valid() {
+		heap.Pop(&mi.heap)
+		return
+	}
+	top.rec = top.iterator.Get()
+	heap.Fix(&mi.heap, 0)
+}
+
+// NextVersions returns every version of the current key, newest first, and moves past them, nil at the end
+func (mi *MergingIterator) NextVersions() []*record.Record {
+	if !mi.Valid() {
+		return nil
+	}
+
+	key := mi.Get().GetKey()
+	var versions []*record.Record
+	for mi.Valid() && mi.Get().GetKey() == key {
+		versions = append(versions, mi.Get())
+		mi.Next()
+	}
+	return versions
+}
+
+/*
+Reversed returns the iterator moving backward, Next of the returned iterator is Prev of the given one.
+It is merged by a MergingIterator made with descending set. Versions of a key within one iterator come oldest first
+backward, so the merge orders them newest first only if each iterator holds one version of a key,
+as memtables and SSTables do.
+*/
+func Reversed(it Iterator) Forward {
+	return reversed{it}
+}
+
+type reversed struct {
+	Iterator
+}
+
+func (r reversed) Next() {
+	r.Iterator.Prev()
+}
+
+type heapItem struct {
+	iterator Forward
+	rec      *record.Record // current record of the iterator, kept so comparisons do not call Get
+	index    int            // position of the iterator in the merge, breaks the ties
+}
+
+// mergeHeap implements heap.Interface, the first record in the order of the merge is at the top
+type mergeHeap struct {
+	items      []heapItem
+	descending bool
+}
+
+func (h *mergeHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *mergeHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if a.rec.GetKey() != b.rec.GetKey() {
+		return (a.rec.GetKey() < b.rec.GetKey()) != h.descending
+	}
+	if a.rec.GetSeq() != b.rec.GetSeq() {
+		return a.rec.GetSeq() > b.rec.GetSeq()
+	}
+	return a.index < b.index
+}
+
+func (h *mergeHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+func (h *mergeHeap) Push(x interface{}) {
+	h.items = append(h.items, x.(heapItem))
+}
+
+func (h *mergeHeap) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
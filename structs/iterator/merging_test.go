@@ -0,0 +1,244 @@
+package iterator
+
+import (
+	"fmt"
+	"key-value-engine/structs/record"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const BENCH_RECORDS = 100000
+
+// sliceIterator walks sorted records, the memtable iterators cannot be used here since memtable imports this package
+type sliceIterator struct {
+	recs []*record.Record
+	pos  int
+}
+
+func (s *sliceIterator) Valid() bool {
+	return s.pos >= 0 && s.pos < len(s.recs)
+}
+
+func (s *sliceIterator) Next() {
+	s.pos++
+}
+
+func (s *sliceIterator) Prev() {
+	s.pos--
+}
+
+func (s *sliceIterator) Seek(key string) {
+	s.pos = sort.Search(len(s.recs), func(i int) bool {
+		return s.recs[i].GetKey() >= key
+	})
+}
+
+func (s *sliceIterator) SeekToLast() {
+	s.pos = len(s.recs) - 1
+}
+
+func (s *sliceIterator) Get() *record.Record {
+	if !s.Valid() {
+		return nil
+	}
+	return s.recs[s.pos]
+}
+
+// spread deals the records round-robin over the sources, so every source stays sorted and each step of a merge moves to another one
+func spread(records, sources int) [][]*record.Record {
+	spread := make([][]*record.Record, sources)
+	for i := 0; i < records; i++ {
+		rec := record.MakeRecord(fmt.Sprintf("bench%09d", i), nil, false, uint64(i))
+		spread[i%sources] = append(spread[i%sources], rec)
+	}
+	return spread
+}
+
+func makeSources(spread [][]*record.Record) []Forward {
+	sources := make([]Forward, len(spread))
+	for i, recs := range spread {
+		sources[i] = &sliceIterator{recs: recs}
+	}
+	return sources
+}
+
+// mergeWithHeap merges the sources with the merging iterator and returns the number of keys
+func mergeWithHeap(sources []Forward) int {
+	keys := 0
+	merge := MakeMergingIterator(sources, false)
+	for merge.Valid() {
+		merge.NextVersions()
+		keys++
+	}
+	return keys
+}
+
+// mergeLinear merges the sources by scanning all of them for the least key on every step, the way merges were done before the heap
+func mergeLinear(sources []Forward) int {
+	keys := 0
+	versions := make([]*record.Record, 0, len(sources))
+	for {
+		least := ""
+		found := false
+		for _, source := range sources {
+			if source.Valid() && (!found || source.Get().GetKey() < least) {
+				least = source.Get().GetKey()
+				found = true
+			}
+		}
+		if !found {
+			return keys
+		}
+		versions = versions[:0]
+		for _, source := range sources {
+			for source.Valid() && source.Get().GetKey() == least {
+				versions = append(versions, source.Get())
+				source.Next()
+			}
+		}
+		keys++
+	}
+}
+
+// source makes a sorted source of records written as key@seq, the value of each record is its source and key@seq
+func source(name string, recs ...string) *sliceIterator {
+	it := &sliceIterator{}
+	for _, rec := range recs {
+		key, seq, _ := strings.Cut(rec, "@")
+		var seqNum uint64
+		fmt.Sscan(seq, &seqNum)
+		it.recs = append(it.recs, record.MakeRecord(key, []byte(name+":"+rec), false, seqNum))
+	}
+	return it
+}
+
+/*
+sources returns the sources of the ordering tests, each holds one version of a key like a memtable or an SSTable.
+The versions of b are in every source and b@5 is in s1 and s2, so their tie is broken by the order of the sources.
+*/
+func sources() []*sliceIterator {
+	return []*sliceIterator{
+		source("s0", "a@1", "b@3", "d@2"),
+		source("s1", "b@5", "c@4", "d@9"),
+		source("s2", "a@7", "b@5", "e@6"),
+		source("s3", "b@2", "c@8"),
+	}
+}
+
+// collect moves through the merge with Get and Next and returns the values of the records
+func collect(mi *MergingIterator) []string {
+	var values []string
+	for ; mi.Valid(); mi.Next() {
+		values = append(values, string(mi.Get().GetValue()))
+	}
+	return values
+}
+
+func TestMergingIteratorOrder(t *testing.T) {
+	var forward []Forward
+	for _, it := range sources() {
+		forward = append(forward, it)
+	}
+
+	got := collect(MakeMergingIterator(forward, false))
+	want := []string{"s2:a@7", "s0:a@1", "s1:b@5", "s2:b@5", "s0:b@3", "s3:b@2", "s3:c@8", "s1:c@4", "s1:d@9", "s0:d@2", "s2:e@6"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMergingIteratorNextVersions(t *testing.T) {
+	var forward []Forward
+	for _, it := range sources() {
+		forward = append(forward, it)
+	}
+	mi := MakeMergingIterator(forward, false)
+
+	want := [][]string{{"s2:a@7", "s0:a@1"}, {"s1:b@5", "s2:b@5", "s0:b@3", "s3:b@2"}, {"s3:c@8", "s1:c@4"}, {"s1:d@9", "s0:d@2"}, {"s2:e@6"}}
+	for _, wantVersions := range want {
+		var got []string
+		for _, rec := range mi.NextVersions() {
+			got = append(got, string(rec.GetValue()))
+		}
+		if strings.Join(got, " ") != strings.Join(wantVersions, " ") {
+			t.Errorf("got %v, want %v", got, wantVersions)
+		}
+	}
+	if versions := mi.NextVersions(); versions != nil || mi.Valid() {
+		t.Errorf("after the last key: got %d versions, valid %v", len(versions), mi.Valid())
+	}
+}
+
+// TestMergingIteratorDescending checks that reversed sources come with descending keys, the versions of a key still newest first
+func TestMergingIteratorDescending(t *testing.T) {
+	var backward []Forward
+	for _, it := range sources() {
+		it.SeekToLast()
+		backward = append(backward, Reversed(it))
+	}
+
+	got := collect(MakeMergingIterator(backward, true))
+	want := []string{"s2:e@6", "s1:d@9", "s0:d@2", "s3:c@8", "s1:c@4", "s1:b@5", "s2:b@5", "s0:b@3", "s3:b@2", "s2:a@7", "s0:a@1"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// TestMergingIteratorReset checks that the merge follows sources moved by a seek after Reset
+func TestMergingIteratorReset(t *testing.T) {
+	its := sources()
+	var forward []Forward
+	for _, it := range its {
+		forward = append(forward, it)
+	}
+	mi := MakeMergingIterator(forward, false)
+
+	for _, it := range its {
+		it.Seek("c")
+	}
+	mi.Reset()
+
+	got := collect(mi)
+	want := []string{"s3:c@8", "s1:c@4", "s1:d@9", "s0:d@2", "s2:e@6"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMergesAgree(t *testing.T) {
+	recs := spread(1000, 7)
+	if keys := mergeWithHeap(makeSources(recs)); keys != 1000 {
+		t.Errorf("heap merge: got %d keys, want 1000", keys)
+	}
+	if keys := mergeLinear(makeSources(recs)); keys != 1000 {
+		t.Errorf("linear merge: got %d keys, want 1000", keys)
+	}
+}
+
+func benchmarkMerge(b *testing.B, merge func([]Forward) int) {
+	for _, count := range []int{2, 8, 32, 128} {
+		b.Run(fmt.Sprintf("sources=%d", count), func(b *testing.B) {
+			recs := spread(BENCH_RECORDS, count)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				sources := makeSources(recs)
+				b.StartTimer()
+				if keys := merge(sources); keys != BENCH_RECORDS {
+					b.Fatalf("got %d keys, want %d", keys, BENCH_RECORDS)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkMergingIterator merges the records spread over the sources with the heap, O(log k) per record for k sources
+func BenchmarkMergingIterator(b *testing.B) {
+	benchmarkMerge(b, mergeWithHeap)
+}
+
+// BenchmarkLinearMerge is the baseline of BenchmarkMergingIterator, O(k) per record for k sources
+func BenchmarkLinearMerge(b *testing.B) {
+	benchmarkMerge(b, mergeLinear)
+}
@@ -3,13 +3,16 @@ package cache
 import (
 	"container/list"
 	"key-value-engine/structs/record"
+	"sync"
 )
 
 // LRUCache represents a simple implementation of an LRU cache with Record instances.
+// It is safe for concurrent use, since even Get reorders the list.
 type LRUCache struct {
 	Capacity      int
 	CacheElements map[string]*list.Element
 	KeyList       *list.List
+	lock          sync.Mutex
 }
 
 // NewLRUCache creates a new LRUCache with the given capacity.
@@ -24,6 +27,7 @@ func NewLRUCache(capacity int) *LRUCache {
 /*
 Get retrieves the Record associated with the given key from the cache.
 If the key is found, it is moved to the front of the LRU list.
+An expired record is removed from the cache and reported as not found.
 
 Parameters:
   - key: A string representing the key to be retrieved.
@@ -33,9 +37,18 @@ Returns:
   - bool: Indicates whether the key was found in the cache.
 */
 func (lru *LRUCache) Get(key string) (*record.Record, bool) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
 	if elem, exists := lru.CacheElements[key]; exists {
+		rec := elem.Value.(*record.Record)
+		if rec.IsExpired() {
+			lru.KeyList.Remove(elem)
+			delete(lru.CacheElements, key)
+			return nil, false
+		}
 		lru.KeyList.MoveToFront(elem)
-		return elem.Value.(*record.Record), true
+		return rec, true
 	}
 	return nil, false
 }
@@ -43,12 +56,25 @@ func (lru *LRUCache) Get(key string) (*record.Record, bool) {
 /*
 Put adds a Record to the cache. If the key already exists, it updates the Record and moves it to the front.
 If the cache is at capacity, it removes the least recently used element.
+A merge record removes the key from the cache instead.
 
 Parameters:
   - rec: Pointer to a Record instance to be added or updated in the cache.
 */
 func (lru *LRUCache) Put(rec *record.Record) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
 	key := rec.GetKey()
+	if rec.IsMerge() {
+		// the value of the key is only known once the operand is merged on a read
+		if elem, exists := lru.CacheElements[key]; exists {
+			lru.KeyList.Remove(elem)
+			delete(lru.CacheElements, key)
+		}
+		return
+	}
+
 	if elem, exists := lru.CacheElements[key]; exists {
 		if rec.IsTombstone() {
 			lru.KeyList.Remove(elem)
@@ -69,3 +95,22 @@ func (lru *LRUCache) Put(rec *record.Record) {
 	elem := lru.KeyList.PushFront(rec)
 	lru.CacheElements[key] = elem
 }
+
+/*
+RemoveRange removes the Records with keys within [start, end] from the cache.
+
+Parameters:
+  - start: First key of the range.
+  - end: Last key of the range.
+*/
+func (lru *LRUCache) RemoveRange(start, end string) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	for key, elem := range lru.CacheElements {
+		if key >= start && key <= end {
+			lru.KeyList.Remove(elem)
+			delete(lru.CacheElements, key)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"fmt"
+	"key-value-engine/structs/record"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentAccess runs Get, Put and RemoveRange from several goroutines, run it with -race
+func TestConcurrentAccess(t *testing.T) {
+	lru := NewLRUCache(16)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("key%02d", (g*7+i)%40)
+				switch i % 5 {
+				case 0:
+					lru.Put(record.MakeRecord(key, []byte(key), false, uint64(i)))
+				case 1:
+					lru.RemoveRange("key10", "key15")
+				default:
+					if rec, found := lru.Get(key); found && rec.GetKey() != key {
+						t.Errorf("get %s returned %s", key, rec.GetKey())
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if lru.KeyList.Len() > lru.Capacity || lru.KeyList.Len() != len(lru.CacheElements) {
+		t.Errorf("list has %d elements, map %d, capacity %d", lru.KeyList.Len(), len(lru.CacheElements), lru.Capacity)
+	}
+}
@@ -2,10 +2,16 @@ package memtable
 
 import (
 	"key-value-engine/structs/iterator"
+	"key-value-engine/structs/mergeOperator"
 	"key-value-engine/structs/record"
 	"key-value-engine/structs/sstable"
+	"sort"
 )
 
+// MemManager is not safe for concurrent use on its own. The DB guards it with its
+// read-write lock: FindInMem and iterator creation run under the read lock,
+// PutMem together with table switches and flushes runs under the write lock.
+// Memtable iterators copy their records when created, so they can be used after the lock is released.
 type MemManager struct {
 	currentTable *MemTable
 	tables       []*MemTable
@@ -13,6 +19,7 @@ type MemManager struct {
 	currentIndex int
 	maxTables    int
 	initialFill  bool
+	lastSeq      uint64 // greatest sequence number put into the memtables
 }
 
 /*
@@ -44,7 +51,7 @@ func MakeMemTableManager(maxTables int, maxCapacity int, structType string, sstm
 
 // FlushMem flush oldest memtable/create sstable/flush wal
 func (mm *MemManager) FlushMem() error {
-	err := mm.sstmanager.Flush(mm.currentTable.GetSorted())
+	err := mm.sstmanager.Flush(mm.currentTable.GetSorted(), mm.currentTable.GetRangeTombstones())
 	if err != nil {
 		return err
 	}
@@ -53,6 +60,29 @@ func (mm *MemManager) FlushMem() error {
 	return nil
 }
 
+// FlushAll flushes every memtable holding records, oldest first, and starts filling the tables again from the first one.
+// It is used when the memtables hold back the deletion of a write-ahead log shared with other managers.
+func (mm *MemManager) FlushAll() error {
+	for i := 1; i <= mm.maxTables; i++ {
+		table := mm.tables[(mm.currentIndex+i)%mm.maxTables]
+		if table.capacity == 0 {
+			continue
+		}
+
+		err := mm.sstmanager.Flush(table.GetSorted(), table.GetRangeTombstones())
+		if err != nil {
+			return err
+		}
+		table.Clear()
+	}
+
+	mm.currentIndex = 0
+	mm.currentTable = mm.tables[0]
+	mm.initialFill = false
+
+	return nil
+}
+
 func (mm *MemManager) SwitchTable() {
 	// Switch to the next table
 	if mm.currentIndex == mm.maxTables-1 {
@@ -64,8 +94,42 @@ func (mm *MemManager) SwitchTable() {
 
 // PutMem add new element to the current memtable
 func (mm *MemManager) PutMem(rec *record.Record) (bool, bool, error) {
-	mm.currentTable.Put(rec)
+	mm.currentTable.Put(mm.mergeInTable(rec))
+	mm.updateLastSeq(rec)
+
+	return mm.checkCapacity()
+}
+
+// PutBatch adds all records of a batch to the current memtable before its capacity is checked,
+// so a batch is never split between two memtables
+func (mm *MemManager) PutBatch(records []*record.Record) (bool, bool, error) {
+	for _, rec := range records {
+		mm.currentTable.Put(mm.mergeInTable(rec))
+		mm.updateLastSeq(rec)
+	}
 
+	return mm.checkCapacity()
+}
+
+// mergeInTable folds a merge record into the version of its key in the current table,
+// since a table keeps a single version of every key
+func (mm *MemManager) mergeInTable(rec *record.Record) *record.Record {
+	if !rec.IsMerge() {
+		return rec
+	}
+
+	versions := []*record.Record{rec}
+	_, existing := mm.currentTable.Find(rec.GetKey())
+	if existing != nil {
+		versions = append(versions, existing)
+	}
+	rangeSeq := record.CoveringSeq(mm.currentTable.rangeTombstones, rec.GetKey())
+
+	return mergeOperator.Fold(mm.sstmanager.MergeOperator(), rec.GetKey(), versions, rangeSeq, false)
+}
+
+// checkCapacity switches to the next table if the current one is full, flushing the oldest table once all are filled
+func (mm *MemManager) checkCapacity() (bool, bool, error) {
 	if mm.currentTable.capacity >= mm.currentTable.maxCapacity {
 		mm.SwitchTable()
 		if mm.initialFill { //if all the tables have been filled
@@ -80,19 +144,110 @@ func (mm *MemManager) PutMem(rec *record.Record) (bool, bool, error) {
 	return false, false, nil
 }
 
+func (mm *MemManager) updateLastSeq(rec *record.Record) {
+	if rec.GetSeq() > mm.lastSeq {
+		mm.lastSeq = rec.GetSeq()
+	}
+}
+
+// LastSeq returns the greatest sequence number put into the memtables, including the ones restored from the WAL
+func (mm *MemManager) LastSeq() uint64 {
+	return mm.lastSeq
+}
+
+// FlushedSeq returns the greatest sequence number written to the SSTables, records up to it are not restored from the WAL
+func (mm *MemManager) FlushedSeq() uint64 {
+	return mm.sstmanager.LastSeq()
+}
+
 func (mm *MemManager) GetCurrentTable() *MemTable {
 	return mm.currentTable
 }
 
-// FindInMem find if element exists in any of the memtables
+// FindInMem find if element exists in any of the memtables, searching from the newest table.
+// Tombstones are returned as found, so that the caller knows the key was deleted.
+// A key deleted by a range tombstone is returned as a tombstone with the sequence number of the range tombstone,
+// the range tombstones in the memtables are newer than any version in the SSTables.
 func (mm *MemManager) FindInMem(key string) (bool, *record.Record) {
+	var found *record.Record
+	var rangeSeq uint64
 	for i := 0; i < mm.maxTables; i++ {
-		m := (mm.currentIndex - i) % mm.maxTables
-		found, el := mm.tables[m].Find(key)
-		return found, el
+		m := (mm.currentIndex - i + mm.maxTables) % mm.maxTables
+		if found == nil {
+			_, found = mm.tables[m].Find(key)
+		}
+		if seq := record.CoveringSeq(mm.tables[m].rangeTombstones, key); seq > rangeSeq {
+			rangeSeq = seq
+		}
+	}
 
+	if rangeSeq > 0 && (found == nil || found.GetSeq() < rangeSeq) {
+		return true, record.MakeRecord(key, nil, true, rangeSeq)
 	}
-	return false, nil
+	return found != nil, found
+}
+
+// FindVersionsInMem returns the versions of the key in the memtables, newest first, stopping at the first one
+// that is not a merge record, together with the sequence number of the newest range tombstone covering the key
+func (mm *MemManager) FindVersionsInMem(key string) ([]*record.Record, uint64) {
+	var versions []*record.Record
+	var rangeSeq uint64
+	done := false
+	for i := 0; i < mm.maxTables; i++ {
+		m := (mm.currentIndex - i + mm.maxTables) % mm.maxTables
+		if !done {
+			_, found := mm.tables[m].Find(key)
+			if found != nil {
+				versions = append(versions, found)
+				done = !found.IsMerge()
+			}
+		}
+		if seq := record.CoveringSeq(mm.tables[m].rangeTombstones, key); seq > rangeSeq {
+			rangeSeq = seq
+		}
+	}
+
+	return versions, rangeSeq
+}
+
+// GetRangeTombstones returns the range tombstones of all memtables
+func (mm *MemManager) GetRangeTombstones() []*record.Record {
+	var rangeTombstones []*record.Record
+	for _, table := range mm.tables {
+		rangeTombstones = append(rangeTombstones, table.rangeTombstones...)
+	}
+	return rangeTombstones
+}
+
+/*
+Freeze returns the newest version of every key in the memtables, sorted by key.
+Tombstones are kept, so the deleted keys hide their older versions in the SSTables.
+Merge records are folded with the older versions in the memtables, the result is still a merge record
+if none of them is a put or a tombstone.
+The returned records are not changed by later writes.
+*/
+func (mm *MemManager) Freeze() []*record.Record {
+	versions := make(map[string][]*record.Record)
+	for _, table := range mm.tables {
+		for _, rec := range table.GetSorted() {
+			versions[rec.GetKey()] = append(versions[rec.GetKey()], rec)
+		}
+	}
+
+	rangeTombstones := mm.GetRangeTombstones()
+	records := make([]*record.Record, 0, len(versions))
+	for key, keyVersions := range versions {
+		sort.Slice(keyVersions, func(i, j int) bool {
+			return keyVersions[i].GetSeq() > keyVersions[j].GetSeq()
+		})
+		rangeSeq := record.CoveringSeq(rangeTombstones, key)
+		records = append(records, mergeOperator.Fold(mm.sstmanager.MergeOperator(), key, keyVersions, rangeSeq, false))
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].GetKey() < records[j].GetKey()
+	})
+
+	return records
 }
 
 func (mm *MemManager) GetMemRangeIterators(minRange, maxRange string) []iterator.Iterator {
@@ -9,14 +9,17 @@ import (
 )
 
 // keys exists to be able to sort hashmap
+// range tombstones are kept aside, but they count towards the capacity like any other record,
+// so a table written only with DeleteRange is switched and flushed too
 type MemTable struct {
-	maxCapacity int
-	capacity    int
-	structType  string
-	skipList    *skipList.SkipList
-	bTree       *btree.BTree
-	hashMap     map[string]*record.Record
-	keys        []string
+	maxCapacity     int
+	capacity        int
+	structType      string
+	skipList        *skipList.SkipList
+	bTree           *btree.BTree
+	hashMap         map[string]*record.Record
+	keys            []string
+	rangeTombstones []*record.Record
 }
 
 /*
@@ -74,6 +77,7 @@ func (mem *MemTable) Clear() {
 		mem.keys = []string{}
 	}
 
+	mem.rangeTombstones = nil
 	mem.capacity = 0
 }
 
@@ -94,7 +98,9 @@ func (mem *MemTable) Find(key string) (bool, *record.Record) {
 
 // Put - adds elements (if need be, replaces)
 func (mem *MemTable) Put(rec *record.Record) {
-	if mem.structType == "btree" {
+	if rec.IsRangeTombstone() {
+		mem.rangeTombstones = append(mem.rangeTombstones, rec)
+	} else if mem.structType == "btree" {
 		mem.bTree.Insert(rec)
 	} else if mem.structType == "skiplist" {
 		mem.skipList.Insert(rec)
@@ -125,6 +131,13 @@ func (mem *MemTable) GetSorted() []*record.Record {
 	return mem.getSortedMap() //hashmap
 }
 
+// GetRangeTombstones returns a copy of the range tombstones put into the table
+func (mem *MemTable) GetRangeTombstones() []*record.Record {
+	rangeTombstones := make([]*record.Record, len(mem.rangeTombstones))
+	copy(rangeTombstones, mem.rangeTombstones)
+	return rangeTombstones
+}
+
 func (mem *MemTable) GetRangeIterator(minRange, maxRange string) iterator.Iterator {
 	if mem.structType == "btree" {
 		return mem.bTree.NewBTreeRangeIterator(minRange, maxRange)
@@ -145,13 +158,15 @@ func (mem *MemTable) GetPrefixIterator(prefix string) iterator.Iterator {
 	return mem.NewMapPrefixIterator(prefix)
 }
 
-// getSortedMap returns sorted hashmap
+// getSortedMap returns sorted hashmap, the keys are sorted in a copy so readers can share the table
 func (mem *MemTable) getSortedMap() []*record.Record {
-	sort.Strings(mem.keys)
+	keys := make([]string, len(mem.keys))
+	copy(keys, mem.keys)
+	sort.Strings(keys)
 
 	var ret []*record.Record
-	for i := 0; i < len(mem.keys); i++ {
-		ret = append(ret, mem.hashMap[mem.keys[i]])
+	for i := 0; i < len(keys); i++ {
+		ret = append(ret, mem.hashMap[keys[i]])
 	}
 
 	return ret
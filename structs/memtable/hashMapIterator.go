@@ -7,52 +7,68 @@ import (
 	"strings"
 )
 
+// MapIterator works on a sorted copy of the keys and records, so it stays valid
+// while the memtable keeps changing.
 type MapIterator struct {
 	minRange      string
 	maxRange      string
 	prefix        string
 	keys          []string
 	index         int
-	data          map[string]*record.Record // Replace YourRecord with the actual type of your records
+	data          map[string]*record.Record
 	rangeIterator bool
 }
 
 // NewMapRangeIterator creates a new iterator for a hashmap within memtable
 func (mm *MemTable) NewMapRangeIterator(minRange, maxRange string) iterator.Iterator {
-	sort.Strings(mm.keys)
+	keys, data := mm.copyMap()
 
 	index := 0
-	for index < len(mm.keys) && mm.keys[index] < minRange {
+	for index < len(keys) && keys[index] < minRange {
 		index++
 	}
 
 	return &MapIterator{
 		minRange:      minRange,
 		maxRange:      maxRange,
-		keys:          mm.keys,
+		keys:          keys,
 		index:         index,
-		data:          mm.hashMap,
+		data:          data,
 		rangeIterator: true,
 	}
 }
 
 func (mm *MemTable) NewMapPrefixIterator(prefix string) iterator.Iterator {
-	sort.Strings(mm.keys)
+	keys, data := mm.copyMap()
 
 	index := 0
-	for index < len(mm.keys) && !strings.HasPrefix(mm.keys[index], prefix) {
+	for index < len(keys) && !strings.HasPrefix(keys[index], prefix) {
 		index++
 	}
 
 	return &MapIterator{
 		prefix:        prefix,
-		keys:          mm.keys,
+		keys:          keys,
 		index:         index,
-		data:          mm.hashMap,
+		data:          data,
 		rangeIterator: false,
 	}
 }
 
+// copyMap returns sorted copy of the keys and copy of the hashmap
+func (mm *MemTable) copyMap() ([]string, map[string]*record.Record) {
+	keys := make([]string, len(mm.keys))
+	copy(keys, mm.keys)
+	sort.Strings(keys)
+
+	data := make(map[string]*record.Record, len(mm.hashMap))
+	for k, v := range mm.hashMap {
+		data[k] = v
+	}
+
+	return keys, data
+}
+
 // Valid checks if the iterator is in a valid state.
 func (it *MapIterator) Valid() bool {
 	return it.index >= 0 && it.index < len(it.keys) && it.checkStopCondition()
@@ -63,6 +79,24 @@ func (it *MapIterator) Next() {
 	it.index++
 }
 
+// Prev moves the iterator to the previous element.
+func (it *MapIterator) Prev() {
+	it.index--
+}
+
+// Seek moves the iterator to the first element with a key not less than the given one.
+func (it *MapIterator) Seek(key string) {
+	key = it.startKey(key)
+	it.index = sort.SearchStrings(it.keys, key)
+}
+
+// SeekToLast moves the iterator to the last element.
+func (it *MapIterator) SeekToLast() {
+	it.index = sort.Search(len(it.keys), func(i int) bool {
+		return it.pastEnd(it.keys[i])
+	}) - 1
+}
+
 // Get returns the record at the current iterator position.
 func (it *MapIterator) Get() *record.Record {
 	key := it.keys[it.index]
@@ -71,8 +105,27 @@ func (it *MapIterator) Get() *record.Record {
 
 func (it *MapIterator) checkStopCondition() bool {
 	if it.rangeIterator {
-		return it.keys[it.index] <= it.maxRange
+		return it.keys[it.index] >= it.minRange && it.keys[it.index] <= it.maxRange
 	} else {
 		return strings.HasPrefix(it.keys[it.index], it.prefix)
 	}
 }
+
+// startKey returns the key a seek starts from, keys before the range or the prefix are never visited
+func (it *MapIterator) startKey(key string) string {
+	if it.rangeIterator && key < it.minRange {
+		return it.minRange
+	}
+	if !it.rangeIterator && key < it.prefix {
+		return it.prefix
+	}
+	return key
+}
+
+// pastEnd reports whether the key comes after the range or the keys with the prefix
+func (it *MapIterator) pastEnd(key string) bool {
+	if it.rangeIterator {
+		return key > it.maxRange
+	}
+	return key > it.prefix && !strings.HasPrefix(key, it.prefix)
+}
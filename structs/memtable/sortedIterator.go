@@ -0,0 +1,110 @@
+package memtable
+
+import (
+	"key-value-engine/structs/iterator"
+	"key-value-engine/structs/record"
+	"sort"
+	"strings"
+)
+
+// SortedIterator iterates over records already sorted by key, such as the ones returned by Freeze.
+type SortedIterator struct {
+	minRange      string
+	maxRange      string
+	prefix        string
+	records       []*record.Record
+	index         int
+	rangeIterator bool
+}
+
+// MakeSortedRangeIterator creates a new iterator over the sorted records within [minRange, maxRange]
+func MakeSortedRangeIterator(records []*record.Record, minRange, maxRange string) iterator.Iterator {
+	index := sort.Search(len(records), func(i int) bool {
+		return records[i].GetKey() >= minRange
+	})
+
+	return &SortedIterator{
+		minRange:      minRange,
+		maxRange:      maxRange,
+		records:       records,
+		index:         index,
+		rangeIterator: true,
+	}
+}
+
+// MakeSortedPrefixIterator creates a new iterator over the sorted records with keys starting with the prefix
+func MakeSortedPrefixIterator(records []*record.Record, prefix string) iterator.Iterator {
+	index := sort.Search(len(records), func(i int) bool {
+		return records[i].GetKey() >= prefix
+	})
+
+	return &SortedIterator{
+		prefix:        prefix,
+		records:       records,
+		index:         index,
+		rangeIterator: false,
+	}
+}
+
+// Valid checks if the iterator is in a valid state.
+func (it *SortedIterator) Valid() bool {
+	return it.index >= 0 && it.index < len(it.records) && it.checkStopCondition()
+}
+
+// Next moves the iterator to the next element.
+func (it *SortedIterator) Next() {
+	it.index++
+}
+
+// Prev moves the iterator to the previous element.
+func (it *SortedIterator) Prev() {
+	it.index--
+}
+
+// Seek moves the iterator to the first element with a key not less than the given one.
+func (it *SortedIterator) Seek(key string) {
+	key = it.startKey(key)
+	it.index = sort.Search(len(it.records), func(i int) bool {
+		return it.records[i].GetKey() >= key
+	})
+}
+
+// SeekToLast moves the iterator to the last element.
+func (it *SortedIterator) SeekToLast() {
+	it.index = sort.Search(len(it.records), func(i int) bool {
+		return it.pastEnd(it.records[i].GetKey())
+	}) - 1
+}
+
+// Get returns the record at the current iterator position.
+func (it *SortedIterator) Get() *record.Record {
+	return it.records[it.index]
+}
+
+func (it *SortedIterator) checkStopCondition() bool {
+	key := it.records[it.index].GetKey()
+	if it.rangeIterator {
+		return key >= it.minRange && key <= it.maxRange
+	} else {
+		return strings.HasPrefix(key, it.prefix)
+	}
+}
+
+// startKey returns the key a seek starts from, keys before the range or the prefix are never visited
+func (it *SortedIterator) startKey(key string) string {
+	if it.rangeIterator && key < it.minRange {
+		return it.minRange
+	}
+	if !it.rangeIterator && key < it.prefix {
+		return it.prefix
+	}
+	return key
+}
+
+// pastEnd reports whether the key comes after the range or the keys with the prefix
+func (it *SortedIterator) pastEnd(key string) bool {
+	if it.rangeIterator {
+		return key > it.maxRange
+	}
+	return key > it.prefix && !strings.HasPrefix(key, it.prefix)
+}
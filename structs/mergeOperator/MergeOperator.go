@@ -0,0 +1,162 @@
+package mergeOperator
+
+import (
+	"key-value-engine/structs/record"
+	"strings"
+	"time"
+)
+
+/*
+MergeOperator combines the operands written with DB.Merge into the value of a key.
+Operands are stored as merge records and folded lazily, when the key is read or compacted,
+so an operator must be deterministic and the same operator must be used every time the database is opened.
+*/
+type MergeOperator interface {
+	// FullMerge applies the operands, oldest first, to the existing value, which is nil if the key is absent.
+	// Returning false leaves the key absent.
+	FullMerge(key string, existing []byte, operands [][]byte) ([]byte, bool)
+
+	// PartialMerge combines two operands into one, it is used when the older versions of the key are not at hand.
+	PartialMerge(key string, older, newer []byte) []byte
+}
+
+/*
+Fold resolves the versions of a key, newest first, into the record that represents them.
+Merge records are applied on top of the first older put or tombstone, a version older than rangeSeq
+is treated as deleted by a range tombstone. If the newest version is not a merge record it is returned unchanged.
+
+Parameters:
+  - operator: Operator combining the merge operands.
+  - key: Key of the versions.
+  - versions: Versions of the key sorted by decreasing sequence number.
+  - rangeSeq: Sequence number of the newest range tombstone covering the key, 0 if none covers it.
+  - complete: Indicates whether no version of the key is older than the given ones.
+
+Returns:
+  - *record.Record: A put or a tombstone with the sequence number of the newest version once the merge operands
+    reach their base, otherwise a merge record holding all operands combined into one. Nil if there are no versions.
+*/
+func Fold(operator MergeOperator, key string, versions []*record.Record, rangeSeq uint64, complete bool) *record.Record {
+	if len(versions) == 0 {
+		return nil
+	}
+	newest := versions[0]
+	if !newest.IsMerge() || newest.GetSeq() < rangeSeq {
+		return newest
+	}
+
+	// a covering range tombstone deletes every version older than the given ones
+	complete = complete || rangeSeq > 0
+
+	var operands [][]byte
+	var base *record.Record
+	for _, version := range versions {
+		if version.GetSeq() < rangeSeq {
+			break
+		}
+		if !version.IsMerge() {
+			base = version
+			complete = true
+			break
+		}
+		operands = append(operands, version.GetValue())
+	}
+
+	// operands were collected newest first
+	for i, j := 0, len(operands)-1; i < j; i, j = i+1, j-1 {
+		operands[i], operands[j] = operands[j], operands[i]
+	}
+
+	if !complete {
+		operand := operands[0]
+		for _, newer := range operands[1:] {
+			operand = operator.PartialMerge(key, operand, newer)
+		}
+		return record.MakeMergeRecord(key, operand, newest.GetSeq())
+	}
+
+	var existing []byte
+	var expiresAt uint64
+	if base != nil && base.IsLive() {
+		existing = base.GetValue()
+		expiresAt = base.GetExpiresAt()
+	}
+
+	value, ok := operator.FullMerge(key, existing, operands)
+	if !ok {
+		return record.MakeRecord(key, nil, true, newest.GetSeq())
+	}
+	if expiresAt != 0 {
+		// merging keeps the deadline of the value the operands were applied to
+		return record.MakeExpiringRecord(key, value, newest.GetSeq(), time.Unix(0, int64(expiresAt)))
+	}
+	return record.MakeRecord(key, value, false, newest.GetSeq())
+}
+
+/*
+PrefixOperator chooses the operator of a key by the longest matching key prefix,
+keys without a matching prefix use the fallback operator.
+*/
+type PrefixOperator struct {
+	routes   map[string]MergeOperator
+	fallback MergeOperator
+}
+
+/*
+MakePrefixOperator creates an operator routing keys by their prefix.
+
+Parameters:
+  - routes: Operators by the key prefix they handle.
+  - fallback: Operator of the keys without a matching prefix, it can be nil.
+*/
+func MakePrefixOperator(routes map[string]MergeOperator, fallback MergeOperator) *PrefixOperator {
+	return &PrefixOperator{
+		routes:   routes,
+		fallback: fallback,
+	}
+}
+
+/*
+For returns the operator of the key, nil if no operator handles it.
+Nested prefix operators are resolved to the operator they choose.
+*/
+func (po *PrefixOperator) For(key string) MergeOperator {
+	var operator MergeOperator
+	longest := -1
+	for prefix, route := range po.routes {
+		if len(prefix) > longest && strings.HasPrefix(key, prefix) {
+			operator = route
+			longest = len(prefix)
+		}
+	}
+
+	if operator == nil {
+		operator = po.fallback
+	}
+	if nested, ok := operator.(*PrefixOperator); ok {
+		return nested.For(key)
+	}
+	return operator
+}
+
+/*
+FullMerge merges with the operator of the key, the operands are ignored if no operator handles it.
+*/
+func (po *PrefixOperator) FullMerge(key string, existing []byte, operands [][]byte) ([]byte, bool) {
+	operator := po.For(key)
+	if operator == nil {
+		return existing, existing != nil
+	}
+	return operator.FullMerge(key, existing, operands)
+}
+
+/*
+PartialMerge merges with the operator of the key, only the newer operand is kept if no operator handles it.
+*/
+func (po *PrefixOperator) PartialMerge(key string, older, newer []byte) []byte {
+	operator := po.For(key)
+	if operator == nil {
+		return newer
+	}
+	return operator.PartialMerge(key, older, newer)
+}
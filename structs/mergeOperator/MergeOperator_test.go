@@ -0,0 +1,114 @@
+package mergeOperator
+
+import (
+	"fmt"
+	"key-value-engine/structs/record"
+	"testing"
+	"time"
+)
+
+var deadline = time.Now().Add(time.Hour)
+
+func put(value string, seq uint64) *record.Record {
+	return record.MakeRecord("key", []byte(value), false, seq)
+}
+
+func del(seq uint64) *record.Record {
+	return record.MakeRecord("key", nil, true, seq)
+}
+
+func merge(operand string, seq uint64) *record.Record {
+	return record.MakeMergeRecord("key", []byte(operand), seq)
+}
+
+// describe writes the record as put:value@seq, del@seq or merge:operand@seq, with +ttl if it expires
+func describe(rec *record.Record) string {
+	if rec == nil {
+		return "nil"
+	}
+	var s string
+	switch {
+	case rec.IsMerge():
+		s = fmt.Sprintf("merge:%s@%d", rec.GetValue(), rec.GetSeq())
+	case rec.IsTombstone():
+		s = fmt.Sprintf("del@%d", rec.GetSeq())
+	default:
+		s = fmt.Sprintf("put:%s@%d", rec.GetValue(), rec.GetSeq())
+	}
+	if rec.GetExpiresAt() != 0 {
+		s += "+ttl"
+	}
+	return s
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []*record.Record
+		rangeSeq uint64
+		complete bool
+		want     string
+	}{
+		{"no versions", nil, 0, true, "nil"},
+		{"newest put", []*record.Record{put("b", 2), merge("a", 1)}, 0, false, "put:b@2"},
+		{"newest tombstone", []*record.Record{del(2), put("a", 1)}, 0, false, "del@2"},
+		{"merges on a put", []*record.Record{merge("c", 3), merge("b", 2), put("a", 1)}, 0, false, "put:a,b,c@3"},
+		{"merges on a tombstone", []*record.Record{merge("c", 3), merge("b", 2), del(1)}, 0, false, "put:b,c@3"},
+		{"only merges, bottommost", []*record.Record{merge("b", 2), merge("a", 1)}, 0, true, "put:a,b@2"},
+		{"only merges, not bottommost", []*record.Record{merge("b", 2), merge("a", 1)}, 0, false, "merge:a,b@2"},
+		{"versions after the base are ignored", []*record.Record{merge("c", 3), put("b", 2), merge("a", 1)}, 0, false, "put:b,c@3"},
+		{"range tombstone under the merges", []*record.Record{merge("d", 4), merge("c", 3), merge("b", 1)}, 2, false, "put:c,d@4"},
+		{"range tombstone over a put", []*record.Record{merge("c", 3), put("a", 1)}, 2, false, "put:c@3"},
+		{"range tombstone over every version", []*record.Record{merge("c", 3), put("a", 1)}, 5, false, "merge:c@3"},
+		{"merges keep the deadline", []*record.Record{merge("b", 2), record.MakeExpiringRecord("key", []byte("a"), 1, deadline)}, 0, false, "put:a,b@2+ttl"},
+		{"expired base", []*record.Record{merge("b", 2), record.MakeExpiringRecord("key", []byte("a"), 1, time.Now().Add(-time.Hour))}, 0, false, "put:b@2"},
+	}
+
+	operator := MakeStringAppendOperator(",")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := describe(Fold(operator, "key", test.versions, test.rangeSeq, test.complete))
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+// TestFoldRejected checks that a merge the operator rejects leaves a tombstone, like operands on a missing structure
+func TestFoldRejected(t *testing.T) {
+	versions := []*record.Record{merge(string(EncodeElements([]byte("a"))), 2), del(1)}
+	got := describe(Fold(MakeBloomFilterAddOperator(), "key", versions, 0, false))
+	if got != "del@2" {
+		t.Errorf("got %s, want del@2", got)
+	}
+}
+
+func TestPrefixOperator(t *testing.T) {
+	operator := MakePrefixOperator(map[string]MergeOperator{
+		"count:":      MakeInt64AddOperator(),
+		"count:text:": MakeStringAppendOperator(","),
+	}, nil)
+
+	tests := []struct {
+		key      string
+		existing []byte
+		want     string
+	}{
+		{"count:a", nil, "3"},
+		{"count:text:a", nil, "1,2"},
+		{"other", []byte("base"), "base"},
+	}
+	for _, test := range tests {
+		value, ok := operator.FullMerge(test.key, test.existing, [][]byte{[]byte("1"), []byte("2")})
+		if !ok || string(value) != test.want {
+			t.Errorf("%s: got %q %v, want %q", test.key, value, ok, test.want)
+		}
+	}
+	if operator.For("other") != nil {
+		t.Error("key without a route and a fallback has an operator")
+	}
+	if got := operator.PartialMerge("other", []byte("1"), []byte("2")); string(got) != "2" {
+		t.Errorf("partial merge without an operator: got %q, want the newer operand", got)
+	}
+}
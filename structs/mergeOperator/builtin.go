@@ -0,0 +1,196 @@
+package mergeOperator
+
+import (
+	"encoding/binary"
+	"key-value-engine/structs/bloomFilter"
+	"key-value-engine/structs/cms"
+	"key-value-engine/structs/hll"
+	"strconv"
+)
+
+/*
+Int64AddOperator keeps a signed 64-bit counter stored as a decimal string.
+Operands are decimal deltas, a missing key starts from 0.
+A malformed value is treated as 0 and a malformed operand is skipped.
+*/
+type Int64AddOperator struct{}
+
+func MakeInt64AddOperator() *Int64AddOperator {
+	return &Int64AddOperator{}
+}
+
+func (op *Int64AddOperator) FullMerge(key string, existing []byte, operands [][]byte) ([]byte, bool) {
+	sum, _ := strconv.ParseInt(string(existing), 10, 64)
+	for _, operand := range operands {
+		delta, err := strconv.ParseInt(string(operand), 10, 64)
+		if err == nil {
+			sum += delta
+		}
+	}
+	return []byte(strconv.FormatInt(sum, 10)), true
+}
+
+func (op *Int64AddOperator) PartialMerge(key string, older, newer []byte) []byte {
+	sum, _ := op.FullMerge(key, nil, [][]byte{older, newer})
+	return sum
+}
+
+/*
+StringAppendOperator appends the operands to the value, separated by the delimiter.
+A missing key starts from the first operand.
+*/
+type StringAppendOperator struct {
+	delimiter []byte
+}
+
+func MakeStringAppendOperator(delimiter string) *StringAppendOperator {
+	return &StringAppendOperator{delimiter: []byte(delimiter)}
+}
+
+func (op *StringAppendOperator) FullMerge(key string, existing []byte, operands [][]byte) ([]byte, bool) {
+	value := append([]byte{}, existing...)
+	for i, operand := range operands {
+		if existing != nil || i > 0 {
+			value = append(value, op.delimiter...)
+		}
+		value = append(value, operand...)
+	}
+	return value, true
+}
+
+func (op *StringAppendOperator) PartialMerge(key string, older, newer []byte) []byte {
+	value := append([]byte{}, older...)
+	value = append(value, op.delimiter...)
+	return append(value, newer...)
+}
+
+/*
+EncodeElements encodes the elements as one operand of the bloom filter, count-min sketch and hyperloglog operators.
+Every element is prefixed with its length, so operands are combined by concatenation.
+*/
+func EncodeElements(elements ...[]byte) []byte {
+	var operand []byte
+	for _, element := range elements {
+		operand = binary.AppendUvarint(operand, uint64(len(element)))
+		operand = append(operand, element...)
+	}
+	return operand
+}
+
+// decodeElements returns the elements of the operands, a malformed operand is skipped
+func decodeElements(operands [][]byte) [][]byte {
+	var elements [][]byte
+	for _, operand := range operands {
+		var decoded [][]byte
+		for len(operand) > 0 {
+			size, n := binary.Uvarint(operand)
+			if n <= 0 || uint64(len(operand)-n) < size {
+				decoded = nil
+				break
+			}
+			// the capacity is limited, so appending to an element can not overwrite the next one
+			decoded = append(decoded, operand[n:n+int(size):n+int(size)])
+			operand = operand[n+int(size):]
+		}
+		elements = append(elements, decoded...)
+	}
+	return elements
+}
+
+// elementsOperator combines element operands, it is shared by the structure operators
+type elementsOperator struct{}
+
+func (op elementsOperator) PartialMerge(key string, older, newer []byte) []byte {
+	return append(append([]byte{}, older...), newer...)
+}
+
+/*
+BloomFilterAddOperator adds the elements of the operands to a serialized bloom filter.
+The filter has to be created with a put first, operands on a missing key leave it absent
+and an unreadable filter is left unchanged.
+*/
+type BloomFilterAddOperator struct {
+	elementsOperator
+}
+
+func MakeBloomFilterAddOperator() *BloomFilterAddOperator {
+	return &BloomFilterAddOperator{}
+}
+
+func (op *BloomFilterAddOperator) FullMerge(key string, existing []byte, operands [][]byte) ([]byte, bool) {
+	if existing == nil {
+		return nil, false
+	}
+
+	obj, err := bloomFilter.BytesToBloomFilter(existing)
+	if err != nil {
+		return existing, true
+	}
+	for _, element := range decodeElements(operands) {
+		obj.Add(element)
+	}
+	return obj.BloomFilterToBytes(), true
+}
+
+/*
+CMSAddOperator adds the elements of the operands to a serialized count-min sketch.
+The sketch has to be created with a put first, operands on a missing key leave it absent
+and an unreadable sketch is left unchanged.
+*/
+type CMSAddOperator struct {
+	elementsOperator
+}
+
+func MakeCMSAddOperator() *CMSAddOperator {
+	return &CMSAddOperator{}
+}
+
+func (op *CMSAddOperator) FullMerge(key string, existing []byte, operands [][]byte) ([]byte, bool) {
+	if existing == nil {
+		return nil, false
+	}
+
+	obj, err := cms.BytesToCMS(existing)
+	if err != nil {
+		return existing, true
+	}
+	for _, element := range decodeElements(operands) {
+		obj.Add(element)
+	}
+	return obj.CMSToBytes(), true
+}
+
+/*
+HLLAddOperator adds the elements of the operands to a serialized hyperloglog.
+The hyperloglog has to be created with a put first, operands on a missing key leave it absent
+and an unreadable hyperloglog is left unchanged.
+*/
+type HLLAddOperator struct {
+	elementsOperator
+}
+
+func MakeHLLAddOperator() *HLLAddOperator {
+	return &HLLAddOperator{}
+}
+
+func (op *HLLAddOperator) FullMerge(key string, existing []byte, operands [][]byte) ([]byte, bool) {
+	if existing == nil {
+		return nil, false
+	}
+
+	obj, err := hll.BytesToHLL(existing)
+	if err != nil {
+		return existing, true
+	}
+	for _, element := range decodeElements(operands) {
+		if obj.Add(element) != nil {
+			return existing, true
+		}
+	}
+
+	objBytes, err := obj.HLLToBytes()
+	if err != nil {
+		return existing, true
+	}
+	return objBytes, true
+}
@@ -0,0 +1,119 @@
+package mergeOperator
+
+import (
+	"key-value-engine/structs/bloomFilter"
+	"key-value-engine/structs/record"
+	"testing"
+)
+
+func operands(values ...string) [][]byte {
+	var result [][]byte
+	for _, value := range values {
+		result = append(result, []byte(value))
+	}
+	return result
+}
+
+func TestInt64Add(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []byte
+		operands [][]byte
+		want     string
+	}{
+		{"missing key", nil, operands("1", "2"), "3"},
+		{"existing value", []byte("10"), operands("-3"), "7"},
+		{"malformed value", []byte("ten"), operands("4"), "4"},
+		{"malformed operand", []byte("10"), operands("x", "5"), "15"},
+	}
+
+	op := MakeInt64AddOperator()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, ok := op.FullMerge("key", test.existing, test.operands)
+			if !ok || string(value) != test.want {
+				t.Errorf("got %q %v, want %q", value, ok, test.want)
+			}
+		})
+	}
+
+	if got := op.PartialMerge("key", []byte("2"), []byte("-5")); string(got) != "-3" {
+		t.Errorf("partial merge: got %q, want -3", got)
+	}
+}
+
+func TestStringAppend(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []byte
+		operands [][]byte
+		want     string
+	}{
+		{"missing key", nil, operands("a", "b"), "a,b"},
+		{"existing value", []byte("x"), operands("a"), "x,a"},
+		{"empty value", []byte{}, operands("a"), ",a"},
+	}
+
+	op := MakeStringAppendOperator(",")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, ok := op.FullMerge("key", test.existing, test.operands)
+			if !ok || string(value) != test.want {
+				t.Errorf("got %q %v, want %q", value, ok, test.want)
+			}
+		})
+	}
+
+	if got := op.PartialMerge("key", []byte("a"), []byte("b")); string(got) != "a,b" {
+		t.Errorf("partial merge: got %q, want a,b", got)
+	}
+}
+
+// TestMergeOnDeletedKey folds operands written after a delete, the deleted value must not be their base
+func TestMergeOnDeletedKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator MergeOperator
+		versions []*record.Record
+		rangeSeq uint64
+		want     string
+	}{
+		{"int64 add", MakeInt64AddOperator(), []*record.Record{merge("5", 3), del(2), put("100", 1)}, 0, "put:5@3"},
+		{"string append", MakeStringAppendOperator(","), []*record.Record{merge("b", 3), merge("a", 2), del(1)}, 0, "put:a,b@3"},
+		{"int64 add, range deleted", MakeInt64AddOperator(), []*record.Record{merge("5", 3), put("100", 1)}, 2, "put:5@3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := describe(Fold(test.operator, "key", test.versions, test.rangeSeq, false))
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBloomFilterAdd(t *testing.T) {
+	op := MakeBloomFilterAddOperator()
+	operand := EncodeElements([]byte("a"), []byte("b"))
+
+	if _, ok := op.FullMerge("key", nil, [][]byte{operand}); ok {
+		t.Error("operands on a missing filter created it")
+	}
+
+	filter := bloomFilter.MakeBloomFilter(100, 0.01).BloomFilterToBytes()
+	combined := op.PartialMerge("key", operand, EncodeElements([]byte("c")))
+	value, ok := op.FullMerge("key", filter, [][]byte{combined})
+	if !ok {
+		t.Fatal("merge into the filter failed")
+	}
+	obj, err := bloomFilter.BytesToBloomFilter(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, element := range []string{"a", "b", "c"} {
+		if !obj.IsPresent([]byte(element)) {
+			t.Errorf("%s is missing from the filter", element)
+		}
+	}
+}
@@ -10,8 +10,9 @@ import (
 
 type Record struct {
 	crc       uint32
-	timestamp uint64
-	tombstone bool
+	seq       uint64
+	kind      byte
+	expiresAt uint64 // unix time in nanoseconds after which the record is treated as absent, 0 if it never expires
 	keySize   uint64
 	valueSize uint64
 	key       string
@@ -25,15 +26,21 @@ Parameters:
   - key: A string representing the key for the Record.
   - value: A byte slice representing the value for the Record.
   - deleted: A boolean indicating whether the Record is marked as deleted (tombstone).
+  - seq: Sequence number assigned by the write path, a newer version of a key always has a greater one.
 
 Returns:
   - Pointer to a Record instance initialized with the provided parameters.
 */
-func MakeRecord(key string, value []byte, deleted bool) *Record {
+func MakeRecord(key string, value []byte, deleted bool, seq uint64) *Record {
+	kind := byte(KIND_PUT)
+	if deleted {
+		kind = KIND_DELETE
+	}
+
 	return &Record{
 		crc:       CrcHash(value),
-		timestamp: uint64(time.Now().Unix()),
-		tombstone: deleted,
+		seq:       seq,
+		kind:      kind,
 		keySize:   uint64(len([]byte(key))),
 		valueSize: uint64(len(value)),
 		key:       key,
@@ -41,23 +48,154 @@ func MakeRecord(key string, value []byte, deleted bool) *Record {
 	}
 }
 
+/*
+MakeExpiringRecord creates a Record that is treated as absent once its deadline has passed.
+
+Parameters:
+  - key: A string representing the key for the Record.
+  - value: A byte slice representing the value for the Record.
+  - seq: Sequence number assigned by the write path.
+  - expiresAt: Deadline after which the record is treated as absent.
+
+Returns:
+  - Pointer to a Record instance initialized with the provided parameters.
+*/
+func MakeExpiringRecord(key string, value []byte, seq uint64, expiresAt time.Time) *Record {
+	rec := MakeRecord(key, value, false, seq)
+	rec.expiresAt = uint64(expiresAt.UnixNano())
+	return rec
+}
+
+/*
+MakeRangeTombstone creates a record deleting every key within [start, end] written before it.
+The start of the range is stored as the key and its end as the value.
+
+Parameters:
+  - start: First key of the range.
+  - end: Last key of the range.
+  - seq: Sequence number assigned by the write path, only versions with a smaller one are deleted.
+
+Returns:
+  - Pointer to the range tombstone Record.
+*/
+func MakeRangeTombstone(start, end string, seq uint64) *Record {
+	rec := MakeRecord(start, []byte(end), false, seq)
+	rec.kind = KIND_RANGE_DELETE
+	return rec
+}
+
+/*
+MakeMergeRecord creates a record holding a merge operand, which is combined with the older versions of the key
+by a merge operator when the key is read or compacted.
+
+Parameters:
+  - key: A string representing the key for the Record.
+  - operand: Operand passed to the merge operator.
+  - seq: Sequence number assigned by the write path.
+
+Returns:
+  - Pointer to the merge Record.
+*/
+func MakeMergeRecord(key string, operand []byte, seq uint64) *Record {
+	rec := MakeRecord(key, operand, false, seq)
+	rec.kind = KIND_MERGE
+	return rec
+}
+
+/*
+MakeBatchRecord creates a record holding all the given records, so they are written to the WAL as one entry.
+Its value is the concatenation of the serialized records and its crc covers all of them.
+Its sequence number is the one of the last record.
+
+Parameters:
+  - records: Puts and deletes of the batch, in the order they were added.
+
+Returns:
+  - Pointer to the batch Record.
+*/
+func MakeBatchRecord(records []*Record) *Record {
+	var value []byte
+	for _, rec := range records {
+		value = append(value, rec.RecordToBytes()...)
+	}
+
+	var seq uint64
+	if len(records) > 0 {
+		seq = records[len(records)-1].seq
+	}
+
+	return &Record{
+		crc:       CrcHash(value),
+		seq:       seq,
+		kind:      KIND_BATCH,
+		valueSize: uint64(len(value)),
+		value:     value,
+	}
+}
+
+/*
+MakeFamilyRecord wraps a record of a column family other than the default one, so the family is known when
+the write-ahead log shared by all families is restored. Records of the default family are written unwrapped.
+
+Parameters:
+  - family: Name of the column family.
+  - rec: Record of the family, it can not be a batch.
+
+Returns:
+  - Pointer to the family Record, with the sequence number of the wrapped record.
+*/
+func MakeFamilyRecord(family string, rec *Record) *Record {
+	value := rec.RecordToBytes()
+
+	return &Record{
+		crc:       CrcHash(value),
+		seq:       rec.seq,
+		kind:      KIND_FAMILY,
+		keySize:   uint64(len(family)),
+		valueSize: uint64(len(value)),
+		key:       family,
+		value:     value,
+	}
+}
+
 const (
 	CRC_SIZE        = 4
-	TIMESTAMP_SIZE  = 8
-	TOMBSTONE_SIZE  = 1
+	SEQ_SIZE        = 8
+	KIND_SIZE       = 1
+	EXPIRES_SIZE    = 8
 	KEY_SIZE_SIZE   = 8
 	VALUE_SIZE_SIZE = 8
 
 	CRC_START        = 0
-	TIMESTAMP_START  = CRC_START + CRC_SIZE
-	TOMBSTONE_START  = TIMESTAMP_START + TIMESTAMP_SIZE
-	KEY_SIZE_START   = TOMBSTONE_START + TOMBSTONE_SIZE
+	SEQ_START        = CRC_START + CRC_SIZE
+	KIND_START       = SEQ_START + SEQ_SIZE
+	KEY_SIZE_START   = KIND_START + KIND_SIZE
 	VALUE_SIZE_START = KEY_SIZE_START + KEY_SIZE_SIZE
 	KEY_START        = VALUE_SIZE_START + VALUE_SIZE_SIZE
 
-	RECORD_HEADER_SIZE = CRC_SIZE + TIMESTAMP_SIZE + TOMBSTONE_SIZE + KEY_SIZE_SIZE + VALUE_SIZE_SIZE
+	RECORD_HEADER_SIZE = CRC_SIZE + SEQ_SIZE + KIND_SIZE + KEY_SIZE_SIZE + VALUE_SIZE_SIZE
+)
+
+// Kinds of records, stored in the byte after the sequence number
+const (
+	KIND_PUT          = 0
+	KIND_DELETE       = 1
+	KIND_BATCH        = 2
+	KIND_RANGE_DELETE = 3
+	KIND_MERGE        = 4
+	KIND_FAMILY       = 5
 )
 
+/*
+KIND_EXPIRES is set in the stored kind of a record with a deadline, the deadline then follows the value.
+Records without a deadline keep the layout written before deadlines existed, so older write-ahead logs
+and SSTables are read as they are.
+*/
+const KIND_EXPIRES = 0x80
+
+// DEFAULT_FAMILY is the column family of the records written without a family record around them
+const DEFAULT_FAMILY = "default"
+
 /*
 CrcHash calculates the CRC32 hash for the given byte slice.
 
@@ -75,12 +213,71 @@ func (r *Record) GetCrc() uint32 {
 	return r.crc
 }
 
-func (r *Record) GetTimestamp() uint64 {
-	return r.timestamp
+func (r *Record) GetSeq() uint64 {
+	return r.seq
 }
 
 func (r *Record) IsTombstone() bool {
-	return r.tombstone
+	return r.kind == KIND_DELETE
+}
+
+func (r *Record) IsBatch() bool {
+	return r.kind == KIND_BATCH
+}
+
+// IsFamily reports whether the record wraps a record of a column family, see MakeFamilyRecord
+func (r *Record) IsFamily() bool {
+	return r.kind == KIND_FAMILY
+}
+
+func (r *Record) IsRangeTombstone() bool {
+	return r.kind == KIND_RANGE_DELETE
+}
+
+// IsMerge reports whether the record holds a merge operand instead of a value
+func (r *Record) IsMerge() bool {
+	return r.kind == KIND_MERGE
+}
+
+// GetRangeEnd returns the last key deleted by a range tombstone
+func (r *Record) GetRangeEnd() string {
+	return string(r.value)
+}
+
+// Covers reports whether the key is within the range of the range tombstone
+func (r *Record) Covers(key string) bool {
+	return r.IsRangeTombstone() && r.key <= key && key <= string(r.value)
+}
+
+// CoveredBy reports whether one of the range tombstones was written after the record and covers its key
+func (r *Record) CoveredBy(rangeTombstones []*Record) bool {
+	return CoveringSeq(rangeTombstones, r.key) > r.seq
+}
+
+// CoveringSeq returns the greatest sequence number of the range tombstones covering the key, 0 if none covers it
+func CoveringSeq(rangeTombstones []*Record, key string) uint64 {
+	var seq uint64
+	for _, rt := range rangeTombstones {
+		if rt.seq > seq && rt.Covers(key) {
+			seq = rt.seq
+		}
+	}
+	return seq
+}
+
+// GetExpiresAt returns the deadline of the record in unix nanoseconds, 0 if it never expires
+func (r *Record) GetExpiresAt() uint64 {
+	return r.expiresAt
+}
+
+// IsExpired reports whether the deadline of the record has passed
+func (r *Record) IsExpired() bool {
+	return r.expiresAt != 0 && uint64(time.Now().UnixNano()) >= r.expiresAt
+}
+
+// IsLive reports whether the record holds a value that can be read, it is neither deleted nor expired
+func (r *Record) IsLive() bool {
+	return r.kind == KIND_PUT && !r.IsExpired()
 }
 
 func (r *Record) GetKeySize() uint64 {
@@ -109,13 +306,10 @@ func (r *Record) RecordToBytes() []byte {
 	crcBytes := make([]byte, CRC_SIZE)
 	binary.LittleEndian.PutUint32(crcBytes, r.crc)
 
-	timestampBytes := make([]byte, TIMESTAMP_SIZE)
-	binary.LittleEndian.PutUint64(timestampBytes, r.timestamp)
+	seqBytes := make([]byte, SEQ_SIZE)
+	binary.LittleEndian.PutUint64(seqBytes, r.seq)
 
-	tombstoneBytes := []byte{0}
-	if r.tombstone {
-		tombstoneBytes[0] = 1
-	}
+	kindBytes := []byte{r.storedKind()}
 
 	keySizeBytes := make([]byte, KEY_SIZE_SIZE)
 	binary.LittleEndian.PutUint64(keySizeBytes, r.keySize)
@@ -126,16 +320,30 @@ func (r *Record) RecordToBytes() []byte {
 	keyBytes := []byte(r.key)
 	valueBytes := r.value
 
-	result := append(crcBytes, timestampBytes...)
-	result = append(result, tombstoneBytes...)
+	result := append(crcBytes, seqBytes...)
+	result = append(result, kindBytes...)
 	result = append(result, keySizeBytes...)
 	result = append(result, valueSizeBytes...)
 	result = append(result, keyBytes...)
 	result = append(result, valueBytes...)
 
+	if r.expiresAt != 0 {
+		expiresBytes := make([]byte, EXPIRES_SIZE)
+		binary.LittleEndian.PutUint64(expiresBytes, r.expiresAt)
+		result = append(result, expiresBytes...)
+	}
+
 	return result
 }
 
+// storedKind returns the kind written to the record, with KIND_EXPIRES set if the record has a deadline
+func (r *Record) storedKind() byte {
+	if r.expiresAt != 0 {
+		return r.kind | KIND_EXPIRES
+	}
+	return r.kind
+}
+
 /*
 BytesToRecord converts a byte slice to a Record instance.
 
@@ -148,22 +356,77 @@ Returns:
 func BytesToRecord(bytes []byte) *Record {
 	r := Record{}
 
-	r.crc = binary.LittleEndian.Uint32(bytes[CRC_START:TIMESTAMP_START])
+	r.crc = binary.LittleEndian.Uint32(bytes[CRC_START:SEQ_START])
 
-	r.timestamp = binary.LittleEndian.Uint64(bytes[TIMESTAMP_START:TOMBSTONE_START])
+	r.seq = binary.LittleEndian.Uint64(bytes[SEQ_START:KIND_START])
 
-	r.tombstone = bytes[TOMBSTONE_START] == 1
+	r.kind = bytes[KIND_START] &^ KIND_EXPIRES
 
 	r.keySize = binary.LittleEndian.Uint64(bytes[KEY_SIZE_START:VALUE_SIZE_START])
 
 	r.valueSize = binary.LittleEndian.Uint64(bytes[VALUE_SIZE_START:RECORD_HEADER_SIZE])
 
+	end := KEY_START + r.keySize + r.valueSize
 	r.key = string(bytes[KEY_START : KEY_START+r.keySize])
-	r.value = bytes[KEY_START+r.keySize : KEY_START+r.keySize+r.valueSize]
+	r.value = bytes[KEY_START+r.keySize : end]
+
+	if bytes[KIND_START]&KIND_EXPIRES != 0 {
+		r.expiresAt = binary.LittleEndian.Uint64(bytes[end : end+EXPIRES_SIZE])
+	}
 
 	return &r
 }
 
+/*
+BatchRecords decodes the records held by a batch record.
+
+Returns:
+  - []*Record: Records of the batch, in the order they were added.
+  - error: Error, if the record is not a batch or its value is malformed.
+*/
+func (r *Record) BatchRecords() ([]*Record, error) {
+	if !r.IsBatch() {
+		return nil, errors.New("record is not a batch")
+	}
+
+	var records []*Record
+	data := r.value
+	for len(data) > 0 {
+		if len(data) < RECORD_HEADER_SIZE {
+			return nil, errors.New("failed to decode batch")
+		}
+		size := Size(data[:RECORD_HEADER_SIZE])
+		if size < RECORD_HEADER_SIZE || size > len(data) {
+			return nil, errors.New("failed to decode batch")
+		}
+
+		records = append(records, BytesToRecord(data[:size]))
+		data = data[size:]
+	}
+
+	return records, nil
+}
+
+/*
+FamilyRecord unwraps a record written to the write-ahead log.
+
+Returns:
+  - string: Column family of the record, DEFAULT_FAMILY if it is not wrapped.
+  - *Record: The wrapped record, or the record itself if it is not wrapped.
+  - error: Error, if the wrapped record is malformed.
+*/
+func (r *Record) FamilyRecord() (string, *Record, error) {
+	if !r.IsFamily() {
+		return DEFAULT_FAMILY, r, nil
+	}
+
+	if len(r.value) < RECORD_HEADER_SIZE || Size(r.value[:RECORD_HEADER_SIZE]) != len(r.value) {
+		return "", nil, errors.New("failed to decode family record")
+	}
+
+	return r.key, BytesToRecord(r.value), nil
+}
+
 /*
 Size calculates the Record size in bytes.
 
@@ -171,11 +434,15 @@ Returns:
   - int: Record size in bytes.
 */
 func (r *Record) Size() int {
-	return int(CRC_SIZE + TIMESTAMP_SIZE + TOMBSTONE_SIZE + KEY_SIZE_SIZE + VALUE_SIZE_SIZE + r.keySize + r.valueSize)
+	size := int(RECORD_HEADER_SIZE + r.keySize + r.valueSize)
+	if r.expiresAt != 0 {
+		size += EXPIRES_SIZE
+	}
+	return size
 }
 
 /*
-Size calculates the total size of a record based on the provided header.
+Size calculates the total size of a record based on the provided header, including the deadline following the value.
 
 Parameters:
   - header: A byte slice representing the header of the record.
@@ -186,7 +453,11 @@ Returns:
 func Size(header []byte) int {
 	keySize := binary.LittleEndian.Uint64(header[KEY_SIZE_START:VALUE_SIZE_START])
 	valueSize := binary.LittleEndian.Uint64(header[VALUE_SIZE_START:RECORD_HEADER_SIZE])
-	return int(CRC_SIZE + TIMESTAMP_SIZE + TOMBSTONE_SIZE + KEY_SIZE_SIZE + VALUE_SIZE_SIZE + keySize + valueSize)
+	size := int(RECORD_HEADER_SIZE + keySize + valueSize)
+	if header[KIND_START]&KIND_EXPIRES != 0 {
+		size += EXPIRES_SIZE
+	}
+	return size
 
 }
 
@@ -195,8 +466,9 @@ PrintRecord prints the fields of a Record struct in a formatted way.
 */
 func (r *Record) PrintRecord() {
 	fmt.Printf("CRC: %d\n", r.crc)
-	fmt.Printf("Timestamp: %d\n", r.timestamp)
-	fmt.Printf("Tombstone: %t\n", r.tombstone)
+	fmt.Printf("Seq: %d\n", r.seq)
+	fmt.Printf("Kind: %d\n", r.kind)
+	fmt.Printf("Expires At: %d\n", r.expiresAt)
 	fmt.Printf("Key Size: %d\n", r.keySize)
 	fmt.Printf("Value Size: %d\n", r.valueSize)
 	fmt.Printf("Key: %s\n", r.key)
@@ -209,37 +481,43 @@ SSTRecordToBytes converts a Record instance to a byte slice for an SST (Sorted S
 Returns:
   - []byte: A byte slice representing the serialized form of the Record.
 
-The function distinguishes between regular records and tombstone records.
+The function distinguishes between regular records and tombstone records,
+only regular and merge records store their value, and their deadline if they have one.
 */
 func (r *Record) SSTRecordToBytes(dictIndex int) []byte {
-	if !r.tombstone {
+	if !r.IsTombstone() {
 		crcBytes := make([]byte, binary.MaxVarintLen64)
 		binary.PutUvarint(crcBytes, uint64(r.crc))
 		encodedSize := binary.PutUvarint(crcBytes, uint64(r.crc))
 		crcBytes = crcBytes[:encodedSize]
 
-		timestampBytes := make([]byte, binary.MaxVarintLen64)
-		encodedSize = binary.PutUvarint(timestampBytes, r.timestamp)
-		timestampBytes = timestampBytes[:encodedSize]
+		seqBytes := make([]byte, binary.MaxVarintLen64)
+		encodedSize = binary.PutUvarint(seqBytes, r.seq)
+		seqBytes = seqBytes[:encodedSize]
 
-		tombstoneBytes := []byte{0}
-		if r.tombstone {
-			tombstoneBytes[0] = 1
-		}
+		tombstoneBytes := []byte{r.storedKind()}
 
 		keyIndexBytes := make([]byte, binary.MaxVarintLen64)
 		encodedSize = binary.PutUvarint(keyIndexBytes, uint64(dictIndex))
 		keyIndexBytes = keyIndexBytes[:encodedSize]
 
+		var expiresBytes []byte
+		if r.expiresAt != 0 {
+			expiresBytes = make([]byte, binary.MaxVarintLen64)
+			encodedSize = binary.PutUvarint(expiresBytes, r.expiresAt)
+			expiresBytes = expiresBytes[:encodedSize]
+		}
+
 		valueSizeBytes := make([]byte, binary.MaxVarintLen64)
 		encodedSize = binary.PutUvarint(valueSizeBytes, r.valueSize)
 		valueSizeBytes = valueSizeBytes[:encodedSize]
 
 		valueBytes := r.value
 
-		result := append(crcBytes, timestampBytes...)
+		result := append(crcBytes, seqBytes...)
 		result = append(result, tombstoneBytes...)
 		result = append(result, keyIndexBytes...)
+		result = append(result, expiresBytes...)
 		result = append(result, valueSizeBytes...)
 		result = append(result, valueBytes...)
 
@@ -249,12 +527,12 @@ func (r *Record) SSTRecordToBytes(dictIndex int) []byte {
 		encodedSize := binary.PutUvarint(crcBytes, uint64(r.crc))
 		crcBytes = crcBytes[:encodedSize]
 
-		timestampBytes := make([]byte, binary.MaxVarintLen64)
-		encodedSize = binary.PutUvarint(timestampBytes, r.timestamp)
-		timestampBytes = timestampBytes[:encodedSize]
+		seqBytes := make([]byte, binary.MaxVarintLen64)
+		encodedSize = binary.PutUvarint(seqBytes, r.seq)
+		seqBytes = seqBytes[:encodedSize]
 
 		tombstoneBytes := []byte{0}
-		if r.tombstone {
+		if r.IsTombstone() {
 			tombstoneBytes[0] = 1
 		}
 
@@ -262,7 +540,7 @@ func (r *Record) SSTRecordToBytes(dictIndex int) []byte {
 		encodedSize = binary.PutUvarint(keyIndexBytes, uint64(dictIndex))
 		keyIndexBytes = keyIndexBytes[:encodedSize]
 
-		result := append(crcBytes, timestampBytes...)
+		result := append(crcBytes, seqBytes...)
 		result = append(result, tombstoneBytes...)
 		result = append(result, keyIndexBytes...)
 
@@ -290,15 +568,16 @@ func SSTBytesToRecord(data []byte, globalDict *map[string]int) (*Record, error)
 	}
 	data = data[n:]
 
-	// Read and decode the timestamp
-	timestamp, n := binary.Uvarint(data)
+	// Read and decode the sequence number
+	seq, n := binary.Uvarint(data)
 	if n <= 0 {
 		return nil, errors.New("failed to decode record")
 	}
 	data = data[n:]
 
-	// Read and decode the tombstone flag
-	tombstone := data[0] == 1
+	// Read and decode the kind, put or delete, and whether a deadline is stored
+	kind := data[0] &^ KIND_EXPIRES
+	expires := data[0]&KIND_EXPIRES != 0
 	data = data[1:]
 
 	// Read and decode the key size
@@ -316,16 +595,26 @@ func SSTBytesToRecord(data []byte, globalDict *map[string]int) (*Record, error)
 		}
 	}
 
-	if tombstone {
+	if kind == KIND_DELETE {
 		return &Record{
-			crc:       uint32(crc),
-			timestamp: timestamp,
-			tombstone: tombstone,
-			keySize:   uint64(len(key)),
-			key:       key,
+			crc:     uint32(crc),
+			seq:     seq,
+			kind:    kind,
+			keySize: uint64(len(key)),
+			key:     key,
 		}, nil
 	}
 
+	// Read and decode the deadline
+	var expiresAt uint64
+	if expires {
+		expiresAt, n = binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("failed to decode record")
+		}
+		data = data[n:]
+	}
+
 	// Read and decode the value size
 	valueSize, n := binary.Uvarint(data)
 	if n <= 0 {
@@ -338,8 +627,9 @@ func SSTBytesToRecord(data []byte, globalDict *map[string]int) (*Record, error)
 
 	return &Record{
 		crc:       uint32(crc),
-		timestamp: timestamp,
-		tombstone: tombstone,
+		seq:       seq,
+		kind:      kind,
+		expiresAt: expiresAt,
 		keySize:   uint64(len(key)),
 		valueSize: valueSize,
 		key:       key,
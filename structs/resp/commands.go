@@ -0,0 +1,508 @@
+package resp
+
+import (
+	"key-value-engine/structs/Engine"
+	"key-value-engine/structs/scan"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_SCAN_COUNT    = 10
+	DEFAULT_BF_CAPACITY   = 100
+	DEFAULT_BF_ERROR_RATE = 0.01
+	DEFAULT_HLL_PRECISION = 14
+)
+
+/*
+command describes a supported command.
+  - arity: exact number of arguments including the name, or -n for at least n.
+  - limited: whether the command takes a token from the connection token bucket.
+*/
+type command struct {
+	arity   int
+	limited bool
+	handler func(c *connection, args [][]byte)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":    {-1, false, ping},
+		"ECHO":    {2, false, echo},
+		"QUIT":    {1, false, quit},
+		"COMMAND": {-1, false, commandInfo},
+		"SELECT":  {2, false, selectDb},
+
+		"GET":     {2, true, get},
+		"SET":     {-3, true, set},
+		"SETNX":   {3, true, setnx},
+		"CAS":     {4, true, cas},
+		"DELIFEQ": {3, true, delifeq},
+		"DEL":     {-2, true, del},
+		"EXISTS":  {-2, true, exists},
+		"MGET":    {-2, true, mget},
+		"MSET":    {-3, true, mset},
+		"SCAN":    {-2, true, scanKeys},
+
+		"BF.RESERVE": {4, true, bfReserve},
+		"BF.ADD":     {3, true, bfAdd},
+		"BF.EXISTS":  {3, true, bfExists},
+
+		"CMS.INITBYPROB": {4, true, cmsInitByProb},
+		"CMS.INCRBY":     {-4, true, cmsIncrBy},
+		"CMS.QUERY":      {-3, true, cmsQuery},
+
+		"PFADD":   {-2, true, pfAdd},
+		"PFCOUNT": {2, true, pfCount},
+	}
+}
+
+// boolToInt converts the outcome of a conditional command into its integer reply
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func ping(c *connection, args [][]byte) {
+	if len(args) > 0 {
+		c.writer.WriteBulk(args[0])
+		return
+	}
+	c.writer.WriteSimpleString("PONG")
+}
+
+func echo(c *connection, args [][]byte) {
+	c.writer.WriteBulk(args[0])
+}
+
+func quit(c *connection, args [][]byte) {
+	c.writer.WriteSimpleString("OK")
+	c.quit = true
+}
+
+func commandInfo(c *connection, args [][]byte) {
+	c.writer.WriteArrayHeader(0)
+}
+
+func selectDb(c *connection, args [][]byte) {
+	if string(args[0]) != "0" {
+		c.writer.WriteError("ERR DB index is out of range")
+		return
+	}
+	c.writer.WriteSimpleString("OK")
+}
+
+func get(c *connection, args [][]byte) {
+	value, found, err := c.server.db.Get(string(args[0]))
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	if !found {
+		c.writer.WriteNull()
+		return
+	}
+	c.writer.WriteBulk(value)
+}
+
+// set serves SET key value [NX] [EX seconds | PX milliseconds], NX can not be combined with an expiry
+func set(c *connection, args [][]byte) {
+	var ttl time.Duration
+	nx := false
+	options := args[2:]
+	for len(options) > 0 {
+		option := strings.ToUpper(string(options[0]))
+		if option == "NX" && !nx {
+			nx = true
+			options = options[1:]
+			continue
+		}
+
+		if len(options) < 2 || ttl != 0 {
+			c.writer.WriteError("ERR syntax error")
+			return
+		}
+
+		n, err := strconv.ParseInt(string(options[1]), 10, 64)
+		if err != nil || n <= 0 {
+			c.writer.WriteError("ERR invalid expire time in 'set' command")
+			return
+		}
+
+		switch option {
+		case "EX":
+			ttl = time.Duration(n) * time.Second
+		case "PX":
+			ttl = time.Duration(n) * time.Millisecond
+		default:
+			c.writer.WriteError("ERR syntax error")
+			return
+		}
+		options = options[2:]
+	}
+
+	if nx {
+		if ttl > 0 {
+			c.writer.WriteError("ERR syntax error")
+			return
+		}
+
+		stored, err := c.server.db.PutIfAbsent(string(args[0]), args[1])
+		if err != nil {
+			c.writer.WriteError("ERR " + err.Error())
+			return
+		}
+		if !stored {
+			c.writer.WriteNull()
+			return
+		}
+		c.writer.WriteSimpleString("OK")
+		return
+	}
+
+	var err error
+	if ttl > 0 {
+		err = c.server.db.PutWithTTL(string(args[0]), args[1], ttl)
+	} else {
+		err = c.server.db.Put(string(args[0]), args[1])
+	}
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	c.writer.WriteSimpleString("OK")
+}
+
+// setnx serves SETNX key value, replying 1 if the key was stored and 0 if it already existed
+func setnx(c *connection, args [][]byte) {
+	stored, err := c.server.db.PutIfAbsent(string(args[0]), args[1])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	c.writer.WriteInteger(boolToInt(stored))
+}
+
+// cas serves CAS key expected value, replying 1 if the value was swapped and 0 otherwise
+func cas(c *connection, args [][]byte) {
+	swapped, err := c.server.db.CompareAndSwap(string(args[0]), args[1], args[2])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	c.writer.WriteInteger(boolToInt(swapped))
+}
+
+// delifeq serves DELIFEQ key expected, replying 1 if the key was deleted and 0 otherwise
+func delifeq(c *connection, args [][]byte) {
+	deleted, err := c.server.db.DeleteIfEquals(string(args[0]), args[1])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	c.writer.WriteInteger(boolToInt(deleted))
+}
+
+func del(c *connection, args [][]byte) {
+	deleted := int64(0)
+	for _, key := range args {
+		found, err := c.server.db.DeleteIfExists(string(key))
+		if err != nil {
+			c.writer.WriteError("ERR " + err.Error())
+			return
+		}
+		if found {
+			deleted++
+		}
+	}
+	c.writer.WriteInteger(deleted)
+}
+
+func exists(c *connection, args [][]byte) {
+	count := int64(0)
+	for _, key := range args {
+		_, found, err := c.server.db.Get(string(key))
+		if err != nil {
+			c.writer.WriteError("ERR " + err.Error())
+			return
+		}
+		if found {
+			count++
+		}
+	}
+	c.writer.WriteInteger(count)
+}
+
+func mget(c *connection, args [][]byte) {
+	keys := make([]string, len(args))
+	for i, key := range args {
+		keys[i] = string(key)
+	}
+
+	values, found, err := c.server.db.MultiGet(keys)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+
+	c.writer.WriteArrayHeader(len(values))
+	for i, value := range values {
+		if !found[i] {
+			c.writer.WriteNull()
+		} else {
+			c.writer.WriteBulk(value)
+		}
+	}
+}
+
+func mset(c *connection, args [][]byte) {
+	if len(args)%2 != 0 {
+		c.writer.WriteError("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+
+	batch := Engine.MakeWriteBatch()
+	for i := 0; i < len(args); i += 2 {
+		batch.Put(string(args[i]), args[i+1])
+	}
+
+	err := c.server.db.Write(batch)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	c.writer.WriteSimpleString("OK")
+}
+
+/*
+scanKeys implements SCAN cursor [MATCH pattern] [COUNT count].
+The cursor is the last returned key written as a decimal number, so clients that parse it as an integer keep working.
+MATCH takes a glob, the scan seeks to the literal text before its first wildcard and checks the rest on each key.
+*/
+func scanKeys(c *connection, args [][]byte) {
+	after, ok := decodeCursor(string(args[0]))
+	if !ok {
+		c.writer.WriteError("ERR invalid cursor")
+		return
+	}
+
+	filter, _ := scan.MakeGlobFilter("*")
+	count := DEFAULT_SCAN_COUNT
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			c.writer.WriteError("ERR syntax error")
+			return
+		}
+		option := strings.ToUpper(string(args[i]))
+		if option == "MATCH" {
+			var err error
+			filter, err = scan.MakeGlobFilter(string(args[i+1]))
+			if err != nil {
+				c.writer.WriteError("ERR " + err.Error())
+				return
+			}
+		} else if option == "COUNT" {
+			n, err := strconv.Atoi(string(args[i+1]))
+			if err != nil || n < 1 {
+				c.writer.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			count = n
+		} else {
+			c.writer.WriteError("ERR syntax error")
+			return
+		}
+	}
+
+	records, last, err := c.server.db.FilterScanAfter(filter, after, count)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+
+	next := "0"
+	if last != nil {
+		next = encodeCursor(*last)
+	}
+	c.writer.WriteArrayHeader(2)
+	c.writer.WriteBulk([]byte(next))
+	c.writer.WriteArrayHeader(len(records))
+	for _, rec := range records {
+		c.writer.WriteBulk([]byte(rec.GetKey()))
+	}
+}
+
+// encodeCursor writes the key as a decimal number, the leading 1 byte keeps leading zero bytes of the key
+func encodeCursor(key string) string {
+	return new(big.Int).SetBytes(append([]byte{1}, key...)).String()
+}
+
+// decodeCursor returns nil for the starting cursor 0
+func decodeCursor(cursor string) (*string, bool) {
+	if cursor == "0" {
+		return nil, true
+	}
+
+	n, ok := new(big.Int).SetString(cursor, 10)
+	if !ok || n.Sign() <= 0 {
+		return nil, false
+	}
+
+	data := n.Bytes()
+	if data[0] != 1 {
+		return nil, false
+	}
+
+	key := string(data[1:])
+	return &key, true
+}
+
+func bfReserve(c *connection, args [][]byte) {
+	errorRate, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil {
+		c.writer.WriteError("ERR bad error rate")
+		return
+	}
+	capacity, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil {
+		c.writer.WriteError("ERR bad capacity")
+		return
+	}
+
+	err = c.server.db.MakeBloomFilter(string(args[0]), capacity, errorRate)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	c.writer.WriteSimpleString("OK")
+}
+
+// bfAdd adds the item, creating the bloom filter with default parameters if it does not exist
+func bfAdd(c *connection, args [][]byte) {
+	params := Engine.StructParams{Capacity: DEFAULT_BF_CAPACITY, ErrorRate: DEFAULT_BF_ERROR_RATE}
+	added, err := c.server.db.AddOrCreateStruct(Engine.STRUCT_BF, string(args[0]), params, args[1])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	c.writer.WriteInteger(boolToInt(added))
+}
+
+func bfExists(c *connection, args [][]byte) {
+	present, _, err := c.server.db.BloomFilterCheck(string(args[0]), args[1])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+
+	if present {
+		c.writer.WriteInteger(1)
+	} else {
+		c.writer.WriteInteger(0)
+	}
+}
+
+func cmsInitByProb(c *connection, args [][]byte) {
+	epsilon, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil {
+		c.writer.WriteError("ERR invalid error value")
+		return
+	}
+	delta, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil {
+		c.writer.WriteError("ERR invalid probability value")
+		return
+	}
+
+	err = c.server.db.MakeCMS(string(args[0]), epsilon, delta)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	c.writer.WriteSimpleString("OK")
+}
+
+func cmsIncrBy(c *connection, args [][]byte) {
+	name := string(args[0])
+	pairs := args[1:]
+	if len(pairs)%2 != 0 {
+		c.writer.WriteError("ERR wrong number of arguments for 'cms.incrby' command")
+		return
+	}
+
+	items := make([][]byte, 0, len(pairs)/2)
+	counts := make([]uint64, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		increment, err := strconv.ParseUint(string(pairs[i+1]), 10, 64)
+		if err != nil || increment > Engine.MAX_CMS_INCREMENT {
+			c.writer.WriteError("ERR cannot parse increment")
+			return
+		}
+		items = append(items, pairs[i])
+		counts = append(counts, increment)
+	}
+
+	found, err := c.server.db.CMSIncrBy(name, items, counts)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	if !found {
+		c.writer.WriteError("ERR CMS: key does not exist")
+		return
+	}
+
+	c.writeEstimates(name, items)
+}
+
+func cmsQuery(c *connection, args [][]byte) {
+	c.writeEstimates(string(args[0]), args[1:])
+}
+
+func (c *connection) writeEstimates(name string, items [][]byte) {
+	estimates := make([]int64, len(items))
+	for i, item := range items {
+		estimate, found, err := c.server.db.CMSEstimate(name, item)
+		if err != nil {
+			c.writer.WriteError("ERR " + err.Error())
+			return
+		}
+		if !found {
+			c.writer.WriteError("ERR CMS: key does not exist")
+			return
+		}
+		estimates[i] = int64(estimate)
+	}
+
+	c.writer.WriteArrayHeader(len(estimates))
+	for _, estimate := range estimates {
+		c.writer.WriteInteger(estimate)
+	}
+}
+
+// pfAdd adds the elements, creating the hyperloglog if it does not exist, and replies 1 if the estimate changed
+func pfAdd(c *connection, args [][]byte) {
+	params := Engine.StructParams{Precision: DEFAULT_HLL_PRECISION}
+	changed, err := c.server.db.AddOrCreateStruct(Engine.STRUCT_HLL, string(args[0]), params, args[1:]...)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	c.writer.WriteInteger(boolToInt(changed))
+}
+
+func pfCount(c *connection, args [][]byte) {
+	estimate, _, err := c.server.db.HLLEstimate(string(args[0]))
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	c.writer.WriteInteger(int64(math.Round(estimate)))
+}
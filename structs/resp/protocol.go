@@ -0,0 +1,150 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	MAX_BULK_SIZE  = 512 * 1024 * 1024
+	MAX_ARRAY_SIZE = 1024 * 1024
+)
+
+var errProtocol = errors.New("protocol error")
+
+/*
+Reader reads RESP2 commands, either as arrays of bulk strings or as inline commands.
+*/
+type Reader struct {
+	reader *bufio.Reader
+}
+
+func MakeReader(r io.Reader) *Reader {
+	return &Reader{
+		reader: bufio.NewReader(r),
+	}
+}
+
+/*
+ReadCommand reads the next command and returns its arguments, the first one being the command name.
+
+Returns:
+  - [][]byte: Arguments of the command, empty for a blank inline line.
+  - error: io.EOF when the client closed the connection, errProtocol for malformed input.
+*/
+func (r *Reader) ReadCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		// inline command, arguments separated by whitespace
+		var args [][]byte
+		for _, field := range strings.Fields(line) {
+			args = append(args, []byte(field))
+		}
+		return args, nil
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count > MAX_ARRAY_SIZE {
+		return nil, errProtocol
+	}
+
+	args := make([][]byte, 0, max(count, 0))
+	for i := 0; i < count; i++ {
+		arg, err := r.readBulk()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+func (r *Reader) readBulk() ([]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, errProtocol
+	}
+
+	size, err := strconv.Atoi(line[1:])
+	if err != nil || size < 0 || size > MAX_BULK_SIZE {
+		return nil, errProtocol
+	}
+
+	data := make([]byte, size+2)
+	_, err = io.ReadFull(r.reader, data)
+	if err != nil {
+		return nil, err
+	}
+	if data[size] != '\r' || data[size+1] != '\n' {
+		return nil, errProtocol
+	}
+
+	return data[:size], nil
+}
+
+// readLine reads one line without the trailing \r\n
+func (r *Reader) readLine() (string, error) {
+	line, err := r.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	line = strings.TrimRight(line, "\n")
+	line = strings.TrimRight(line, "\r")
+
+	return line, nil
+}
+
+/*
+Writer buffers RESP2 replies until Flush is called.
+*/
+type Writer struct {
+	writer *bufio.Writer
+}
+
+func MakeWriter(w io.Writer) *Writer {
+	return &Writer{
+		writer: bufio.NewWriter(w),
+	}
+}
+
+func (w *Writer) WriteSimpleString(s string) {
+	w.writer.WriteString("+" + s + "\r\n")
+}
+
+func (w *Writer) WriteError(s string) {
+	w.writer.WriteString("-" + s + "\r\n")
+}
+
+func (w *Writer) WriteInteger(n int64) {
+	w.writer.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w *Writer) WriteBulk(data []byte) {
+	w.writer.WriteString("$" + strconv.Itoa(len(data)) + "\r\n")
+	w.writer.Write(data)
+	w.writer.WriteString("\r\n")
+}
+
+func (w *Writer) WriteNull() {
+	w.writer.WriteString("$-1\r\n")
+}
+
+func (w *Writer) WriteArrayHeader(n int) {
+	w.writer.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+func (w *Writer) Flush() error {
+	return w.writer.Flush()
+}
@@ -0,0 +1,195 @@
+package resp
+
+import (
+	"errors"
+	"key-value-engine/structs/Engine"
+	"key-value-engine/structs/tokenBucket"
+	"net"
+	"strings"
+	"sync"
+)
+
+const (
+	DEFAULT_ADDRESS = "127.0.0.1:6379"
+)
+
+/*
+Server serves the database over TCP using the RESP2 protocol, so existing Redis clients can be used.
+Every connection gets its own token bucket with the capacity and cooldown from the database config.
+*/
+type Server struct {
+	db          *Engine.DB
+	address     string
+	listener    net.Listener
+	connections map[net.Conn]bool
+	closed      bool
+	lock        sync.Mutex
+}
+
+/*
+connection holds the state of a single client.
+*/
+type connection struct {
+	server      *Server
+	conn        net.Conn
+	reader      *Reader
+	writer      *Writer
+	tokenBucket *tokenBucket.TokenBucket
+	quit        bool
+}
+
+func MakeServer(db *Engine.DB, address string) *Server {
+	if address == "" {
+		address = DEFAULT_ADDRESS
+	}
+
+	return &Server{
+		db:          db,
+		address:     address,
+		connections: make(map[net.Conn]bool),
+	}
+}
+
+/*
+ListenAndServe listens on the server address and handles connections until Close is called.
+*/
+func (s *Server) ListenAndServe() error {
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(listener)
+}
+
+/*
+Serve handles connections accepted on the listener until Close is called.
+*/
+func (s *Server) Serve(listener net.Listener) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		listener.Close()
+		return errors.New("server is closed")
+	}
+	s.listener = listener
+	s.lock.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.lock.Lock()
+		s.connections[conn] = true
+		s.lock.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+/*
+Addr returns the address the server is listening on, nil before it started listening.
+*/
+func (s *Server) Addr() net.Addr {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+/*
+Close stops accepting connections and closes all open ones.
+*/
+func (s *Server) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	for conn := range s.connections {
+		conn.Close()
+	}
+
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.lock.Lock()
+		delete(s.connections, conn)
+		s.lock.Unlock()
+	}()
+
+	cfg := s.db.Config()
+	c := &connection{
+		server:      s,
+		conn:        conn,
+		reader:      MakeReader(conn),
+		writer:      MakeWriter(conn),
+		tokenBucket: tokenBucket.MakeTokenBucket(int64(cfg.TokenCapacity), int64(cfg.RefillCooldown)),
+	}
+
+	for !c.quit {
+		args, err := c.reader.ReadCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.writer.WriteError("ERR " + err.Error())
+				c.writer.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		c.execute(args)
+
+		if c.writer.Flush() != nil {
+			return
+		}
+	}
+}
+
+// execute looks up the command, checks its arity and the rate limit and runs it
+func (c *connection) execute(args [][]byte) {
+	name := strings.ToUpper(string(args[0]))
+
+	cmd, exists := commands[name]
+	if !exists {
+		c.writer.WriteError("ERR unknown command '" + string(args[0]) + "'")
+		return
+	}
+
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.writer.WriteError("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+		return
+	}
+
+	if cmd.limited {
+		_, err := c.tokenBucket.TakeToken(1)
+		if err != nil {
+			c.writer.WriteError("ERR " + err.Error())
+			return
+		}
+	}
+
+	cmd.handler(c, args[1:])
+}
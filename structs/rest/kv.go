@@ -0,0 +1,312 @@
+package rest
+
+import (
+	"encoding/base64"
+	"errors"
+	"key-value-engine/structs/record"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_LIMIT = 100
+	MAX_LIMIT     = 10000
+)
+
+/*
+item is a key-value pair in scan and range responses, the value is base64 encoded by encoding/json.
+*/
+type item struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+/*
+casRequest is the body of a compare-and-swap request, the values are base64 encoded by encoding/json.
+*/
+type casRequest struct {
+	Expected []byte `json:"expected"`
+	Value    []byte `json:"value"`
+}
+
+/*
+page is a response of scan and range requests.
+Cursor is empty on the last page, otherwise it is passed as the cursor parameter to get the next page.
+*/
+type page struct {
+	Items  []item `json:"items"`
+	Cursor string `json:"cursor"`
+}
+
+/*
+handleKV serves GET, PUT and DELETE /kv/{key}, values are sent and returned as raw bytes.
+PUT accepts ?ttl=seconds, the key is then treated as absent once the ttl has passed.
+PUT with the If-None-Match: * header stores the value only if the key does not exist, replying 412 otherwise.
+*/
+func (s *Server) handleKV(w http.ResponseWriter, r *http.Request) {
+	key, ok := pathKey(w, r, "/kv/")
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		value, found, err := s.db.Get(key)
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, errNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+		_, _ = w.Write(value)
+
+	case http.MethodPut:
+		value, err := s.readBody(w, r)
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+
+		ttl, err := ttlParameter(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if r.Header.Get("If-None-Match") == "*" {
+			if ttl > 0 {
+				writeError(w, http.StatusBadRequest, errors.New("ttl can not be combined with If-None-Match"))
+				return
+			}
+
+			stored, err := s.db.PutIfAbsent(key, value)
+			if err != nil {
+				writeDBError(w, err)
+				return
+			}
+			if !stored {
+				writeError(w, http.StatusPreconditionFailed, errKeyExists)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if ttl > 0 {
+			err = s.db.PutWithTTL(key, value, ttl)
+		} else {
+			err = s.db.Put(key, value)
+		}
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		found, err := s.db.DeleteIfExists(key)
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, errNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+/*
+handleCAS serves the compare-and-swap requests on /cas/{key}:
+  - POST with {"expected": ..., "value": ...}, both base64 encoded, stores the value if the key holds the expected one.
+  - DELETE with the expected value as the raw body deletes the key if it holds the expected value.
+
+Both reply 204 on success and 412 if the key is missing or holds another value.
+*/
+func (s *Server) handleCAS(w http.ResponseWriter, r *http.Request) {
+	key, ok := pathKey(w, r, "/cas/")
+	if !ok {
+		return
+	}
+
+	var done bool
+	var err error
+
+	switch r.Method {
+	case http.MethodPost:
+		var body casRequest
+		err = s.decodeBody(w, r, &body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		done, err = s.db.CompareAndSwap(key, body.Expected, body.Value)
+
+	case http.MethodDelete:
+		var expected []byte
+		expected, err = s.readBody(w, r)
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+
+		done, err = s.db.DeleteIfEquals(key, expected)
+
+	default:
+		writeMethodNotAllowed(w, http.MethodPost, http.MethodDelete)
+		return
+	}
+
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if !done {
+		writeError(w, http.StatusPreconditionFailed, errValueMismatch)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pathKey returns the unescaped key after the route prefix, replying with an error if it is missing
+func pathKey(w http.ResponseWriter, r *http.Request, prefix string) (string, bool) {
+	key, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), prefix))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return "", false
+	}
+	if key == "" {
+		writeError(w, http.StatusBadRequest, errMissingKey)
+		return "", false
+	}
+
+	return key, true
+}
+
+// handleScan serves GET /scan?prefix=&cursor=&limit=
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	query := r.URL.Query()
+	after, limit, err := pageParameters(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	records, next, err := s.db.PrefixScanAfter(query.Get("prefix"), after, limit)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, makePage(records, next))
+}
+
+// handleRange serves GET /range?from=&to=&cursor=&limit=
+func (s *Server) handleRange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	query := r.URL.Query()
+	if !query.Has("to") {
+		writeError(w, http.StatusBadRequest, errors.New("missing to parameter"))
+		return
+	}
+	after, limit, err := pageParameters(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	from, to := query.Get("from"), query.Get("to")
+	if from > to {
+		writeError(w, http.StatusBadRequest, errors.New("from is greater than to"))
+		return
+	}
+
+	records, next, err := s.db.RangeScanAfter(from, to, after, limit)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, makePage(records, next))
+}
+
+// ttlParameter returns the ttl given in seconds, or 0 if the query has none
+func ttlParameter(query url.Values) (time.Duration, error) {
+	if !query.Has("ttl") {
+		return 0, nil
+	}
+
+	seconds, err := strconv.ParseInt(query.Get("ttl"), 10, 64)
+	if err != nil || seconds <= 0 {
+		return 0, errors.New("ttl must be a positive number of seconds")
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+/*
+pageParameters parses the cursor and limit query parameters.
+
+Returns:
+  - *string: Key after which the page starts, nil for the first page.
+  - int: Maximum number of items on the page.
+  - error: Error, if any parameter is malformed.
+*/
+func pageParameters(query url.Values) (*string, int, error) {
+	limit := DEFAULT_LIMIT
+	if query.Has("limit") {
+		n, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || n < 1 || n > MAX_LIMIT {
+			return nil, 0, errors.New("limit must be between 1 and " + strconv.Itoa(MAX_LIMIT))
+		}
+		limit = n
+	}
+
+	cursor := query.Get("cursor")
+	if cursor == "" {
+		return nil, limit, nil
+	}
+
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, 0, errors.New("invalid cursor")
+	}
+	after := string(key)
+
+	return &after, limit, nil
+}
+
+// makePage converts the records of a scan to a response, with the cursor of the next page if there is one
+func makePage(records []*record.Record, next *string) page {
+	result := page{Items: make([]item, 0, len(records))}
+	for _, rec := range records {
+		result.Items = append(result.Items, item{Key: rec.GetKey(), Value: rec.GetValue()})
+	}
+	if next != nil {
+		result.Cursor = base64.RawURLEncoding.EncodeToString([]byte(*next))
+	}
+
+	return result
+}
@@ -0,0 +1,95 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"key-value-engine/structs/Engine"
+	"key-value-engine/structs/wal"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	errNotFound   = errors.New("not found")
+	errMissingKey = errors.New("missing key")
+
+	errKeyExists     = errors.New("key already exists")
+	errValueMismatch = errors.New("key does not hold the expected value")
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+/*
+writeDBError writes an error returned by the database with the matching status code:
+  - ErrClosed: 503, the database is shutting down.
+  - ErrRecordTooLarge: 413, the record does not fit into a WAL segment.
+  - ErrInvalidTTL, ErrInvalidRange, ErrNoMerge: 400, the request is invalid.
+  - ErrCorrupted: 500, the stored record failed its checksum.
+  - anything else: 500.
+*/
+func writeDBError(w http.ResponseWriter, err error) {
+	if errors.Is(err, Engine.ErrClosed) {
+		writeError(w, http.StatusServiceUnavailable, err)
+	} else if errors.Is(err, wal.ErrRecordTooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+	} else if errors.Is(err, Engine.ErrInvalidTTL) || errors.Is(err, Engine.ErrInvalidRange) || errors.Is(err, Engine.ErrNoMerge) {
+		writeError(w, http.StatusBadRequest, err)
+	} else if errors.Is(err, Engine.ErrCorrupted) {
+		writeError(w, http.StatusInternalServerError, errors.New("stored value is corrupted: "+err.Error()))
+	} else {
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+// readBody reads the whole request body, at most maxBodySize bytes
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	return io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBodySize))
+}
+
+// decodeBody decodes the JSON request body into v, reading at most maxBodySize bytes
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBodySize))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+/*
+pathSegments splits the path after the route prefix into unescaped segments,
+so names containing a slash can be sent as %2F.
+*/
+func pathSegments(r *http.Request, prefix string) ([]string, error) {
+	rest := strings.TrimPrefix(r.URL.EscapedPath(), prefix)
+	if rest == "" {
+		return nil, nil
+	}
+
+	segments := strings.Split(rest, "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		segments[i] = unescaped
+	}
+
+	return segments, nil
+}
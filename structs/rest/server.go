@@ -0,0 +1,136 @@
+package rest
+
+import (
+	"errors"
+	"key-value-engine/structs/Engine"
+	"key-value-engine/structs/tokenBucket"
+	"net"
+	"net/http"
+	"sync"
+)
+
+const (
+	DEFAULT_ADDRESS = "127.0.0.1:8080"
+	// MAX_BODY_SIZE bounds request bodies, they are also bounded by the WAL segment size no record can exceed
+	MAX_BODY_SIZE = 64 * 1024 * 1024
+)
+
+/*
+Server serves the database over HTTP with JSON responses.
+
+Routes:
+  - GET/PUT/DELETE /kv/{key}: raw value of a key, the body of PUT is stored as is.
+  - GET /scan?prefix=&cursor=&limit=: keys starting with the prefix.
+  - GET /range?from=&to=&cursor=&limit=: keys within [from, to].
+  - /bf/{name}, /cms/{name}, /hll/{name}, /fingerprint/{name}: probabilistic structures and fingerprints.
+
+Every client address gets its own token bucket with the capacity and cooldown from the database config.
+Request bodies larger than a WAL segment are rejected with 413 before they are read, since no record can exceed it.
+*/
+type Server struct {
+	db          *Engine.DB
+	httpServer  *http.Server
+	buckets     map[string]*tokenBucket.TokenBucket
+	maxBodySize int64
+	lock        sync.Mutex
+}
+
+func MakeServer(db *Engine.DB, address string) *Server {
+	if address == "" {
+		address = DEFAULT_ADDRESS
+	}
+
+	s := &Server{
+		db:          db,
+		buckets:     make(map[string]*tokenBucket.TokenBucket),
+		maxBodySize: MAX_BODY_SIZE,
+	}
+	// a larger body can not be stored, it is rejected before it is read
+	if walSize := int64(db.Config().WalSize); walSize < s.maxBodySize {
+		s.maxBodySize = walSize
+	}
+	s.httpServer = &http.Server{
+		Addr:    address,
+		Handler: s.routes(),
+	}
+
+	return s
+}
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/kv/", s.limit(s.handleKV))
+	mux.HandleFunc("/scan", s.limit(s.handleScan))
+	mux.HandleFunc("/range", s.limit(s.handleRange))
+	mux.HandleFunc("/cas/", s.limit(s.handleCAS))
+
+	mux.HandleFunc("/bf/", s.limit(s.handleBloomFilter))
+	mux.HandleFunc("/cms/", s.limit(s.handleCMS))
+	mux.HandleFunc("/hll/", s.limit(s.handleHLL))
+	mux.HandleFunc("/fingerprint/", s.limit(s.handleFingerprint))
+
+	return mux
+}
+
+/*
+ListenAndServe listens on the server address and handles requests until Close is called.
+*/
+func (s *Server) ListenAndServe() error {
+	err := s.httpServer.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+/*
+Serve handles requests accepted on the listener until Close is called.
+*/
+func (s *Server) Serve(listener net.Listener) error {
+	err := s.httpServer.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+/*
+Close stops the server and closes all open connections.
+*/
+func (s *Server) Close() error {
+	return s.httpServer.Close()
+}
+
+// limit takes a token from the bucket of the client before calling the handler
+func (s *Server) limit(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, err := s.bucket(r).TakeToken(1)
+		if err != nil {
+			writeError(w, http.StatusTooManyRequests, err)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// bucket returns the token bucket of the client, creating it on the first request
+func (s *Server) bucket(r *http.Request) *tokenBucket.TokenBucket {
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	bucket, exists := s.buckets[client]
+	if !exists {
+		cfg := s.db.Config()
+		bucket = tokenBucket.MakeTokenBucket(int64(cfg.TokenCapacity), int64(cfg.RefillCooldown))
+		s.buckets[client] = bucket
+	}
+
+	return bucket
+}
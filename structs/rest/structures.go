@@ -0,0 +1,328 @@
+package rest
+
+import (
+	"errors"
+	"key-value-engine/structs/Engine"
+	"net/http"
+)
+
+/*
+Routes of the probabilistic structures and fingerprints, elements are sent as the raw request body:
+  - PUT /bf/{name} {"capacity": 1000, "error_rate": 0.01}, DELETE /bf/{name}
+  - POST /bf/{name}/add, POST /bf/{name}/check
+  - PUT /cms/{name} {"epsilon": 0.01, "delta": 0.01}, DELETE /cms/{name}
+  - POST /cms/{name}/add, POST /cms/{name}/count
+  - PUT /hll/{name} {"precision": 14}, DELETE /hll/{name}
+  - POST /hll/{name}/add, GET /hll/{name}/count
+  - PUT /fingerprint/{name} with the text as the body, DELETE /fingerprint/{name}
+  - GET /fingerprint/{name}/distance?to={other}
+*/
+
+type bloomFilterParameters struct {
+	Capacity  uint64  `json:"capacity"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+type cmsParameters struct {
+	Epsilon float64 `json:"epsilon"`
+	Delta   float64 `json:"delta"`
+}
+
+type hllParameters struct {
+	Precision uint8 `json:"precision"`
+}
+
+// structureRoute returns the name and the action of a structure request, the action is empty for /{structure}/{name}
+func structureRoute(w http.ResponseWriter, r *http.Request, prefix string) (string, string, bool) {
+	segments, err := pathSegments(r, prefix)
+	if err != nil || len(segments) == 0 || len(segments) > 2 || segments[0] == "" {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return "", "", false
+	}
+
+	if len(segments) == 1 {
+		return segments[0], "", true
+	}
+	return segments[0], segments[1], true
+}
+
+// handleDestroy deletes the structure, replying 404 if it does not exist
+func (s *Server) handleDestroy(w http.ResponseWriter, structure, name string) {
+	found, err := s.structureExists(structure, name)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+
+	err = s.db.DestroyStruct(structure, name)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) structureExists(structure, name string) (bool, error) {
+	var found bool
+	var err error
+
+	if structure == Engine.STRUCT_BF {
+		_, found, err = s.db.BloomFilterCheck(name, nil)
+	} else if structure == Engine.STRUCT_CMS {
+		_, found, err = s.db.CMSEstimate(name, nil)
+	} else if structure == Engine.STRUCT_HLL {
+		_, found, err = s.db.HLLEstimate(name)
+	} else {
+		_, found, err = s.db.SimHash(name, name)
+	}
+
+	return found, err
+}
+
+// handleAdd adds the request body to the structure
+func (s *Server) handleAdd(w http.ResponseWriter, r *http.Request, structure, name string) {
+	element, err := s.readBody(w, r)
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+
+	found, err := s.db.AddToStruct(structure, name, element)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, errNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleBloomFilter(w http.ResponseWriter, r *http.Request) {
+	name, action, ok := structureRoute(w, r, "/bf/")
+	if !ok {
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodPut:
+		var params bloomFilterParameters
+		err := s.decodeBody(w, r, &params)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		err = s.db.MakeBloomFilter(name, params.Capacity, params.ErrorRate)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+
+	case action == "" && r.Method == http.MethodDelete:
+		s.handleDestroy(w, Engine.STRUCT_BF, name)
+
+	case action == "add" && r.Method == http.MethodPost:
+		s.handleAdd(w, r, Engine.STRUCT_BF, name)
+
+	case action == "check" && r.Method == http.MethodPost:
+		element, err := s.readBody(w, r)
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+
+		present, found, err := s.db.BloomFilterCheck(name, element)
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, errNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"present": present})
+
+	case action == "" || action == "add" || action == "check":
+		if action == "" {
+			writeMethodNotAllowed(w, http.MethodPut, http.MethodDelete)
+		} else {
+			writeMethodNotAllowed(w, http.MethodPost)
+		}
+
+	default:
+		writeError(w, http.StatusNotFound, errNotFound)
+	}
+}
+
+func (s *Server) handleCMS(w http.ResponseWriter, r *http.Request) {
+	name, action, ok := structureRoute(w, r, "/cms/")
+	if !ok {
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodPut:
+		var params cmsParameters
+		err := s.decodeBody(w, r, &params)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		err = s.db.MakeCMS(name, params.Epsilon, params.Delta)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+
+	case action == "" && r.Method == http.MethodDelete:
+		s.handleDestroy(w, Engine.STRUCT_CMS, name)
+
+	case action == "add" && r.Method == http.MethodPost:
+		s.handleAdd(w, r, Engine.STRUCT_CMS, name)
+
+	case action == "count" && r.Method == http.MethodPost:
+		element, err := s.readBody(w, r)
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+
+		count, found, err := s.db.CMSEstimate(name, element)
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, errNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]uint64{"count": count})
+
+	case action == "" || action == "add" || action == "count":
+		if action == "" {
+			writeMethodNotAllowed(w, http.MethodPut, http.MethodDelete)
+		} else {
+			writeMethodNotAllowed(w, http.MethodPost)
+		}
+
+	default:
+		writeError(w, http.StatusNotFound, errNotFound)
+	}
+}
+
+func (s *Server) handleHLL(w http.ResponseWriter, r *http.Request) {
+	name, action, ok := structureRoute(w, r, "/hll/")
+	if !ok {
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodPut:
+		var params hllParameters
+		err := s.decodeBody(w, r, &params)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		err = s.db.MakeHLL(name, params.Precision)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+
+	case action == "" && r.Method == http.MethodDelete:
+		s.handleDestroy(w, Engine.STRUCT_HLL, name)
+
+	case action == "add" && r.Method == http.MethodPost:
+		s.handleAdd(w, r, Engine.STRUCT_HLL, name)
+
+	case action == "count" && r.Method == http.MethodGet:
+		estimate, found, err := s.db.HLLEstimate(name)
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, errNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]float64{"count": estimate})
+
+	case action == "" || action == "add" || action == "count":
+		if action == "" {
+			writeMethodNotAllowed(w, http.MethodPut, http.MethodDelete)
+		} else if action == "add" {
+			writeMethodNotAllowed(w, http.MethodPost)
+		} else {
+			writeMethodNotAllowed(w, http.MethodGet)
+		}
+
+	default:
+		writeError(w, http.StatusNotFound, errNotFound)
+	}
+}
+
+func (s *Server) handleFingerprint(w http.ResponseWriter, r *http.Request) {
+	name, action, ok := structureRoute(w, r, "/fingerprint/")
+	if !ok {
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodPut:
+		text, err := s.readBody(w, r)
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+
+		err = s.db.StoreFingerprint(name, text)
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+
+	case action == "" && r.Method == http.MethodDelete:
+		s.handleDestroy(w, Engine.STRUCT_FINGERPRINT, name)
+
+	case action == "distance" && r.Method == http.MethodGet:
+		other := r.URL.Query().Get("to")
+		if other == "" {
+			writeError(w, http.StatusBadRequest, errors.New("missing to parameter"))
+			return
+		}
+
+		distance, found, err := s.db.SimHash(name, other)
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, errNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]uint{"distance": distance})
+
+	case action == "" || action == "distance":
+		if action == "" {
+			writeMethodNotAllowed(w, http.MethodPut, http.MethodDelete)
+		} else {
+			writeMethodNotAllowed(w, http.MethodGet)
+		}
+
+	default:
+		writeError(w, http.StatusNotFound, errNotFound)
+	}
+}
@@ -3,12 +3,14 @@ package scan
 import (
 	"key-value-engine/structs/iterator"
 	"key-value-engine/structs/memtable"
+	"key-value-engine/structs/mergeOperator"
 	"key-value-engine/structs/record"
 	"key-value-engine/structs/sstable"
 )
 
 type PrefixIterator struct {
-	iterators []iterator.Iterator
+	merger
+	onStop func() // called once when the iterator is stopped
 }
 
 /*
@@ -24,51 +26,77 @@ func MakePrefixIterate(prefix string, manager *memtable.MemManager, sst *sstable
 	iterators = append(iterators, manager.GetMemPrefixIterators(prefix)...)
 
 	return &PrefixIterator{
-		iterators,
+		merger: makeMerger(iterators, append(sst.GetSSTRangeTombstones(), manager.GetRangeTombstones()...), sst.MergeOperator()),
 	}
 }
 
-func (pit *PrefixIterator) Next() *record.Record {
-	var ret *record.Record
-
-	incrementId := -1
-	for id, it := range pit.iterators {
-		if it.Valid() {
-			//can also be replaced if == because it might be a newer version
-			if ret == nil || (ret != nil && it.Get().GetKey() <= ret.GetKey()) {
-				if ret != nil && ret.GetKey() == it.Get().GetKey() {
-					//if they're duplicates only replace it if its newer
-					if ret.GetTimestamp() < it.Get().GetTimestamp() {
-						pit.iterators[incrementId].Next() //if ret had an old version skip it, so it doesnt appear in next round
-						ret = it.Get()
-						incrementId = id
-					} else {
-						it.Next() //if ret had the good version, skip the old you found, so it doesnt appear again next round
-					}
-				} else {
-					ret = it.Get()
-					incrementId = id
-				}
+/*
+MakeFilterIterate iterates over the keys starting with the literal prefix of the filter,
+returning only the records the filter keeps.
+*/
+func MakeFilterIterate(filter *Filter, manager *memtable.MemManager, sst *sstable.SSTable) *PrefixIterator {
+	pit := MakePrefixIterate(filter.Prefix(), manager, sst)
+	pit.filter = filter
+	return pit
+}
 
-			}
-		}
-	}
-	if incrementId != -1 {
-		pit.iterators[incrementId].Next()
+/*
+MakePrefixIterateOver merges the given iterators, a newer version of a key hides the older ones.
+Records covered by a newer range tombstone are skipped and merge records are folded with the operator.
+onStop, if not nil, is called once when the iterator is stopped,
+it is used to release the snapshot the iterators read from.
+*/
+func MakePrefixIterateOver(iterators []iterator.Iterator, rangeTombstones []*record.Record, operator mergeOperator.MergeOperator, onStop func()) *PrefixIterator {
+	return &PrefixIterator{
+		merger: makeMerger(iterators, rangeTombstones, operator),
+		onStop: onStop,
 	}
+}
 
-	if ret == nil {
-		pit.Stop()
-	}
+/*
+Next returns the record after the cursor and moves the cursor past it, nil once there are no more records.
+The iterator is not stopped at the end, so it can still move back with Prev, only Stop releases it.
+*/
+func (pit *PrefixIterator) Next() *record.Record {
+	return pit.next()
+}
 
-	if ret != nil && ret.IsTombstone() {
-		return pit.Next()
-	} else {
-		return ret
-	}
+/*
+Prev returns the record before the cursor and moves the cursor before it, nil once there are no earlier records.
+Next followed by Prev returns the same record.
+*/
+func (pit *PrefixIterator) Prev() *record.Record {
+	return pit.prev()
+}
 
+/*
+Seek moves the cursor before the first record with a key not less than the given one,
+so the next call to Next returns that record and Prev the one before it.
+*/
+func (pit *PrefixIterator) Seek(key string) {
+	pit.seek(key)
 }
 
+/*
+SeekToLast moves the cursor after the last record, so the next call to Prev returns it.
+*/
+func (pit *PrefixIterator) SeekToLast() {
+	pit.seekToLast()
+}
+
+/*
+Err returns the error that stopped the iterator, nil if Next and Prev returned nil since no record was left.
+A table that cannot be read stops the iterator, so the records after the error are not returned.
+*/
+func (pit *PrefixIterator) Err() error {
+	return pit.err
+}
+
+// Stop releases the iterator, it returns no more records afterwards
 func (pit *PrefixIterator) Stop() {
-	pit.iterators = nil
+	pit.stop()
+	if pit.onStop != nil {
+		pit.onStop()
+		pit.onStop = nil
+	}
 }
@@ -35,3 +35,42 @@ func PrefixScan(prefix string, pageNumber, pageSize int, mm *memtable.MemManager
 
 	return lista
 }
+
+/*
+PrefixScanAfter returns up to pageSize records with keys starting with the prefix, after the cursor key.
+The cursor is nil for the first page, and the returned cursor is passed to read the next page,
+it is nil once there are no more records.
+*/
+func PrefixScanAfter(prefix string, after *string, pageSize int, mm *memtable.MemManager, sst *sstable.SSTable) ([]*record.Record, *string) {
+	return MakePrefixIterate(prefix, mm, sst).page(after, pageSize)
+}
+
+/*
+FilterScan returns the records on the requested page of the records the filter keeps,
+the pages are counted from the first key with the literal prefix of the filter.
+*/
+func FilterScan(filter *Filter, pageNumber, pageSize int, mm *memtable.MemManager, sst *sstable.SSTable) []*record.Record {
+	rit := MakeFilterIterate(filter, mm, sst)
+	var lista []*record.Record
+
+	for i := 0; i < pageSize*pageNumber; i++ {
+		current := rit.Next()
+		if current == nil {
+			return lista
+		}
+
+		if i >= pageSize*(pageNumber-1) {
+			lista = append(lista, current)
+		}
+	}
+
+	return lista
+}
+
+/*
+FilterScanAfter returns up to pageSize records the filter keeps, after the cursor key,
+the cursor works the same way as in PrefixScanAfter.
+*/
+func FilterScanAfter(filter *Filter, after *string, pageSize int, mm *memtable.MemManager, sst *sstable.SSTable) ([]*record.Record, *string) {
+	return MakeFilterIterate(filter, mm, sst).page(after, pageSize)
+}
@@ -3,6 +3,7 @@ package scan
 import (
 	"key-value-engine/structs/iterator"
 	"key-value-engine/structs/memtable"
+	"key-value-engine/structs/mergeOperator"
 	"key-value-engine/structs/record"
 	"key-value-engine/structs/sstable"
 )
@@ -15,7 +16,8 @@ MAIN EXAMPLE:
 */
 
 type RangeIterator struct {
-	iterators []iterator.Iterator
+	merger
+	onStop func() // called once when the iterator is stopped
 }
 
 /*
@@ -30,50 +32,67 @@ func MakeRangeIterate(minRange, maxRange string, manager *memtable.MemManager, s
 	iterators := sst.GetSSTRangeIterators(minRange, maxRange)
 	iterators = append(iterators, manager.GetMemRangeIterators(minRange, maxRange)...)
 	return &RangeIterator{
-		iterators,
+		merger: makeMerger(iterators, append(sst.GetSSTRangeTombstones(), manager.GetRangeTombstones()...), sst.MergeOperator()),
 	}
 }
 
+/*
+MakeRangeIterateOver merges the given iterators, a newer version of a key hides the older ones.
+Records covered by a newer range tombstone are skipped and merge records are folded with the operator.
+onStop, if not nil, is called once when the iterator is stopped,
+it is used to release the snapshot the iterators read from.
+*/
+func MakeRangeIterateOver(iterators []iterator.Iterator, rangeTombstones []*record.Record, operator mergeOperator.MergeOperator, onStop func()) *RangeIterator {
+	return &RangeIterator{
+		merger: makeMerger(iterators, rangeTombstones, operator),
+		onStop: onStop,
+	}
+}
+
+/*
+Next returns the record after the cursor and moves the cursor past it, nil once there are no more records.
+The iterator is not stopped at the end, so it can still move back with Prev, only Stop releases it.
+*/
 func (rit *RangeIterator) Next() *record.Record {
-	var ret *record.Record
+	return rit.next()
+}
 
-	incrementId := -1
-	for id, it := range rit.iterators {
-		if it.Valid() {
-			//can also be replaced if == because it might be a newer version
-			if ret == nil || (ret != nil && it.Get().GetKey() <= ret.GetKey()) {
-				if ret != nil && ret.GetKey() == it.Get().GetKey() {
-					//if they're duplicates only replace it if its newer
-					if ret.GetTimestamp() < it.Get().GetTimestamp() {
-						rit.iterators[incrementId].Next() //if ret had an old version skip it, so it doesnt appear in next round
-						ret = it.Get()
-						incrementId = id
-					} else {
-						it.Next() //if ret had the good version, skip the old you found, so it doesnt appear again next round
-					}
-				} else {
-					ret = it.Get()
-					incrementId = id
-				}
+/*
+Prev returns the record before the cursor and moves the cursor before it, nil once there are no earlier records.
+Next followed by Prev returns the same record.
+*/
+func (rit *RangeIterator) Prev() *record.Record {
+	return rit.prev()
+}
 
-			}
-		}
-	}
-	if incrementId != -1 {
-		rit.iterators[incrementId].Next()
-	}
+/*
+Seek moves the cursor before the first record with a key not less than the given one,
+so the next call to Next returns that record and Prev the one before it.
+*/
+func (rit *RangeIterator) Seek(key string) {
+	rit.seek(key)
+}
 
-	if ret == nil {
-		rit.Stop()
-	}
+/*
+SeekToLast moves the cursor after the last record, so the next call to Prev returns it.
+*/
+func (rit *RangeIterator) SeekToLast() {
+	rit.seekToLast()
+}
 
-	if ret != nil && ret.IsTombstone() {
-		return rit.Next()
-	} else {
-		return ret
-	}
+/*
+Err returns the error that stopped the iterator, nil if Next and Prev returned nil since no record was left.
+A table that cannot be read stops the iterator, so the records after the error are not returned.
+*/
+func (rit *RangeIterator) Err() error {
+	return rit.err
 }
 
+// Stop releases the iterator, it returns no more records afterwards
 func (rit *RangeIterator) Stop() {
-	rit.iterators = nil
+	rit.stop()
+	if rit.onStop != nil {
+		rit.onStop()
+		rit.onStop = nil
+	}
 }
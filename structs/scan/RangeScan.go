@@ -35,3 +35,12 @@ func RangeScan(minRange, maxRange string, pageNumber, pageSize int, mm *memtable
 
 	return lista
 }
+
+/*
+RangeScanAfter returns up to pageSize records with keys within [minRange, maxRange], after the cursor key.
+The cursor is nil for the first page, and the returned cursor is passed to read the next page,
+it is nil once there are no more records.
+*/
+func RangeScanAfter(minRange, maxRange string, after *string, pageSize int, mm *memtable.MemManager, sst *sstable.SSTable) ([]*record.Record, *string) {
+	return MakeRangeIterate(minRange, maxRange, mm, sst).page(after, pageSize)
+}
@@ -0,0 +1,108 @@
+package scan
+
+import (
+	"key-value-engine/structs/iterator"
+	"key-value-engine/structs/memtable"
+	"key-value-engine/structs/record"
+	"key-value-engine/structs/sstable"
+)
+
+// Stats is the number of keys within a range or with a prefix and the bytes they take
+type Stats struct {
+	Count int
+	Size  int64
+}
+
+/*
+PrefixStats counts the live keys starting with the prefix and sums the sizes of their keys and values.
+The records are merged like in a scan, so deleted, expired and overwritten versions are not counted.
+*/
+func PrefixStats(prefix string, mm *memtable.MemManager, sst *sstable.SSTable) Stats {
+	return MakePrefixIterate(prefix, mm, sst).stats()
+}
+
+/*
+RangeStats counts the live keys within [minRange, maxRange] and sums the sizes of their keys and values.
+*/
+func RangeStats(minRange, maxRange string, mm *memtable.MemManager, sst *sstable.SSTable) Stats {
+	return MakeRangeIterate(minRange, maxRange, mm, sst).stats()
+}
+
+/*
+EstimatePrefixStats estimates the keys starting with the prefix without merging or reading the records of the SSTables,
+only their summaries and indexes are read.
+Every stored version is counted, so keys that were overwritten, deleted or flushed more than once are counted again,
+and the size is the size of the stored records, headers included.
+*/
+func EstimatePrefixStats(prefix string, mm *memtable.MemManager, sst *sstable.SSTable) (Stats, error) {
+	count, size, err := sst.EstimatePrefix(prefix)
+	if err != nil {
+		return Stats{}, err
+	}
+	return addMemStats(Stats{Count: count, Size: size}, mm.GetMemPrefixIterators(prefix)), nil
+}
+
+/*
+EstimateRangeStats estimates the keys within [minRange, maxRange] the same way as EstimatePrefixStats.
+*/
+func EstimateRangeStats(minRange, maxRange string, mm *memtable.MemManager, sst *sstable.SSTable) (Stats, error) {
+	count, size, err := sst.EstimateRange(minRange, maxRange)
+	if err != nil {
+		return Stats{}, err
+	}
+	return addMemStats(Stats{Count: count, Size: size}, mm.GetMemRangeIterators(minRange, maxRange)), nil
+}
+
+/*
+PrefixBounds returns the first and the last live key starting with the prefix,
+found with one step from each end of the merged iterators.
+
+Returns:
+  - string: First key.
+  - string: Last key.
+  - bool: Indicates whether any live key has the prefix.
+*/
+func PrefixBounds(prefix string, mm *memtable.MemManager, sst *sstable.SSTable) (string, string, bool) {
+	return MakePrefixIterate(prefix, mm, sst).bounds()
+}
+
+/*
+RangeBounds returns the first and the last live key within [minRange, maxRange], see PrefixBounds.
+*/
+func RangeBounds(minRange, maxRange string, mm *memtable.MemManager, sst *sstable.SSTable) (string, string, bool) {
+	return MakeRangeIterate(minRange, maxRange, mm, sst).bounds()
+}
+
+// stats counts the remaining records of the merge and sums the sizes of their keys and values
+func (m *merger) stats() Stats {
+	var stats Stats
+	for rec := m.next(); rec != nil; rec = m.next() {
+		stats.Count++
+		stats.Size += int64(len(rec.GetKey()) + len(rec.GetValue()))
+	}
+	return stats
+}
+
+// bounds returns the keys of the first and the last record of the merge
+func (m *merger) bounds() (string, string, bool) {
+	first := m.next()
+	if first == nil {
+		return "", "", false
+	}
+
+	m.seekToLast()
+	last := m.prev()
+	return first.GetKey(), last.GetKey(), true
+}
+
+// addMemStats adds every record of the memtable iterators to the estimate, with the size it takes when written
+func addMemStats(stats Stats, iterators []iterator.Iterator) Stats {
+	for _, it := range iterators {
+		for ; it.Valid(); it.Next() {
+			rec := it.Get()
+			stats.Count++
+			stats.Size += int64(record.RECORD_HEADER_SIZE + len(rec.GetKey()) + len(rec.GetValue()))
+		}
+	}
+	return stats
+}
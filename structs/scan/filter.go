@@ -0,0 +1,227 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrInvalidPattern = errors.New("invalid pattern")
+
+/*
+Filter selects the records of a scan by a glob or a regular expression on the key, and optionally by the value.
+The scan seeks to the longest literal prefix of the pattern, so only the keys with that prefix are read,
+the rest of the pattern and the value are checked on the merged records.
+*/
+type Filter struct {
+	prefix string
+	key    *regexp.Regexp
+	value  func(value []byte) bool // nil keeps every value
+}
+
+/*
+MakeGlobFilter makes a filter matching whole keys against the glob:
+* matches any sequence, ? any single character, [abc], [a-z] and [!a-z] (or [^a-z]) a character class,
+and \ makes the next character literal.
+
+Returns:
+  - *Filter: The filter.
+  - error: ErrInvalidPattern if a class is not closed or the glob ends with \.
+*/
+func MakeGlobFilter(glob string) (*Filter, error) {
+	var expr, prefix strings.Builder
+	literal := true // no wildcard was read yet, so the characters still belong to the prefix
+
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '*':
+			expr.WriteString(".*")
+			literal = false
+		case '?':
+			expr.WriteString(".")
+			literal = false
+		case '[':
+			class, end, ok := globClass(runes, i)
+			if !ok {
+				return nil, ErrInvalidPattern
+			}
+			expr.WriteString(class)
+			i = end
+			literal = false
+		case '\\':
+			if i+1 == len(runes) {
+				return nil, ErrInvalidPattern
+			}
+			i++
+			fallthrough
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(runes[i])))
+			if literal {
+				prefix.WriteRune(runes[i])
+			}
+		}
+	}
+
+	key, err := regexp.Compile("(?s)^" + expr.String() + "$")
+	if err != nil {
+		return nil, ErrInvalidPattern
+	}
+	return &Filter{prefix: prefix.String(), key: key}, nil
+}
+
+/*
+MakeRegexFilter makes a filter keeping the keys the regular expression matches anywhere in them.
+Only a pattern anchored with ^ has a literal prefix to seek to, any other pattern reads every key.
+
+Returns:
+  - *Filter: The filter.
+  - error: ErrInvalidPattern if the pattern is not a valid regular expression.
+*/
+func MakeRegexFilter(pattern string) (*Filter, error) {
+	key, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, ErrInvalidPattern
+	}
+	return &Filter{prefix: regexPrefix(pattern), key: key}, nil
+}
+
+// SetValueContains keeps only the records whose value contains the bytes, it replaces an earlier value condition
+func (f *Filter) SetValueContains(substring []byte) {
+	f.value = func(value []byte) bool {
+		return bytes.Contains(value, substring)
+	}
+}
+
+/*
+SetValueField keeps only the records whose value is a JSON object with the field equal to the given text,
+it replaces an earlier value condition.
+The field can name a nested field with dots, like "address.city". A string field is compared by its text,
+any other field by its JSON, so 42, true and null are given as they are written.
+*/
+func (f *Filter) SetValueField(field, expected string) {
+	path := strings.Split(field, ".")
+	f.value = func(value []byte) bool {
+		return jsonFieldEquals(value, path, expected)
+	}
+}
+
+// Prefix returns the longest literal prefix of the pattern, every matching key starts with it
+func (f *Filter) Prefix() string {
+	return f.prefix
+}
+
+func (f *Filter) MatchKey(key string) bool {
+	return f.key.MatchString(key)
+}
+
+func (f *Filter) MatchValue(value []byte) bool {
+	return f.value == nil || f.value(value)
+}
+
+/*
+globClass converts the character class starting at the [ at position start to a regular expression.
+
+Returns:
+  - string: The class as a regular expression.
+  - int: Position of the closing ].
+  - bool: Indicates whether the class is closed.
+*/
+func globClass(runes []rune, start int) (string, int, bool) {
+	var class strings.Builder
+	class.WriteByte('[')
+
+	i := start + 1
+	if i < len(runes) && (runes[i] == '!' || runes[i] == '^') {
+		class.WriteByte('^')
+		i++
+	}
+	for first := true; i < len(runes); i, first = i+1, false {
+		c := runes[i]
+		switch {
+		case c == ']' && !first:
+			class.WriteByte(']')
+			return class.String(), i, true
+		case c == '\\':
+			if i+1 == len(runes) {
+				return "", 0, false
+			}
+			i++
+			class.WriteString(classLiteral(runes[i]))
+		case c == '-' && !first && i+1 < len(runes) && runes[i+1] != ']':
+			class.WriteByte('-')
+		default:
+			class.WriteString(classLiteral(c))
+		}
+	}
+	return "", 0, false
+}
+
+// classLiteral escapes the character inside a class of a regular expression, any punctuation can be escaped there
+func classLiteral(c rune) string {
+	if c < utf8.RuneSelf && (unicode.IsPunct(c) || unicode.IsSymbol(c)) {
+		return "\\" + string(c)
+	}
+	return string(c)
+}
+
+// regexPrefix returns the literal text following the ^ at the start of the pattern, empty if the pattern is not anchored
+func regexPrefix(pattern string) string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	re = re.Simplify()
+	if re.Op != syntax.OpConcat || len(re.Sub) == 0 || re.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+
+	var prefix strings.Builder
+	for _, sub := range re.Sub[1:] {
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			break
+		}
+		prefix.WriteString(string(sub.Rune))
+	}
+	return prefix.String()
+}
+
+// jsonFieldEquals reports whether the value is a JSON object whose field on the path equals the expected text
+func jsonFieldEquals(value []byte, path []string, expected string) bool {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+
+	var field interface{}
+	if decoder.Decode(&field) != nil {
+		return false
+	}
+	for _, name := range path {
+		object, ok := field.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		field, ok = object[name]
+		if !ok {
+			return false
+		}
+	}
+
+	switch field := field.(type) {
+	case string:
+		return field == expected
+	case json.Number:
+		return field.String() == expected
+	case bool:
+		return strconv.FormatBool(field) == expected
+	case nil:
+		return expected == "null"
+	}
+	marshalled, err := json.Marshal(field)
+	return err == nil && string(marshalled) == expected
+}
@@ -0,0 +1,231 @@
+package scan
+
+import (
+	"key-value-engine/structs/iterator"
+	"key-value-engine/structs/mergeOperator"
+	"key-value-engine/structs/record"
+)
+
+/*
+merger merges the iterators of the memtables and SSTables into one cursor that moves in both directions.
+The cursor sits between two records: Next returns the record after it and Prev the one before it,
+so Next followed by Prev returns the same record twice.
+While moving in one direction the iterators stay on the records next to the cursor on that side,
+changing the direction seeks every iterator to the other side of the cursor.
+*/
+type merger struct {
+	iterators       []iterator.Iterator
+	rangeTombstones []*record.Record // records they cover are skipped unless they are newer
+	mergeOperator   mergeOperator.MergeOperator
+	filter          *Filter // nil keeps every record
+
+	forward  *iterator.MergingIterator // merges the iterators moving forward
+	reverse  *iterator.MergingIterator // merges the iterators moving backward, made by the first move back
+	backward bool                      // the iterators are on the records before the cursor
+	key      string                    // the cursor is just before this key, or just after it if afterKey is set
+	afterKey bool
+	atEnd    bool  // the cursor is after the last record
+	err      error // first error of a table iterator, no records are returned after it
+}
+
+// failing is implemented by the iterators of the tables, Err returns the error that ended their last move
+type failing interface {
+	Err() error
+}
+
+func makeMerger(iterators []iterator.Iterator, rangeTombstones []*record.Record, operator mergeOperator.MergeOperator) merger {
+	sources := make([]iterator.Forward, len(iterators))
+	for i, it := range iterators {
+		sources[i] = it
+	}
+
+	return merger{
+		iterators:       iterators,
+		rangeTombstones: rangeTombstones,
+		mergeOperator:   operator,
+		forward:         iterator.MakeMergingIterator(sources, false),
+	}
+}
+
+// next returns the record after the cursor and moves the cursor past it, nil at the end
+func (m *merger) next() *record.Record {
+	if m.backward {
+		if m.atEnd {
+			return nil
+		}
+		for _, it := range m.iterators {
+			seekAfter(it, m.key, m.afterKey)
+		}
+		m.forward.Reset()
+		m.backward = false
+	}
+
+	if m.err != nil {
+		return nil
+	}
+	rec := m.resolve(m.forward)
+	if rec == nil || m.failed() {
+		m.atEnd = true
+		return nil
+	}
+	m.key, m.afterKey, m.atEnd = rec.GetKey(), true, false
+	return rec
+}
+
+// prev returns the record before the cursor and moves the cursor before it, nil at the start
+func (m *merger) prev() *record.Record {
+	if !m.backward {
+		for _, it := range m.iterators {
+			if m.atEnd {
+				it.SeekToLast()
+			} else {
+				seekBefore(it, m.key, m.afterKey)
+			}
+		}
+		m.reversed().Reset()
+		m.backward = true
+	}
+
+	if m.err != nil {
+		return nil
+	}
+	rec := m.resolve(m.reverse)
+	if rec == nil || m.failed() {
+		m.key, m.afterKey, m.atEnd = "", false, false
+		return nil
+	}
+	m.key, m.afterKey, m.atEnd = rec.GetKey(), false, false
+	return rec
+}
+
+// seek moves the cursor before the first record with a key not less than the given one
+func (m *merger) seek(key string) {
+	for _, it := range m.iterators {
+		it.Seek(key)
+	}
+	m.forward.Reset()
+	m.backward = false
+	m.key, m.afterKey, m.atEnd = key, false, false
+}
+
+// seekToLast moves the cursor after the last record
+func (m *merger) seekToLast() {
+	for _, it := range m.iterators {
+		it.SeekToLast()
+	}
+	m.reversed().Reset()
+	m.backward = true
+	m.atEnd = true
+}
+
+// stop drops the iterators, the merger returns no more records afterwards
+func (m *merger) stop() {
+	m.iterators = nil
+	m.forward = iterator.MakeMergingIterator(nil, false)
+	m.reverse = iterator.MakeMergingIterator(nil, true)
+}
+
+/*
+failed reports whether an iterator ran into an error, the error is kept,
+since the merge misses the records of the iterator after it and the versions they hide.
+*/
+func (m *merger) failed() bool {
+	for _, it := range m.iterators {
+		if f, ok := it.(failing); ok && f.Err() != nil {
+			m.err = f.Err()
+			return true
+		}
+	}
+	return false
+}
+
+// reversed returns the merge of the iterators moving backward
+func (m *merger) reversed() *iterator.MergingIterator {
+	if m.reverse == nil {
+		sources := make([]iterator.Forward, len(m.iterators))
+		for i, it := range m.iterators {
+			sources[i] = iterator.Reversed(it)
+		}
+		m.reverse = iterator.MakeMergingIterator(sources, true)
+	}
+	return m.reverse
+}
+
+/*
+page returns up to pageSize records after the given key, all records from the start if after is nil.
+The scan resumes with a seek, so the cost does not grow with the number of earlier pages
+and keys written before the cursor do not shift the records of the later pages.
+
+Returns:
+  - []*record.Record: Records of the page.
+  - *string: Key of the last record, the cursor of the next page, nil once there are no more records.
+*/
+func (m *merger) page(after *string, pageSize int) ([]*record.Record, *string) {
+	if pageSize < 1 {
+		return nil, after
+	}
+	if after != nil {
+		// the smallest key greater than the cursor
+		m.seek(*after + "\x00")
+	}
+
+	var records []*record.Record
+	for len(records) < pageSize {
+		rec := m.next()
+		if rec == nil {
+			return records, nil
+		}
+		records = append(records, rec)
+	}
+
+	if m.next() == nil {
+		return records, nil
+	}
+	last := records[len(records)-1].GetKey()
+	return records, &last
+}
+
+/*
+resolve returns the next record of the merge, in its direction,
+every version of a key is read and folded, so merge records are combined with the older versions from the other iterators.
+Deleted, expired and covered keys are skipped, so are the records the filter rejects.
+It returns nil once the iterators are exhausted.
+*/
+func (m *merger) resolve(merge *iterator.MergingIterator) *record.Record {
+	for {
+		versions := merge.NextVersions()
+		if versions == nil {
+			return nil
+		}
+
+		key := versions[0].GetKey()
+		if m.filter != nil && !m.filter.MatchKey(key) {
+			continue
+		}
+		rec := mergeOperator.Fold(m.mergeOperator, key, versions, record.CoveringSeq(m.rangeTombstones, key), true)
+		if rec.IsLive() && !rec.CoveredBy(m.rangeTombstones) && (m.filter == nil || m.filter.MatchValue(rec.GetValue())) {
+			return rec
+		}
+	}
+}
+
+// seekAfter moves the iterator to its first record after the cursor
+func seekAfter(it iterator.Iterator, key string, afterKey bool) {
+	it.Seek(key)
+	if afterKey && it.Valid() && it.Get().GetKey() == key {
+		it.Next()
+	}
+}
+
+// seekBefore moves the iterator to its last record before the cursor
+func seekBefore(it iterator.Iterator, key string, afterKey bool) {
+	it.Seek(key)
+	if !it.Valid() {
+		// every record of the iterator is before the key
+		it.SeekToLast()
+		return
+	}
+	if !afterKey || it.Get().GetKey() != key {
+		it.Prev()
+	}
+}
@@ -3,13 +3,16 @@ package skipList
 
 import (
 	"key-value-engine/structs/record"
+	"sort"
 	"strings"
 )
 import "key-value-engine/structs/iterator" // Update this path accordingly
 
+// SkipListIterator copies the matching records when created, so it stays valid
+// while the skip list keeps changing.
 type SkipListIterator struct {
-	skipList      *SkipList
-	currentNode   *Node
+	records       []*record.Record
+	index         int
 	minRange      string
 	maxRange      string
 	prefix        string
@@ -18,72 +21,84 @@ type SkipListIterator struct {
 
 func (s *SkipList) NewSkipListRangeIterator(minRange, maxRange string) iterator.Iterator {
 	it := &SkipListIterator{
-		skipList:      s,
 		minRange:      minRange,
 		maxRange:      maxRange,
 		rangeIterator: true,
 	}
 
-	// Initialize the iterator to the first valid node
-	it.seekToFirst()
+	it.collect(s)
 
 	return it
 }
 
 func (s *SkipList) NewSkipListPrefixIterator(prefix string) iterator.Iterator {
 	it := &SkipListIterator{
-		skipList:      s,
 		prefix:        prefix,
 		rangeIterator: false,
 	}
 
-	// Initialize the iterator to the first valid node
-	it.seekToFirst()
+	it.collect(s)
 
 	return it
 }
 
-func (it *SkipListIterator) seekToFirst() {
-	it.currentNode = it.skipList.head.next[0]
+// collect copies all records from the first valid node until the stop condition
+func (it *SkipListIterator) collect(s *SkipList) {
+	currentNode := s.head.next[0]
 
-	for it.currentNode != nil && it.checkCondition() {
-		it.currentNode = it.currentNode.next[0]
+	for currentNode != nil && it.checkCondition(currentNode) {
+		currentNode = currentNode.next[0]
 	}
 
+	for currentNode != nil && it.checkStopCondition(currentNode) {
+		it.records = append(it.records, currentNode.value)
+		currentNode = currentNode.next[0]
+	}
 }
 
 func (it *SkipListIterator) Valid() bool {
-	return it.currentNode != nil && it.checkStopCondition()
+	return it.index >= 0 && it.index < len(it.records)
 }
 
 func (it *SkipListIterator) Next() {
-	it.currentNode = it.currentNode.next[0]
+	it.index++
+}
 
-	for it.currentNode != nil && it.checkCondition() {
-		it.currentNode = it.currentNode.next[0]
-	}
+func (it *SkipListIterator) Prev() {
+	it.index--
+}
+
+// Seek moves the iterator to the first record with a key not less than the given one,
+// the copied records are all within the range or have the prefix
+func (it *SkipListIterator) Seek(key string) {
+	it.index = sort.Search(len(it.records), func(i int) bool {
+		return it.records[i].GetKey() >= key
+	})
+}
 
+func (it *SkipListIterator) SeekToLast() {
+	it.index = len(it.records) - 1
 }
 
 func (it *SkipListIterator) Get() *record.Record {
 	if it.Valid() {
-		return it.currentNode.value
+		return it.records[it.index]
 	}
 	return nil
 }
 
-func (it *SkipListIterator) checkStopCondition() bool {
+func (it *SkipListIterator) checkStopCondition(node *Node) bool {
 	if it.rangeIterator {
-		return it.currentNode.value.GetKey() <= it.maxRange
+		return node.value.GetKey() <= it.maxRange
 	} else {
-		return strings.HasPrefix(it.currentNode.value.GetKey(), it.prefix)
+		return strings.HasPrefix(node.value.GetKey(), it.prefix)
 	}
 }
 
-func (it *SkipListIterator) checkCondition() bool {
+func (it *SkipListIterator) checkCondition(node *Node) bool {
 	if it.rangeIterator {
-		return it.currentNode.value.GetKey() < it.minRange
+		return node.value.GetKey() < it.minRange
 	} else {
-		return !strings.HasPrefix(it.currentNode.value.GetKey(), it.prefix)
+		return !strings.HasPrefix(node.value.GetKey(), it.prefix)
 	}
 }
@@ -220,7 +220,7 @@ func (sst *SSTable) formIndex(dirPath string) error {
 			var bufSize [binary.MaxVarintLen64]byte
 
 			// Read the SSTEntry size from the file into the buffer
-			_, err = dataFile.Read(bufSize[:])
+			readSize, err := dataFile.Read(bufSize[:])
 			if err != nil {
 				return errors.New("error reading sst file")
 			}
@@ -228,7 +228,7 @@ func (sst *SSTable) formIndex(dirPath string) error {
 			// Decode the SSTEntry size from the buffer
 			entrySize, bytesRead := binary.Uvarint(bufSize[:])
 
-			_, err = dataFile.Seek(-int64(binary.MaxVarintLen64-bytesRead), 1)
+			_, err = dataFile.Seek(-int64(readSize-bytesRead), 1)
 			if err != nil {
 				return errors.New("error reading sst file")
 			}
@@ -257,11 +257,10 @@ func (sst *SSTable) formIndex(dirPath string) error {
 
 			var recBytes []byte
 
-			keySize := binary.LittleEndian.Uint64(headerBytes[record.KEY_SIZE_START:record.VALUE_SIZE_START])
-			valSize := binary.LittleEndian.Uint64(headerBytes[record.VALUE_SIZE_START:record.KEY_START])
+			bodySize := record.Size(headerBytes) - record.RECORD_HEADER_SIZE
 
 			// reading rest of the bytes
-			secondPartBytes := make([]byte, keySize+valSize)
+			secondPartBytes := make([]byte, bodySize)
 			_, err = dataFile.Read(secondPartBytes)
 			if err != nil {
 				return errors.New("error reading sst file")
@@ -543,7 +542,7 @@ func (sst *SSTable) formBfMt(dirPath string, dataLen int) error {
 			var bufSize [binary.MaxVarintLen64]byte
 
 			// Read the SSTEntry size from the file into the buffer
-			_, err = dataFile.Read(bufSize[:])
+			readSize, err := dataFile.Read(bufSize[:])
 			if err != nil {
 				return errors.New("error reading sst file")
 			}
@@ -551,7 +550,7 @@ func (sst *SSTable) formBfMt(dirPath string, dataLen int) error {
 			// Decode the SSTEntry size from the buffer
 			entrySize, bytesRead := binary.Uvarint(bufSize[:])
 
-			_, err = dataFile.Seek(-int64(binary.MaxVarintLen64-bytesRead), 1)
+			_, err = dataFile.Seek(-int64(readSize-bytesRead), 1)
 			if err != nil {
 				return errors.New("error reading sst file")
 			}
@@ -574,11 +573,10 @@ func (sst *SSTable) formBfMt(dirPath string, dataLen int) error {
 				return errors.New("error reading sst file")
 			}
 
-			keySize := binary.LittleEndian.Uint64(headerBytes[record.KEY_SIZE_START:record.VALUE_SIZE_START])
-			valSize := binary.LittleEndian.Uint64(headerBytes[record.VALUE_SIZE_START:record.KEY_START])
+			bodySize := record.Size(headerBytes) - record.RECORD_HEADER_SIZE
 
 			// reading rest of the bytes
-			secondPartBytes := make([]byte, keySize+valSize)
+			secondPartBytes := make([]byte, bodySize)
 			_, err = dataFile.Read(secondPartBytes)
 			if err != nil {
 				return errors.New("error reading sst file")
@@ -1039,7 +1037,7 @@ func (sst *SSTable) checkData(offset uint64, dirPath string) (*record.Record, er
 		var bufSize [binary.MaxVarintLen64]byte
 
 		// Read the SSTEntry size from the file into the buffer
-		_, err = file.Read(bufSize[:])
+		readSize, err := file.Read(bufSize[:])
 		if err != nil {
 			return nil, errors.New("error reading sst file")
 		}
@@ -1047,7 +1045,7 @@ func (sst *SSTable) checkData(offset uint64, dirPath string) (*record.Record, er
 		// Decode the SSTEntry size from the buffer
 		entrySize, bytesRead := binary.Uvarint(bufSize[:])
 
-		_, err = file.Seek(-int64(binary.MaxVarintLen64-bytesRead), 1)
+		_, err = file.Seek(-int64(readSize-bytesRead), 1)
 		if err != nil {
 			return nil, errors.New("error reading sst file")
 		}
@@ -1083,12 +1081,10 @@ func (sst *SSTable) checkData(offset uint64, dirPath string) (*record.Record, er
 			return nil, errors.New("error reading sst file")
 		}
 
-		// getting key size
-		keySize := binary.LittleEndian.Uint64(headerBytes[record.KEY_SIZE_START:record.VALUE_SIZE_START])
-		valSize := binary.LittleEndian.Uint64(headerBytes[record.VALUE_SIZE_START:record.KEY_START])
+		bodySize := record.Size(headerBytes) - record.RECORD_HEADER_SIZE
 
 		// reading rest of the bytes
-		secondPartBytes := make([]byte, keySize+valSize)
+		secondPartBytes := make([]byte, bodySize)
 		_, err = file.Read(secondPartBytes)
 		if err != nil {
 			return nil, errors.New("error reading sst file")
@@ -1112,44 +1108,61 @@ func (sst *SSTable) checkData(offset uint64, dirPath string) (*record.Record, er
 }
 
 func (sst *SSTable) checkMerkle(data []byte, dirPath string) (bool, error) {
+	mtBytes, err := readMerkle(dirPath)
+	if err != nil {
+		return false, err
+	}
+
+	mt, err := merkleTree.BytesToMerkleTree(mtBytes)
+	if err != nil {
+		return false, err
+	}
+
+	valid, _ := mt.CheckValidityOfNode(data)
+
+	return valid, nil
+}
+
+// readMerkle returns the stored merkle tree of the table
+func readMerkle(dirPath string) ([]byte, error) {
 	var err error
 	var file *os.File
 	var header []uint64
 	var eof int64
 	files, err := readTOC(dirPath)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	if len(files) > 1 {
 		path := dirPath + MERKLENAME
 		file, err = os.Open(path)
 		if err != nil {
-			return false, errors.New("error reading sst file")
+			return nil, errors.New("error reading sst file")
 		}
 		defer file.Close()
 
 		eof, err = file.Seek(0, 2)
 		if err != nil {
-			return false, errors.New("error reading sst file")
+			return nil, errors.New("error reading sst file")
 		}
 
 		_, err = file.Seek(0, 0)
 		if err != nil {
-			return false, errors.New("error reading sst file")
+			return nil, errors.New("error reading sst file")
 		}
 	} else {
 		path := dirPath + SINGLEFILENAME
 		file, err = os.Open(path)
 		if err != nil {
-			return false, errors.New("error reading sst file")
+			return nil, errors.New("error reading sst file")
 		}
 		defer file.Close()
 
 		headerBytes := make([]byte, 5*OFFSETSIZE)
 		_, err = file.Read(headerBytes)
 		if err != nil {
-			return false, errors.New("error reading sst file")
+			return nil, errors.New("error reading sst file")
 		}
 
 		header = []uint64{
@@ -1162,12 +1175,12 @@ func (sst *SSTable) checkMerkle(data []byte, dirPath string) (bool, error) {
 
 		eof, err = file.Seek(0, 2)
 		if err != nil {
-			return false, errors.New("error reading sst file")
+			return nil, errors.New("error reading sst file")
 		}
 
 		_, err = file.Seek(int64(header[4]), 0)
 		if err != nil {
-			return false, errors.New("error reading sst file")
+			return nil, errors.New("error reading sst file")
 		}
 	}
 
@@ -1176,15 +1189,8 @@ func (sst *SSTable) checkMerkle(data []byte, dirPath string) (bool, error) {
 	mtBytes := make([]byte, eof-pos)
 	_, err = file.Read(mtBytes)
 	if err != nil {
-		return false, errors.New("error reading sst file")
-	}
-
-	mt, err := merkleTree.BytesToMerkleTree(mtBytes)
-	if err != nil {
-		return false, err
+		return nil, errors.New("error reading sst file")
 	}
 
-	valid, _ := mt.CheckValidityOfNode(data)
-
-	return valid, nil
+	return mtBytes, nil
 }
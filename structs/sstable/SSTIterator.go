@@ -1,7 +1,10 @@
 package sstable
 
 import (
+	"bufio"
 	"encoding/binary"
+	"errors"
+	"io"
 	"key-value-engine/structs/iterator"
 	"key-value-engine/structs/record"
 	"os"
@@ -16,14 +19,15 @@ type SSTableIterator struct {
 	sst      *SSTable
 
 	current *record.Record
-	offset  int64
+	offset  int64         // position in the index after the current entry, 0 is the start of the index
+	summary *tableSummary // read by the first seek, nil if it cannot be read
 
 	finish        bool
 	rangeIterator bool
+	err           error // error that ended the last move, the iterator is not valid after it
 }
 
 func (sst *SSTable) NewSSTRangeIterator(minRange, maxRange, dirPath string) iterator.Iterator {
-	//if the table doesn't have any fitting values skip it
 	it := &SSTableIterator{
 		dirPath:       dirPath,
 		minRange:      minRange,
@@ -31,48 +35,41 @@ func (sst *SSTable) NewSSTRangeIterator(minRange, maxRange, dirPath string) iter
 		sst:           sst,
 		offset:        0, //initial offset
 		rangeIterator: true,
-		finish:        !sst.iteratorSummaryCheck(dirPath, minRange, maxRange), //should end if not in summary
 	}
 
-	//geting first valid
-	it.Next()
+	//geting first valid, the summary skips the blocks before the range
+	it.Seek(minRange)
 
 	return it
 
 }
 
 func (sst *SSTable) NewSSTPrefixIterator(prefix, dirPath string) iterator.Iterator {
-	//if the table doesn't have any fitting values skip it
 	it := &SSTableIterator{
 		dirPath:       dirPath,
 		prefix:        prefix,
 		sst:           sst,
 		offset:        0, //initial offset
 		rangeIterator: false,
-		finish:        false,
 	}
 
 	//geting first valid
-	it.Next()
+	it.Seek(prefix)
 
 	return it
 
 }
 
 func (it *SSTableIterator) Valid() bool {
-	//I need to be able to see if the next is null without moving the offset.
 	return it.current != nil
-	/*if it.finish {
-		return false //if I already did this before
-	}
-	oldOffset := it.offset
-	oldCurrent := it.current
-	it.Next()
-
-	//If I moved the offset I wouldn't be able to access current (get)
-	it.offset = oldOffset
-	it.current = oldCurrent
-	return !it.finish*/
+}
+
+/*
+Err returns the error that ended the last move, nil if it ended because no record was left.
+The index or the data of the table could not be read, so the records after the failed move are missing.
+*/
+func (it *SSTableIterator) Err() error {
+	return it.err
 }
 
 // Get returns the record at the current iterator position.
@@ -80,204 +77,231 @@ func (it *SSTableIterator) Get() *record.Record {
 	return it.current
 }
 
-func (sst *SSTable) iteratorSummaryCheck(dirPath, minRange, maxRange string) bool {
-	var err error
-	var file *os.File
-	var header []uint64
-	var eof int64
-	files, err := readTOC(dirPath)
-	if err != nil {
-		return false
+// Next moves to the next entry of the index within the range or with the prefix
+func (it *SSTableIterator) Next() {
+	it.forward(it.offset, it.startKey(""))
+}
+
+/*
+Prev moves to the previous entry of the index.
+Entries of the index are read only forward, so the search starts from the summary entry before the current key.
+*/
+func (it *SSTableIterator) Prev() {
+	if it.current == nil {
+		return
 	}
 
-	if len(files) > 1 {
-		path := dirPath + SUMMARYNAME
-		file, err = os.Open(path)
-		if err != nil {
-			return false
-		}
-		defer file.Close()
+	key := it.current.GetKey()
+	it.backward(func(indexKey string) bool {
+		return indexKey < key
+	})
+}
 
-		eof, err = file.Seek(0, 2)
-		if err != nil {
-			return false
-		}
+// Seek moves to the first entry with a key not less than the given one, starting from its block of the summary
+func (it *SSTableIterator) Seek(key string) {
+	key = it.startKey(key)
 
-		_, err = file.Seek(0, 0)
-		if err != nil {
-			return false
+	offset := int64(0)
+	if summary := it.loadSummary(); summary != nil {
+		if key > summary.highKey {
+			it.current, it.finish = nil, true
+			return
 		}
+		offset = int64(summary.blockStart(func(summaryKey string) bool {
+			return summaryKey <= key
+		}))
+	}
 
-	} else {
-		path := dirPath + SINGLEFILENAME
-		file, err = os.Open(path)
-		if err != nil {
-			return false
-		}
-		defer file.Close()
+	it.forward(offset, key)
+}
 
-		headerBytes := make([]byte, 5*OFFSETSIZE)
-		_, err = file.Read(headerBytes)
-		if err != nil {
-			return false
+// SeekToLast moves to the last entry within the range or with the prefix
+func (it *SSTableIterator) SeekToLast() {
+	it.backward(func(indexKey string) bool {
+		return !it.pastEnd(indexKey)
+	})
+}
+
+// forward moves to the first entry from the offset with a key not less than the given one
+func (it *SSTableIterator) forward(offset int64, key string) {
+	it.current, it.finish, it.err = nil, true, nil
+
+	it.err = scanIndex(it.dirPath, offset, func(entry indexEntry, next int64) bool {
+		if entry.key < key {
+			return true
+		}
+		if !it.pastEnd(entry.key) {
+			it.land(entry, next)
 		}
+		return false
+	})
+}
 
-		header = []uint64{
-			binary.LittleEndian.Uint64(headerBytes[:OFFSETSIZE]),
-			binary.LittleEndian.Uint64(headerBytes[OFFSETSIZE : 2*OFFSETSIZE]),
-			binary.LittleEndian.Uint64(headerBytes[2*OFFSETSIZE : 3*OFFSETSIZE]),
-			binary.LittleEndian.Uint64(headerBytes[3*OFFSETSIZE : 4*OFFSETSIZE]),
-			binary.LittleEndian.Uint64(headerBytes[4*OFFSETSIZE:]),
+/*
+backward moves to the last entry whose key is accepted, the accepted keys must come before the rejected ones.
+The scan starts from the last summary entry that is accepted, so at most one block of the index is read.
+*/
+func (it *SSTableIterator) backward(accept func(key string) bool) {
+	it.current, it.finish, it.err = nil, true, nil
+
+	offset := int64(0)
+	if summary := it.loadSummary(); summary != nil {
+		if len(summary.entries) == 0 || !accept(summary.entries[0].key) {
+			return
 		}
+		offset = int64(summary.blockStart(accept))
+	}
 
-		_, err = file.Seek(int64(header[2]), 0)
-		if err != nil {
+	var last *indexEntry
+	var lastNext int64
+	it.err = scanIndex(it.dirPath, offset, func(entry indexEntry, next int64) bool {
+		if !accept(entry.key) {
 			return false
 		}
-
-		eof = int64(header[3])
+		last, lastNext = &entry, next
+		return true
+	})
+	if it.err != nil {
+		return
 	}
 
-	// reading low-key size
-	keySizeBytes := make([]byte, record.KEY_SIZE_SIZE)
-	_, err = file.Read(keySizeBytes)
-	if err != nil {
-		return false
+	if last != nil && it.inBounds(last.key) {
+		it.land(*last, lastNext)
 	}
+}
 
-	keySize := binary.LittleEndian.Uint64(keySizeBytes)
+// land reads the record of the index entry and makes it the current one, next is the position after the entry
+func (it *SSTableIterator) land(entry indexEntry, next int64) {
+	rec, err := it.sst.checkData(entry.offset, it.dirPath)
+	it.current = rec
+	it.offset = next
+	it.finish = rec == nil
+	it.err = err
+}
 
-	// reading low-key
-	lowKey := make([]byte, keySize)
-	_, err = file.Read(lowKey)
-	if err != nil {
-		return false
+func (it *SSTableIterator) loadSummary() *tableSummary {
+	if it.summary == nil {
+		it.summary, _ = readSummary(it.dirPath)
 	}
+	return it.summary
+}
 
-	// readinf high-key size
-	_, err = file.Read(keySizeBytes)
-	if err != nil {
-		return false
+// startKey returns the key a seek starts from, keys before the range or the prefix are never visited
+func (it *SSTableIterator) startKey(key string) string {
+	if it.rangeIterator && key < it.minRange {
+		return it.minRange
 	}
-	keySize = binary.LittleEndian.Uint64(keySizeBytes)
-
-	// reading high-key
-	highKey := make([]byte, keySize)
-	_, err = file.Read(highKey)
-	if err != nil {
-		return false
+	if !it.rangeIterator && key < it.prefix {
+		return it.prefix
 	}
+	return key
+}
 
-	_ = eof
-	// if out of range
-	if maxRange < string(lowKey) || minRange > string(highKey) {
-		return false
-	} else {
-		return true
+// pastEnd reports whether the key comes after the range or the keys with the prefix
+func (it *SSTableIterator) pastEnd(key string) bool {
+	if it.rangeIterator {
+		return key > it.maxRange
 	}
+	return key > it.prefix && !strings.HasPrefix(key, it.prefix)
 }
 
-func (it *SSTableIterator) Next() {
-	var file *os.File
-	var header []uint64
-	var eof int64
-	files, _ := readTOC(it.dirPath)
-
-	if len(files) > 1 {
-		path := it.dirPath + INDEXNAME
-		file, _ = os.Open(path)
-
-		defer file.Close()
-
-		eof, _ = file.Seek(0, 2)
-
-		_, _ = file.Seek(0, 0)
-
-	} else {
-		path := it.dirPath + SINGLEFILENAME
-		file, _ = os.Open(path)
-
-		defer file.Close()
-
-		headerBytes := make([]byte, 5*OFFSETSIZE)
-		file.Read(headerBytes)
-
-		header = []uint64{
-			binary.LittleEndian.Uint64(headerBytes[:OFFSETSIZE]),
-			binary.LittleEndian.Uint64(headerBytes[OFFSETSIZE : 2*OFFSETSIZE]),
-			binary.LittleEndian.Uint64(headerBytes[2*OFFSETSIZE : 3*OFFSETSIZE]),
-			binary.LittleEndian.Uint64(headerBytes[3*OFFSETSIZE : 4*OFFSETSIZE]),
-			binary.LittleEndian.Uint64(headerBytes[4*OFFSETSIZE:]),
-		}
+func (it *SSTableIterator) inBounds(key string) bool {
+	if it.rangeIterator {
+		return key >= it.minRange && key <= it.maxRange
+	}
+	return strings.HasPrefix(key, it.prefix)
+}
 
-		file.Seek(int64(header[1]), 0)
+/*
+scanIndex reads the entries of the index of the table from the offset, 0 being the start of the index,
+and passes each one to visit with the position after it, until visit returns false or the index ends.
 
-		eof = int64(header[2])
+Returns:
+  - error: Error, if any, during opening or reading the index, the entries after it are not visited.
+*/
+func scanIndex(dirPath string, offset int64, visit func(entry indexEntry, next int64) bool) error {
+	file, start, end, err := openIndex(dirPath)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	if it.offset != 0 {
-		file.Seek(it.offset, 0)
+	if offset == 0 {
+		offset = start
+	}
+	if offset > end {
+		return nil
 	}
 
-	// looping through all entries in one range of index
-	for {
-		position, _ := file.Seek(0, 1)
-		if position == eof {
-			break
-		}
-
+	reader := bufio.NewReader(io.NewSectionReader(file, offset, end-offset))
+	keySizeBytes := make([]byte, record.KEY_SIZE_SIZE)
+	offsetBytes := make([]byte, OFFSETSIZE)
+	for offset < end {
 		// reading key size
-		keySizeBytes := make([]byte, record.KEY_SIZE_SIZE)
-		file.Read(keySizeBytes)
-
+		_, err = io.ReadFull(reader, keySizeBytes)
+		if err != nil {
+			return errors.New("error reading sst file")
+		}
 		keySize := binary.LittleEndian.Uint64(keySizeBytes)
+		if keySize > uint64(end-offset) {
+			return errors.New("error reading sst file")
+		}
 
 		// reading key
 		readKey := make([]byte, keySize)
-		file.Read(readKey)
+		_, err = io.ReadFull(reader, readKey)
+		if err != nil {
+			return errors.New("error reading sst file")
+		}
 
 		// reading offset
-		offsetBytes := make([]byte, OFFSETSIZE)
-		file.Read(offsetBytes)
-
-		offsetData := binary.LittleEndian.Uint64(offsetBytes)
-
-		if it.rangeIterator {
-			// stop condition
-			if string(readKey) > it.maxRange {
-				it.finish = true
-				it.current = nil
-				return
-			} else if string(readKey) < it.minRange { //if we haven't reached first good element
-				continue
-			} else { // minRange < string(readKey) < maxRange
-				// continue search in Data
-				pos, _ := file.Seek(0, 1)
-				it.offset = pos
-				rec, _ := it.sst.checkData(offsetData, it.dirPath)
-				it.current = rec
-				return
-			}
-		} else {
-			if strings.HasPrefix(string(readKey), it.prefix) {
-				// continue search in Data
-				pos, _ := file.Seek(0, 1)
-				it.offset = pos
-				rec, _ := it.sst.checkData(offsetData, it.dirPath)
-				it.current = rec
-				return
-			} else if it.current == nil { //first iteration
-				continue //keep searching for the first element
-			} else {
-				it.finish = true
-				it.current = nil
-				return //if not first, and no longer has pre-fix it has no excuse break
-			}
+		_, err = io.ReadFull(reader, offsetBytes)
+		if err != nil {
+			return errors.New("error reading sst file")
+		}
+
+		offset += int64(record.KEY_SIZE_SIZE + keySize + OFFSETSIZE)
+		entry := indexEntry{key: string(readKey), offset: binary.LittleEndian.Uint64(offsetBytes)}
+		if !visit(entry, offset) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// openIndex opens the file holding the index of the table and returns where the index starts and ends in it
+func openIndex(dirPath string) (*os.File, int64, int64, error) {
+	files, err := readTOC(dirPath)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	if len(files) > 1 {
+		file, err := os.Open(dirPath + INDEXNAME)
+		if err != nil {
+			return nil, 0, 0, errors.New("error reading sst file")
 		}
+		end, err := file.Seek(0, 2)
+		if err != nil {
+			file.Close()
+			return nil, 0, 0, errors.New("error reading sst file")
+		}
+		return file, 0, end, nil
+	}
 
+	file, err := os.Open(dirPath + SINGLEFILENAME)
+	if err != nil {
+		return nil, 0, 0, errors.New("error reading sst file")
+	}
+	headerBytes := make([]byte, 3*OFFSETSIZE)
+	_, err = file.ReadAt(headerBytes, 0)
+	if err != nil {
+		file.Close()
+		return nil, 0, 0, errors.New("error reading sst file")
 	}
+	start := int64(binary.LittleEndian.Uint64(headerBytes[OFFSETSIZE : 2*OFFSETSIZE]))
+	end := int64(binary.LittleEndian.Uint64(headerBytes[2*OFFSETSIZE : 3*OFFSETSIZE]))
 
-	it.finish = true
-	it.current = nil
-	return
+	return file, start, end, nil
 }
@@ -1,17 +1,21 @@
 package sstable
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"key-value-engine/structs/iterator"
+	"key-value-engine/structs/mergeOperator"
 	"key-value-engine/structs/record"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
 const (
-	DIRECTORY      = "data" + string(os.PathSeparator) + "sstable"
-	SUBDIR         = DIRECTORY + string(os.PathSeparator)
+	DIRNAME        = "sstable"
 	DATANAME       = "SST_Data.db"
 	INDEXNAME      = "SST_Index.db"
 	SUMMARYNAME    = "SST_Summary.db"
@@ -20,11 +24,20 @@ const (
 	MERKLENAME     = "SST_Merkle.db"
 	GLOBALDICTNAME = "SST_Dict.json"
 	SINGLEFILENAME = "SST.db"
+	SEQNAME        = "SEQ"      // greatest sequence number written to the SSTables, kept in the sstable directory
+	OBSOLETENAME   = "OBSOLETE" // marks a compacted table kept for a snapshot, it is removed at the next start
+	RANGEDELNAME   = "SST_RangeDel.db"
 	OFFSETSIZE     = 8
 	HEADERSIZE     = 5 * OFFSETSIZE
 )
 
+// SSTable is guarded by the DB lock: Get and iterator creation run under the read lock,
+// Flush and compaction under the write lock.
+// Pinning tables for snapshots is guarded by pinLock, so tables can be pinned under the read lock
+// and unpinned without holding the DB lock.
+// The range tombstones kept in memory are guarded by rangeLock for the same reason.
 type SSTable struct {
+	directory          string
 	nextIndex          int
 	summaryFactor      int
 	multipleFiles      bool
@@ -35,24 +48,55 @@ type SSTable struct {
 	compressionTypeLSM string // size-tiered or leveled
 	firstLeveledSize   uint64
 	leveledInc         uint64
+	lastSeq            uint64
+	pins               map[string]int  // number of snapshots reading each table
+	obsolete           map[string]bool // compacted tables kept until their snapshots are released
+	pinLock            sync.Mutex
+	rangeTombstones    map[string][]*record.Record // range tombstones of each table
+	rangeLock          sync.RWMutex
+	mergeOperator      mergeOperator.MergeOperator // folds merge records during compaction
 }
 
-func MakeSSTable(summaryFactor int, multipleFiles bool, filterProbability float64, compress bool, maxLSMLevels int, tablesToCompress int, compressionType string, firstLeveledSize uint64, leveledInc uint64) (*SSTable, error) {
-	if _, err := os.Stat(DIRECTORY); os.IsNotExist(err) {
-		if err := os.MkdirAll(DIRECTORY, 0755); err != nil {
+func MakeSSTable(dataDir string, summaryFactor int, multipleFiles bool, filterProbability float64, compress bool, maxLSMLevels int, tablesToCompress int, compressionType string, firstLeveledSize uint64, leveledInc uint64, operator mergeOperator.MergeOperator) (*SSTable, error) {
+	directory := filepath.Join(dataDir, DIRNAME)
+	if _, err := os.Stat(directory); os.IsNotExist(err) {
+		if err := os.MkdirAll(directory, 0755); err != nil {
 			return nil, fmt.Errorf("error creating sstable directory: %s", err)
 		}
 	}
 
-	subdirs, err := getSubdirs(DIRECTORY)
+	err := removeObsolete(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	subdirs, err := getSubdirs(directory)
 	if err != nil {
 		return nil, fmt.Errorf("error getting SST directories: %s\n", err)
 	}
 
-	count := len(subdirs) + 1
+	// indexes keep growing after compaction removes tables, so the order of tables is never mixed up
+	nextIndex := 1
+	for _, subdir := range subdirs {
+		_, index, ok := parseDirName(subdir)
+		if ok && index >= nextIndex {
+			nextIndex = index + 1
+		}
+	}
+
+	lastSeq, err := readLastSeq(directory, len(subdirs) > 0)
+	if err != nil {
+		return nil, err
+	}
+
+	rangeTombstones, err := loadRangeTombstones(directory, subdirs)
+	if err != nil {
+		return nil, err
+	}
 
 	return &SSTable{
-		nextIndex:          count,
+		directory:          directory,
+		nextIndex:          nextIndex,
 		summaryFactor:      summaryFactor,
 		multipleFiles:      multipleFiles,
 		filterProbability:  filterProbability,
@@ -62,37 +106,151 @@ func MakeSSTable(summaryFactor int, multipleFiles bool, filterProbability float6
 		compressionTypeLSM: compressionType,
 		firstLeveledSize:   firstLeveledSize,
 		leveledInc:         leveledInc,
+		lastSeq:            lastSeq,
+		pins:               make(map[string]int),
+		obsolete:           make(map[string]bool),
+		rangeTombstones:    rangeTombstones,
+		mergeOperator:      operator,
 	}, nil
 }
 
+/*
+readLastSeq reads the greatest sequence number written to the SSTables.
+Tables written before sequence numbers were introduced hold second timestamps in their place,
+so without the SEQ file the current time in seconds is used to keep new records newer than them.
+*/
+func readLastSeq(directory string, hasTables bool) (uint64, error) {
+	content, err := os.ReadFile(filepath.Join(directory, SEQNAME))
+	if os.IsNotExist(err) {
+		if hasTables {
+			return uint64(time.Now().Unix()), nil
+		}
+		return 0, nil
+	}
+	if err != nil || len(content) != 8 {
+		return 0, errors.New("error reading sequence number file")
+	}
+
+	return binary.LittleEndian.Uint64(content), nil
+}
+
+// writeLastSeq replaces the SEQ file, the new content is renamed into place so the file is never partially written
+func (sst *SSTable) writeLastSeq() error {
+	content := make([]byte, 8)
+	binary.LittleEndian.PutUint64(content, sst.lastSeq)
+
+	tmpPath := filepath.Join(sst.directory, SEQNAME+".tmp")
+	err := os.WriteFile(tmpPath, content, 0644)
+	if err != nil {
+		return errors.New("error writting sequence number file")
+	}
+
+	err = os.Rename(tmpPath, filepath.Join(sst.directory, SEQNAME))
+	if err != nil {
+		return errors.New("error writting sequence number file")
+	}
+	return nil
+}
+
+/*
+LastSeq returns the greatest sequence number written to the SSTables.
+*/
+func (sst *SSTable) LastSeq() uint64 {
+	return sst.lastSeq
+}
+
+/*
+Get returns the newest version of the key in the SSTables, including tombstones.
+Tables are searched from the lowest level and within a level from the greatest index,
+which is the order of decreasing sequence numbers, so the first version found is the newest one.
+*/
 func (sst *SSTable) Get(key string) (*record.Record, error) {
-	tiers, err := sst.getDirsByTier()
+	_, err := sst.getDirsByTier()
 	if err != nil {
 		return nil, err
 	}
 
-	// looping backwards
-	for i := 0; i < len(tiers); i++ {
-		for j := len(tiers[i]) - 1; j >= 0; j-- {
-			subdir := tiers[i][j]
+	return sst.GetFrom(key, sst.getIteratorDirs())
+}
 
-			found, err := sst.checkBf(key, subdir)
-			if err != nil {
-				return nil, err
-			}
+/*
+GetFrom returns the first version of the key found in the tables, searched in the given order.
+It is used with tables pinned by a snapshot, which are listed in the same order as for Get.
+If a newer range tombstone in the tables covers the key, a tombstone is returned instead of the found version.
+*/
+func (sst *SSTable) GetFrom(key string, dirs []string) (*record.Record, error) {
+	for _, subdir := range dirs {
+		found, err := sst.checkBf(key, subdir)
+		if err != nil {
+			return nil, err
+		}
 
-			if found != nil {
-				return found, nil
+		if found != nil {
+			rangeSeq := record.CoveringSeq(sst.GetRangeTombstones(dirs), key)
+			if rangeSeq > found.GetSeq() {
+				return record.MakeRecord(key, nil, true, rangeSeq), nil
 			}
+			return found, nil
 		}
 	}
 
 	return nil, nil
 }
 
-func (sst *SSTable) Flush(data []*record.Record) error {
+/*
+GetVersionsFrom returns the versions of the key found in the tables, searched in the given order, newest first.
+The search stops at the first version that is not a merge record, the older ones are not needed to fold the merges.
+*/
+func (sst *SSTable) GetVersionsFrom(key string, dirs []string) ([]*record.Record, error) {
+	var versions []*record.Record
+	for _, subdir := range dirs {
+		found, err := sst.checkBf(key, subdir)
+		if err != nil {
+			return nil, err
+		}
+
+		if found != nil {
+			versions = append(versions, found)
+			if !found.IsMerge() {
+				break
+			}
+		}
+	}
+
+	return versions, nil
+}
+
+/*
+GetVersions returns the versions of the key in the current tables, like GetVersionsFrom.
+*/
+func (sst *SSTable) GetVersions(key string) ([]*record.Record, error) {
+	_, err := sst.getDirsByTier()
+	if err != nil {
+		return nil, err
+	}
+
+	return sst.GetVersionsFrom(key, sst.getIteratorDirs())
+}
+
+/*
+MergeOperator returns the operator folding merge records.
+*/
+func (sst *SSTable) MergeOperator() mergeOperator.MergeOperator {
+	return sst.mergeOperator
+}
+
+/*
+Flush writes the records of a memtable, sorted by key, and its range tombstones into a new table on the first level.
+*/
+func (sst *SSTable) Flush(data []*record.Record, rangeTombstones []*record.Record) error {
+	if len(data) == 0 && len(rangeTombstones) > 0 {
+		// a memtable written only with DeleteRange, a table needs at least one record as in extractDataSizeTier
+		first := rangeTombstones[0]
+		data = []*record.Record{record.MakeRecord(first.GetKey(), nil, true, first.GetSeq())}
+	}
+
 	// making directory for SSTable
-	dirPath := SUBDIR + "C1_SST_" + fmt.Sprintf("%d", sst.nextIndex)
+	dirPath := sst.directory + string(os.PathSeparator) + "C1_SST_" + fmt.Sprintf("%d", sst.nextIndex)
 	err := os.Mkdir(dirPath, os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("error making SST direcory: %s\n", err)
@@ -138,6 +296,21 @@ func (sst *SSTable) Flush(data []*record.Record) error {
 		return err
 	}
 
+	err = sst.writeRangeTombstones(dirPath, rangeTombstones)
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range data {
+		if rec.GetSeq() > sst.lastSeq {
+			sst.lastSeq = rec.GetSeq()
+		}
+	}
+	err = sst.writeLastSeq()
+	if err != nil {
+		return err
+	}
+
 	err = sst.Compress()
 	if err != nil {
 		return err
@@ -166,6 +339,123 @@ func (sst *SSTable) GetSSTPrefixIterators(prefix string) []iterator.Iterator {
 	return sstIterators
 }
 
+// GetSSTRangeTombstones returns the range tombstones of the current tables
+func (sst *SSTable) GetSSTRangeTombstones() []*record.Record {
+	return sst.GetRangeTombstones(sst.getIteratorDirs())
+}
+
+/*
+GetPinnedRangeIterators returns iterators over the given tables, usually the ones pinned by a snapshot.
+*/
+func (sst *SSTable) GetPinnedRangeIterators(dirs []string, minRange, maxRange string) []iterator.Iterator {
+	var sstIterators []iterator.Iterator
+
+	for _, path := range dirs {
+		sstIterators = append(sstIterators, sst.NewSSTRangeIterator(minRange, maxRange, path))
+	}
+
+	return sstIterators
+}
+
+/*
+GetPinnedPrefixIterators returns iterators over the given tables, usually the ones pinned by a snapshot.
+*/
+func (sst *SSTable) GetPinnedPrefixIterators(dirs []string, prefix string) []iterator.Iterator {
+	var sstIterators []iterator.Iterator
+
+	for _, path := range dirs {
+		sstIterators = append(sstIterators, sst.NewSSTPrefixIterator(prefix, path))
+	}
+
+	return sstIterators
+}
+
+/*
+Pin returns the current tables, in the order they are searched by Get, and keeps them on disk
+until Unpin is called, even if compaction replaces them in the meantime.
+*/
+func (sst *SSTable) Pin() []string {
+	dirs := sst.getIteratorDirs()
+
+	sst.pinLock.Lock()
+	defer sst.pinLock.Unlock()
+
+	for _, dir := range dirs {
+		sst.pins[dir]++
+	}
+
+	return dirs
+}
+
+/*
+Unpin releases tables returned by Pin, compacted tables that are no longer pinned are removed.
+*/
+func (sst *SSTable) Unpin(dirs []string) error {
+	sst.pinLock.Lock()
+	defer sst.pinLock.Unlock()
+
+	var err error
+	for _, dir := range dirs {
+		sst.pins[dir]--
+		if sst.pins[dir] > 0 {
+			continue
+		}
+		delete(sst.pins, dir)
+
+		if sst.obsolete[dir] {
+			delete(sst.obsolete, dir)
+			sst.forgetRangeTombstones(dir)
+			if removeErr := os.RemoveAll(dir); removeErr != nil {
+				err = errors.New("error removing sstable directory")
+			}
+		}
+	}
+
+	return err
+}
+
+/*
+removeTable removes a table replaced by compaction.
+A pinned table is only marked as obsolete, it is hidden from new reads and removed when it is unpinned,
+or at the next start if the process stops before that.
+*/
+func (sst *SSTable) removeTable(dir string) error {
+	sst.pinLock.Lock()
+	defer sst.pinLock.Unlock()
+
+	if sst.pins[dir] == 0 {
+		sst.forgetRangeTombstones(dir)
+		return os.RemoveAll(dir)
+	}
+
+	sst.obsolete[dir] = true
+	err := os.WriteFile(filepath.Join(dir, OBSOLETENAME), nil, 0644)
+	if err != nil {
+		return errors.New("error marking sstable directory as obsolete")
+	}
+	return nil
+}
+
+// removeObsolete removes the tables that were kept for snapshots when the process stopped
+func removeObsolete(directory string) error {
+	subdirs, err := getSubdirs(directory)
+	if err != nil {
+		return fmt.Errorf("error getting SST directories: %s\n", err)
+	}
+
+	for _, subdir := range subdirs {
+		dir := filepath.Join(directory, subdir)
+		if _, err := os.Stat(filepath.Join(dir, OBSOLETENAME)); err == nil {
+			err = os.RemoveAll(dir)
+			if err != nil {
+				return errors.New("error removing sstable directory")
+			}
+		}
+	}
+
+	return nil
+}
+
 func (sst *SSTable) getIteratorDirs() []string {
 	var singleSSTPath []string
 
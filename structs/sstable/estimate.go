@@ -0,0 +1,109 @@
+package sstable
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+/*
+EstimatePrefix estimates the records with keys starting with the prefix from the indexes of the tables,
+without reading the records, see EstimateRange.
+*/
+func (sst *SSTable) EstimatePrefix(prefix string) (int, int64, error) {
+	return sst.estimate(prefix, func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+/*
+EstimateRange estimates the records with keys within [minRange, maxRange] from the indexes of the tables,
+the summaries skip the blocks before the range and the records themselves are not read.
+Every version in the tables is counted, so overwritten, deleted and expired keys are counted too.
+
+Returns:
+  - int: Number of index entries within the range.
+  - int64: Bytes the records of the entries take in the data of the tables.
+  - error: Error, if any, during reading the tables.
+*/
+func (sst *SSTable) EstimateRange(minRange, maxRange string) (int, int64, error) {
+	return sst.estimate(minRange, func(key string) bool {
+		return key <= maxRange
+	})
+}
+
+/*
+estimate adds up the index entries from the start key while inRange accepts them, over every table.
+The size of a table's part is the distance in its data between the first entry of the part and the entry after it.
+*/
+func (sst *SSTable) estimate(start string, inRange func(key string) bool) (int, int64, error) {
+	count, size := 0, int64(0)
+	for _, dirPath := range sst.getIteratorDirs() {
+		summary, err := readSummary(dirPath)
+		if err != nil {
+			return 0, 0, err
+		}
+		if start > summary.highKey || (summary.lowKey >= start && !inRange(summary.lowKey)) {
+			continue
+		}
+		offset := int64(summary.blockStart(func(summaryKey string) bool {
+			return summaryKey <= start
+		}))
+
+		first, end := int64(-1), int64(-1)
+		err = scanIndex(dirPath, offset, func(entry indexEntry, next int64) bool {
+			if entry.key < start {
+				return true
+			}
+			if !inRange(entry.key) {
+				end = int64(entry.offset)
+				return false
+			}
+			if first == -1 {
+				first = int64(entry.offset)
+			}
+			count++
+			return true
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+		if first == -1 {
+			continue
+		}
+
+		if end == -1 {
+			end, err = dataEnd(dirPath)
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+		size += end - first
+	}
+
+	return count, size, nil
+}
+
+// dataEnd returns the offset after the last record of the table, in the file holding its data
+func dataEnd(dirPath string) (int64, error) {
+	files, err := readTOC(dirPath)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(files) > 1 {
+		info, err := os.Stat(dirPath + DATANAME)
+		if err != nil {
+			return 0, errors.New("error reading sst file")
+		}
+		return info.Size(), nil
+	}
+
+	// in a single file the index follows the data
+	file, start, _, err := openIndex(dirPath)
+	if err != nil {
+		return 0, err
+	}
+	file.Close()
+	return start, nil
+}
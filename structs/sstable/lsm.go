@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"key-value-engine/structs/iterator"
+	"key-value-engine/structs/mergeOperator"
 	"key-value-engine/structs/record"
 	"math"
 	"os"
@@ -35,6 +37,36 @@ func (sst *SSTable) Compress() error {
 	}
 	return nil
 }
+
+/*
+CompactAll merges every table into a single table on the last level, regardless of the compaction thresholds.
+Deleted, expired and overwritten versions are dropped and merge records are folded, since nothing older is left.
+*/
+func (sst *SSTable) CompactAll() error {
+	tables := sst.getIteratorDirs()
+	if len(tables) == 0 {
+		return nil
+	}
+	if len(tables) == 1 {
+		level, _, _ := parseDirName(filepath.Base(tables[0]))
+		if level == sst.maxLSMLevels {
+			return nil
+		}
+	}
+
+	err := sst.extractDataSizeTier(tables, sst.maxLSMLevels)
+	if err != nil {
+		return err
+	}
+	for _, dirname := range tables {
+		err = sst.removeTable(dirname)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (sst *SSTable) compressSizeTier() error {
 	dirnamesByTier, _ := sst.getDirsByTier()
 	re := regexp.MustCompile(`C(\d+)_`)
@@ -51,7 +83,10 @@ func (sst *SSTable) compressSizeTier() error {
 				return err
 			}
 			for _, dirname := range compressionTables {
-				err = os.RemoveAll(dirname)
+				err = sst.removeTable(dirname)
+				if err != nil {
+					return err
+				}
 			}
 			return sst.compressSizeTier()
 		}
@@ -60,10 +95,26 @@ func (sst *SSTable) compressSizeTier() error {
 	return nil
 }
 
+/*
+extractDataSizeTier merges the tables into a new table on the given level, keeping the newest version of every key.
+Expired records are dropped when no table outside the merge can hold an older version of their key,
+otherwise they are written as tombstones without their value, so the older versions stay hidden.
+Records covered by a newer range tombstone of the merged tables are dropped, the range tombstones are kept
+in the new table until they reach the bottom, where nothing older is left for them to delete.
+Merge records are folded into the older versions of their key, if none of them is a put or a tombstone
+and the table is not bottommost they are combined into a single merge record.
+*/
 func (sst *SSTable) extractDataSizeTier(tablesPaths []string, level int) error {
+	bottommost, err := sst.isBottommost(tablesPaths, level)
+	if err != nil {
+		return err
+	}
+
+	rangeTombstones := sst.GetRangeTombstones(tablesPaths)
+
 	var dataFiles []*TableFile
-	dirPath := SUBDIR + fmt.Sprintf("C%d_SST_%d", level, sst.nextIndex)
-	err := os.Mkdir(dirPath, os.ModePerm)
+	dirPath := sst.directory + string(os.PathSeparator) + fmt.Sprintf("C%d_SST_%d", level, sst.nextIndex)
+	err = os.Mkdir(dirPath, os.ModePerm)
 	if err != nil {
 		return errors.New("error making SST direcory")
 	}
@@ -116,61 +167,52 @@ func (sst *SSTable) extractDataSizeTier(tablesPaths []string, level int) error {
 		return err
 	}
 
-	var i = 0
-	var comparableRecords map[*TableFile]*record.Record
-	comparableRecords = make(map[*TableFile]*record.Record)
-	for _, f := range dataFiles {
-		comparableRecords[f] = nil
+	// every table holds at most one version of a key, all of them are read to fold merge records
+	sources := make([]iterator.Forward, len(dataFiles))
+	for i, file := range dataFiles {
+		sources[i] = sst.makeDataIterator(file)
 	}
-	for {
-		if i == 0 {
-			for _, file := range dataFiles {
-				comparableRecords[file], _ = sst.readRecordFromFile(file)
-			}
+	merge := iterator.MakeMergingIterator(sources, false)
 
-		}
+	written := 0
+	for merge.Valid() {
+		key := merge.Get().GetKey()
+		versions := merge.NextVersions()
 
-		if len(comparableRecords) == 0 {
-			break
+		minimalRecord := mergeOperator.Fold(sst.mergeOperator, key, versions, record.CoveringSeq(rangeTombstones, key), bottommost)
+		if minimalRecord.CoveredBy(rangeTombstones) {
+			continue
 		}
-
-		var minimalRecord *record.Record
-		var minimalFile *TableFile
-
-		for file, rec := range comparableRecords {
-			if minimalRecord == nil {
-				minimalRecord = rec
-				minimalFile = file
-			} else if rec.GetKey() < minimalRecord.GetKey() {
-				minimalRecord = rec
-				minimalFile = file
-			} else if rec.GetKey() == minimalRecord.GetKey() {
-				if rec.GetTimestamp() > minimalRecord.GetTimestamp() {
-					comparableRecords[minimalFile], _ = sst.readRecordFromFile(minimalFile)
-					if comparableRecords[minimalFile] == nil {
-						delete(comparableRecords, minimalFile)
-					}
-
-					minimalRecord = rec
-					minimalFile = file
-				} else {
-					comparableRecords[file], _ = sst.readRecordFromFile(file)
-					if comparableRecords[file] == nil {
-						delete(comparableRecords, file)
-					}
-				}
+		if minimalRecord.IsExpired() {
+			if bottommost {
+				continue
 			}
+			minimalRecord = record.MakeRecord(minimalRecord.GetKey(), nil, true, minimalRecord.GetSeq())
+		}
+		err = sst.putData(minimalRecord, dirPath)
+		if err != nil {
+			return err
 		}
+		written++
+	}
+
+	if bottommost {
+		rangeTombstones = nil
+	}
 
-		i += 1
-		comparableRecords[minimalFile], _ = sst.readRecordFromFile(minimalFile)
-		if comparableRecords[minimalFile] == nil {
-			delete(comparableRecords, minimalFile)
+	if written == 0 {
+		if len(rangeTombstones) == 0 {
+			// every record was deleted or expired, there is nothing to keep
+			return os.RemoveAll(dirPath)
 		}
-		err = sst.putData(minimalRecord, dirPath)
+
+		// a table needs at least one record, a tombstone on the start of a range deletes nothing the range does not
+		first := rangeTombstones[0]
+		err = sst.putData(record.MakeRecord(first.GetKey(), nil, true, first.GetSeq()), dirPath)
 		if err != nil {
 			return err
 		}
+		written++
 	}
 
 	err = sst.formIndex(dirPath)
@@ -181,12 +223,39 @@ func (sst *SSTable) extractDataSizeTier(tablesPaths []string, level int) error {
 	if err != nil {
 		return err
 	}
-	err = sst.formBfMt(dirPath, i)
+	err = sst.formBfMt(dirPath, written)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return sst.writeRangeTombstones(dirPath, rangeTombstones)
+}
+
+/*
+isBottommost reports whether the merged tables hold the oldest versions of their keys,
+that is no other table is on the target level or below it.
+*/
+func (sst *SSTable) isBottommost(tablesPaths []string, level int) (bool, error) {
+	dirnamesByTier, err := sst.getDirsByTier()
+	if err != nil {
+		return false, err
+	}
+
+	merged := make(map[string]bool)
+	for _, path := range tablesPaths {
+		merged[path] = true
+	}
+
+	for _, tier := range dirnamesByTier {
+		for _, path := range tier {
+			lvl, _, _ := parseDirName(filepath.Base(path))
+			if lvl >= level && !merged[path] {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
 }
 
 func (sst *SSTable) readRecordFromFile(table *TableFile) (*record.Record, error) {
@@ -203,7 +272,7 @@ func (sst *SSTable) readRecordFromFile(table *TableFile) (*record.Record, error)
 		var bufSize [binary.MaxVarintLen64]byte
 
 		// Read the SSTEntry size from the file into the buffer
-		_, err = table.file.Read(bufSize[:])
+		readSize, err := table.file.Read(bufSize[:])
 		if err != nil {
 			return nil, errors.New("error reading file")
 		}
@@ -211,7 +280,7 @@ func (sst *SSTable) readRecordFromFile(table *TableFile) (*record.Record, error)
 		// Decode the SSTEntry size from the buffer
 		entrySize, bytesRead := binary.Uvarint(bufSize[:])
 
-		_, err = table.file.Seek(-int64(binary.MaxVarintLen64-bytesRead), 1)
+		_, err = table.file.Seek(-int64(readSize-bytesRead), 1)
 		if err != nil {
 			return nil, errors.New("error reading file")
 		}
@@ -246,10 +315,9 @@ func (sst *SSTable) readRecordFromFile(table *TableFile) (*record.Record, error)
 			return nil, errors.New("error reading file")
 		}
 
-		keySize := binary.LittleEndian.Uint64(headerBytes[record.KEY_SIZE_START:record.VALUE_SIZE_START])
-		valSize := binary.LittleEndian.Uint64(headerBytes[record.VALUE_SIZE_START:record.KEY_START])
+		bodySize := record.Size(headerBytes) - record.RECORD_HEADER_SIZE
 
-		secondPartBytes := make([]byte, keySize+valSize)
+		secondPartBytes := make([]byte, bodySize)
 		_, err = table.file.Read(secondPartBytes)
 		if err != nil {
 			return nil, errors.New("error reading file")
@@ -264,6 +332,33 @@ func (sst *SSTable) readRecordFromFile(table *TableFile) (*record.Record, error)
 	return ret, nil
 }
 
+/*
+dataIterator reads the records of a table in order, it is the source of the table in a merge of tables.
+*/
+type dataIterator struct {
+	sst     *SSTable
+	table   *TableFile
+	current *record.Record
+}
+
+func (sst *SSTable) makeDataIterator(table *TableFile) *dataIterator {
+	it := &dataIterator{sst: sst, table: table}
+	it.Next()
+	return it
+}
+
+func (it *dataIterator) Valid() bool {
+	return it.current != nil
+}
+
+func (it *dataIterator) Next() {
+	it.current, _ = it.sst.readRecordFromFile(it.table)
+}
+
+func (it *dataIterator) Get() *record.Record {
+	return it.current
+}
+
 func makeTableFile(file *os.File, isMultifile bool, currentOffset int, lastOffset int, dirPath string) *TableFile {
 	return &TableFile{
 		file:          file,
@@ -299,7 +394,10 @@ func (sst *SSTable) compressLeveled() error {
 			sizeOfTier -= freedMemory
 			if len(dirnamesByTier) == lvl { //this is the current final level
 				err := sst.extractDataSizeTier([]string{tier[0]}, lvl+1)
-				err = os.RemoveAll(tier[0])
+				if err != nil {
+					return err
+				}
+				err = sst.removeTable(tier[0])
 				if err != nil {
 					return err
 				}
@@ -328,7 +426,10 @@ func (sst *SSTable) compressLeveled() error {
 				return err
 			}
 			for _, dirname := range compressionTables {
-				err = os.RemoveAll(dirname)
+				err = sst.removeTable(dirname)
+				if err != nil {
+					return err
+				}
 			}
 			return sst.compressLeveled()
 		}
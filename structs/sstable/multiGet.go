@@ -0,0 +1,470 @@
+package sstable
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"key-value-engine/structs/bloomFilter"
+	"key-value-engine/structs/merkleTree"
+	"key-value-engine/structs/record"
+	"os"
+	"sort"
+)
+
+// indexEntry is a key and its offset, the form of both the summary and the index entries
+type indexEntry struct {
+	key    string
+	offset uint64
+}
+
+// tableSummary is the lowest and the highest key of a table and every summary step of its index
+type tableSummary struct {
+	lowKey  string
+	highKey string
+	entries []indexEntry
+}
+
+/*
+tableReader keeps a table open while several keys are looked up in it,
+so its files, bloom filter, summary and merkle tree are read once instead of once per key.
+*/
+type tableReader struct {
+	dirPath  string
+	files    []*os.File
+	index    *os.File
+	indexEnd int64
+	data     *os.File
+	filter   *bloomFilter.BloomFilter
+	summary  *tableSummary
+	dict     map[string]int         // read with the first compressed record
+	merkle   *merkleTree.MerkleTree // read with the first found record
+
+	blockOffset uint64 // the last index block read, sorted keys often fall into the same one
+	block       []indexEntry
+}
+
+/*
+MultiGet returns the newest version of every key in the SSTables, like Get, in the order of the keys.
+*/
+func (sst *SSTable) MultiGet(keys []string) ([]*record.Record, error) {
+	_, err := sst.getDirsByTier()
+	if err != nil {
+		return nil, err
+	}
+
+	return sst.MultiGetFrom(keys, sst.getIteratorDirs())
+}
+
+/*
+MultiGetFrom returns the first version of every key found in the tables, searched in the given order, like GetFrom.
+Every table is opened once for all keys not found in the tables before it,
+the keys are looked up in sorted order, so keys sharing an index block read it once.
+
+Returns:
+  - []*record.Record: Version of each key in the order of the keys, nil for a key that is not in the tables.
+  - error: Error, if any, during reading the tables.
+*/
+func (sst *SSTable) MultiGetFrom(keys []string, dirs []string) ([]*record.Record, error) {
+	found := make([]*record.Record, len(keys))
+
+	pending := make([]int, len(keys))
+	for i := range pending {
+		pending[i] = i
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return keys[pending[i]] < keys[pending[j]]
+	})
+
+	for _, dirPath := range dirs {
+		if len(pending) == 0 {
+			break
+		}
+
+		table, err := sst.openTableReader(dirPath)
+		if err != nil {
+			return nil, err
+		}
+
+		remaining := pending[:0]
+		for _, i := range pending {
+			rec, err := table.get(sst, keys[i])
+			if err != nil {
+				table.close()
+				return nil, err
+			}
+			if rec == nil {
+				remaining = append(remaining, i)
+			} else {
+				found[i] = rec
+			}
+		}
+		table.close()
+		pending = remaining
+	}
+
+	tombstones := sst.GetRangeTombstones(dirs)
+	for i, rec := range found {
+		if rec == nil {
+			continue
+		}
+		rangeSeq := record.CoveringSeq(tombstones, keys[i])
+		if rangeSeq > rec.GetSeq() {
+			found[i] = record.MakeRecord(keys[i], nil, true, rangeSeq)
+		}
+	}
+
+	return found, nil
+}
+
+// openTableReader opens the table and reads its bloom filter and summary
+func (sst *SSTable) openTableReader(dirPath string) (*tableReader, error) {
+	files, err := readTOC(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &tableReader{dirPath: dirPath}
+	var filterBytes, summaryBytes []byte
+
+	if len(files) > 1 {
+		filterBytes, err = os.ReadFile(dirPath + BLOOMNAME)
+		if err != nil {
+			return nil, errors.New("error reading sst file")
+		}
+		summaryBytes, err = os.ReadFile(dirPath + SUMMARYNAME)
+		if err != nil {
+			return nil, errors.New("error reading sst file")
+		}
+
+		table.index, err = table.open(dirPath + INDEXNAME)
+		if err != nil {
+			return nil, err
+		}
+		table.indexEnd, err = table.index.Seek(0, 2)
+		if err != nil {
+			table.close()
+			return nil, errors.New("error reading sst file")
+		}
+		table.data, err = table.open(dirPath + DATANAME)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		file, err := table.open(dirPath + SINGLEFILENAME)
+		if err != nil {
+			return nil, err
+		}
+		table.index, table.data = file, file
+
+		headerBytes := make([]byte, HEADERSIZE)
+		_, err = file.ReadAt(headerBytes, 0)
+		if err != nil {
+			table.close()
+			return nil, errors.New("error reading sst file")
+		}
+		header := make([]int64, 5)
+		for i := range header {
+			header[i] = int64(binary.LittleEndian.Uint64(headerBytes[i*OFFSETSIZE : (i+1)*OFFSETSIZE]))
+		}
+		if header[1] > header[2] || header[2] > header[3] || header[3] > header[4] {
+			table.close()
+			return nil, errors.New("error reading sst file")
+		}
+
+		table.indexEnd = header[2]
+		summaryBytes = make([]byte, header[3]-header[2])
+		filterBytes = make([]byte, header[4]-header[3])
+		_, err = file.ReadAt(summaryBytes, header[2])
+		if err != nil {
+			table.close()
+			return nil, errors.New("error reading sst file")
+		}
+		_, err = file.ReadAt(filterBytes, header[3])
+		if err != nil {
+			table.close()
+			return nil, errors.New("error reading sst file")
+		}
+	}
+
+	table.filter, err = bloomFilter.BytesToBloomFilter(filterBytes)
+	if err != nil {
+		table.close()
+		return nil, err
+	}
+
+	table.summary, err = parseSummary(summaryBytes)
+	if err != nil {
+		table.close()
+		return nil, err
+	}
+
+	return table, nil
+}
+
+// open opens a file of the table, it is closed with the table
+func (table *tableReader) open(path string) (*os.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		table.close()
+		return nil, errors.New("error reading sst file")
+	}
+	table.files = append(table.files, file)
+	return file, nil
+}
+
+func (table *tableReader) close() {
+	for _, file := range table.files {
+		file.Close()
+	}
+	table.files = nil
+}
+
+// get returns the version of the key in the table, following the bloom filter, the summary, the index and the data like checkBf
+func (table *tableReader) get(sst *SSTable, key string) (*record.Record, error) {
+	if !table.filter.IsPresent([]byte(key)) {
+		return nil, nil
+	}
+	if key < table.summary.lowKey || key > table.summary.highKey {
+		return nil, nil
+	}
+
+	// the index block starts at the last summary key not greater than the key
+	blockOffset := table.summary.blockStart(func(summaryKey string) bool {
+		return summaryKey <= key
+	})
+
+	block, err := table.indexBlock(blockOffset, sst.summaryFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range block {
+		if entry.key > key {
+			return nil, nil
+		}
+		if entry.key == key {
+			return table.readRecord(sst, entry.offset)
+		}
+	}
+	return nil, nil
+}
+
+// indexBlock returns the index entries starting at the offset, at most one summary step of them
+func (table *tableReader) indexBlock(offset uint64, size int) ([]indexEntry, error) {
+	if table.block != nil && table.blockOffset == offset {
+		return table.block, nil
+	}
+	if int64(offset) > table.indexEnd {
+		return nil, errors.New("error reading sst file")
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(table.index, int64(offset), table.indexEnd-int64(offset)))
+	block := make([]indexEntry, 0, size)
+	for len(block) < size {
+		sizeBytes := make([]byte, record.KEY_SIZE_SIZE)
+		_, err := io.ReadFull(reader, sizeBytes)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New("error reading sst file")
+		}
+
+		entryBytes := make([]byte, binary.LittleEndian.Uint64(sizeBytes)+OFFSETSIZE)
+		_, err = io.ReadFull(reader, entryBytes)
+		if err != nil {
+			return nil, errors.New("error reading sst file")
+		}
+		keySize := len(entryBytes) - OFFSETSIZE
+		block = append(block, indexEntry{
+			key:    string(entryBytes[:keySize]),
+			offset: binary.LittleEndian.Uint64(entryBytes[keySize:]),
+		})
+	}
+
+	table.blockOffset, table.block = offset, block
+	return block, nil
+}
+
+// readRecord reads the record at the offset of the data and checks it against the merkle tree, like checkData
+func (table *tableReader) readRecord(sst *SSTable, offset uint64) (*record.Record, error) {
+	var recBytes []byte
+	var ret *record.Record
+
+	if sst.compression {
+		var bufSize [binary.MaxVarintLen64]byte
+		readSize, err := table.data.ReadAt(bufSize[:], int64(offset))
+		if readSize == 0 && err != nil {
+			return nil, errors.New("error reading sst file")
+		}
+		entrySize, bytesRead := binary.Uvarint(bufSize[:readSize])
+		if bytesRead <= 0 {
+			return nil, errors.New("error reading sst file")
+		}
+
+		recBytes = make([]byte, entrySize)
+		_, err = table.data.ReadAt(recBytes, int64(offset)+int64(bytesRead))
+		if err != nil {
+			return nil, errors.New("error reading sst file")
+		}
+
+		if table.dict == nil {
+			dictData, err := os.ReadFile(table.dirPath + string(os.PathSeparator) + GLOBALDICTNAME)
+			if err != nil {
+				return nil, errors.New("error reading sst file")
+			}
+			table.dict = make(map[string]int)
+			err = json.Unmarshal(dictData, &table.dict)
+			if err != nil {
+				return nil, errors.New("error converting json file")
+			}
+		}
+
+		ret, err = record.SSTBytesToRecord(recBytes, &table.dict)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		headerBytes := make([]byte, record.RECORD_HEADER_SIZE)
+		_, err := table.data.ReadAt(headerBytes, int64(offset))
+		if err != nil {
+			return nil, errors.New("error reading sst file")
+		}
+		bodySize := record.Size(headerBytes) - record.RECORD_HEADER_SIZE
+
+		recBytes = make([]byte, record.RECORD_HEADER_SIZE+bodySize)
+		copy(recBytes, headerBytes)
+		_, err = table.data.ReadAt(recBytes[record.RECORD_HEADER_SIZE:], int64(offset)+record.RECORD_HEADER_SIZE)
+		if err != nil {
+			return nil, errors.New("error reading sst file")
+		}
+
+		ret = record.BytesToRecord(recBytes)
+	}
+
+	if table.merkle == nil {
+		mtBytes, err := readMerkle(table.dirPath)
+		if err != nil {
+			return nil, err
+		}
+		table.merkle, err = merkleTree.BytesToMerkleTree(mtBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	valid, _ := table.merkle.CheckValidityOfNode(recBytes)
+	if !valid {
+		return nil, errors.New("error value not valid")
+	}
+
+	return ret, nil
+}
+
+/*
+readSummary reads the summary of the table.
+*/
+func readSummary(dirPath string) (*tableSummary, error) {
+	files, err := readTOC(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) > 1 {
+		summaryBytes, err := os.ReadFile(dirPath + SUMMARYNAME)
+		if err != nil {
+			return nil, errors.New("error reading sst file")
+		}
+		return parseSummary(summaryBytes)
+	}
+
+	file, err := os.Open(dirPath + SINGLEFILENAME)
+	if err != nil {
+		return nil, errors.New("error reading sst file")
+	}
+	defer file.Close()
+
+	headerBytes := make([]byte, HEADERSIZE)
+	_, err = file.ReadAt(headerBytes, 0)
+	if err != nil {
+		return nil, errors.New("error reading sst file")
+	}
+	start := int64(binary.LittleEndian.Uint64(headerBytes[2*OFFSETSIZE : 3*OFFSETSIZE]))
+	end := int64(binary.LittleEndian.Uint64(headerBytes[3*OFFSETSIZE : 4*OFFSETSIZE]))
+	if start > end {
+		return nil, errors.New("error reading sst file")
+	}
+
+	summaryBytes := make([]byte, end-start)
+	_, err = file.ReadAt(summaryBytes, start)
+	if err != nil {
+		return nil, errors.New("error reading sst file")
+	}
+	return parseSummary(summaryBytes)
+}
+
+// parseSummary reads the lowest and the highest key of the table followed by the summary entries
+func parseSummary(data []byte) (*tableSummary, error) {
+	bounds, rest, err := readKeys(data, 2)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readIndexEntries(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tableSummary{lowKey: bounds[0], highKey: bounds[1], entries: entries}, nil
+}
+
+/*
+blockStart returns the offset of the index block a search continues in,
+the offset of the last summary entry whose key is accepted, 0 (the start of the index) if none is.
+The accepted keys must come before the rejected ones.
+*/
+func (summary *tableSummary) blockStart(accept func(key string) bool) uint64 {
+	i := sort.Search(len(summary.entries), func(i int) bool {
+		return !accept(summary.entries[i].key)
+	})
+	if i == 0 {
+		return 0
+	}
+	return summary.entries[i-1].offset
+}
+
+// readKeys reads count size-prefixed keys from the start of the data and returns them with the bytes after them
+func readKeys(data []byte, count int) ([]string, []byte, error) {
+	keys := make([]string, count)
+	for i := range keys {
+		if len(data) < record.KEY_SIZE_SIZE {
+			return nil, nil, errors.New("error reading sst file")
+		}
+		keySize := binary.LittleEndian.Uint64(data[:record.KEY_SIZE_SIZE])
+		data = data[record.KEY_SIZE_SIZE:]
+		if keySize > uint64(len(data)) {
+			return nil, nil, errors.New("error reading sst file")
+		}
+		keys[i], data = string(data[:keySize]), data[keySize:]
+	}
+
+	return keys, data, nil
+}
+
+// readIndexEntries reads the key and offset pairs filling the data
+func readIndexEntries(data []byte) ([]indexEntry, error) {
+	var entries []indexEntry
+	for len(data) > 0 {
+		keys, rest, err := readKeys(data, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) < OFFSETSIZE {
+			return nil, errors.New("error reading sst file")
+		}
+		entries = append(entries, indexEntry{key: keys[0], offset: binary.LittleEndian.Uint64(rest[:OFFSETSIZE])})
+		data = rest[OFFSETSIZE:]
+	}
+
+	return entries, nil
+}
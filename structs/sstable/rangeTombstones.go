@@ -0,0 +1,113 @@
+package sstable
+
+import (
+	"errors"
+	"key-value-engine/structs/record"
+	"os"
+	"path/filepath"
+)
+
+/*
+Range tombstones of a table are kept in their own file, RANGEDELNAME, next to the data of the table.
+The file holds the serialized records one after another and exists only if the table has range tombstones.
+They are few, so the range tombstones of all tables are loaded when the SSTable is made and kept in memory.
+*/
+
+// readRangeTombstones reads the range tombstones of the table, nil if it has none
+func readRangeTombstones(dirPath string) ([]*record.Record, error) {
+	data, err := os.ReadFile(filepath.Join(dirPath, RANGEDELNAME))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("error reading range tombstones")
+	}
+
+	var rangeTombstones []*record.Record
+	for len(data) > 0 {
+		if len(data) < record.RECORD_HEADER_SIZE {
+			return nil, errors.New("error reading range tombstones")
+		}
+		size := record.Size(data[:record.RECORD_HEADER_SIZE])
+		if size > len(data) {
+			return nil, errors.New("error reading range tombstones")
+		}
+
+		rangeTombstones = append(rangeTombstones, record.BytesToRecord(data[:size]))
+		data = data[size:]
+	}
+
+	return rangeTombstones, nil
+}
+
+// writeRangeTombstones writes the range tombstones of a new table and keeps them in memory
+func (sst *SSTable) writeRangeTombstones(dirPath string, rangeTombstones []*record.Record) error {
+	if len(rangeTombstones) == 0 {
+		return nil
+	}
+
+	var data []byte
+	for _, rt := range rangeTombstones {
+		data = append(data, rt.RecordToBytes()...)
+		if rt.GetSeq() > sst.lastSeq {
+			sst.lastSeq = rt.GetSeq()
+		}
+	}
+
+	err := os.WriteFile(filepath.Join(dirPath, RANGEDELNAME), data, 0644)
+	if err != nil {
+		return errors.New("error writting range tombstones")
+	}
+
+	sst.rangeLock.Lock()
+	defer sst.rangeLock.Unlock()
+
+	sst.rangeTombstones[tablePath(dirPath)] = rangeTombstones
+	return nil
+}
+
+// loadRangeTombstones reads the range tombstones of all tables in the directory
+func loadRangeTombstones(directory string, subdirs []string) (map[string][]*record.Record, error) {
+	rangeTombstones := make(map[string][]*record.Record)
+	for _, subdir := range subdirs {
+		path := tablePath(filepath.Join(directory, subdir))
+
+		tableTombstones, err := readRangeTombstones(path)
+		if err != nil {
+			return nil, err
+		}
+		if tableTombstones != nil {
+			rangeTombstones[path] = tableTombstones
+		}
+	}
+
+	return rangeTombstones, nil
+}
+
+// forgetRangeTombstones drops the range tombstones of a removed table
+func (sst *SSTable) forgetRangeTombstones(dirPath string) {
+	sst.rangeLock.Lock()
+	defer sst.rangeLock.Unlock()
+
+	delete(sst.rangeTombstones, tablePath(dirPath))
+}
+
+/*
+GetRangeTombstones returns the range tombstones of the given tables.
+*/
+func (sst *SSTable) GetRangeTombstones(dirs []string) []*record.Record {
+	sst.rangeLock.RLock()
+	defer sst.rangeLock.RUnlock()
+
+	var rangeTombstones []*record.Record
+	for _, dir := range dirs {
+		rangeTombstones = append(rangeTombstones, sst.rangeTombstones[tablePath(dir)]...)
+	}
+
+	return rangeTombstones
+}
+
+// tablePath returns the path of the table in the form used by getDirsByTier, ending with a separator
+func tablePath(dirPath string) string {
+	return filepath.Clean(dirPath) + string(os.PathSeparator)
+}
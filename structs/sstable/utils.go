@@ -88,33 +88,38 @@ func (sst *SSTable) indexFormatToBytes(rec *record.Record, offset int) []byte {
 	return result
 }
 
+/*
+getDirsByTier returns the paths of the tables grouped by level, from the lowest level.
+Tables of a level are sorted by their index, from the oldest to the newest.
+Compacted tables kept only for snapshots are left out.
+*/
 func (sst *SSTable) getDirsByTier() ([][]string, error) {
-	subdirs, err := getSubdirs(DIRECTORY)
+	// listing under pinLock, so Unpin cannot remove an obsolete table between the listing and the check below
+	sst.pinLock.Lock()
+	defer sst.pinLock.Unlock()
+
+	subdirs, err := getSubdirs(sst.directory)
 	if err != nil {
 		return nil, errors.New("error opening sstable direcotry")
 	}
 
 	// Map to store directories grouped by their tier number
 	dirnamesByTierMap := make(map[int][]string)
+	indexes := make(map[string]int)
 
-	for i := 0; i < len(subdirs); i++ {
-		subdir := subdirs[i] // C1_SST1 for example
-		var strIndex []byte
-
-		for j := 1; j < len(subdir) && subdir[j] != '_'; j++ {
-			strIndex = append(strIndex, subdir[j])
+	for _, subdir := range subdirs {
+		tierNumber, index, ok := parseDirName(subdir) // C1_SST_1 for example
+		if !ok {
+			continue
 		}
 
-		resultString := string(strIndex)
-
-		// Convert the string to an integer
-		tierNumber, _ := strconv.Atoi(resultString)
-
-		// Check if the tier number is greater than zero
-		if tierNumber > 0 {
-			// Append the current subdir to the appropriate tier in the map
-			dirnamesByTierMap[tierNumber] = append(dirnamesByTierMap[tierNumber], DIRECTORY+string(os.PathSeparator)+subdir+string(os.PathSeparator))
+		// Append the current subdir to the appropriate tier in the map
+		path := sst.directory + string(os.PathSeparator) + subdir + string(os.PathSeparator)
+		if sst.obsolete[path] {
+			continue
 		}
+		dirnamesByTierMap[tierNumber] = append(dirnamesByTierMap[tierNumber], path)
+		indexes[path] = index
 	}
 
 	// Convert the map to a sorted slice of slices
@@ -126,7 +131,30 @@ func (sst *SSTable) getDirsByTier() ([][]string, error) {
 	sort.Ints(sortedTiers)
 
 	for _, tier := range sortedTiers {
-		dirnamesByTier = append(dirnamesByTier, dirnamesByTierMap[tier])
+		dirnames := dirnamesByTierMap[tier]
+		sort.Slice(dirnames, func(i, j int) bool {
+			return indexes[dirnames[i]] < indexes[dirnames[j]]
+		})
+		dirnamesByTier = append(dirnamesByTier, dirnames)
 	}
 	return dirnamesByTier, nil
 }
+
+// parseDirName returns the level and the index of a table directory named C<level>_SST_<index>
+func parseDirName(name string) (int, int, bool) {
+	parts := strings.Split(name, "_")
+	if len(parts) != 3 || len(parts[0]) < 2 || parts[0][0] != 'C' || parts[1] != "SST" {
+		return 0, 0, false
+	}
+
+	level, err := strconv.Atoi(parts[0][1:])
+	if err != nil || level <= 0 {
+		return 0, 0, false
+	}
+	index, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return level, index, true
+}
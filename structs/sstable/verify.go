@@ -0,0 +1,169 @@
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"key-value-engine/structs/merkleTree"
+	"key-value-engine/structs/record"
+	"os"
+)
+
+/*
+Verify rebuilds the merkle tree of every table from its data and compares it with the stored one.
+
+Returns:
+  - []string: Directories of the tables whose data does not match their merkle tree.
+  - error: Error, if any, during reading the tables.
+*/
+func (sst *SSTable) Verify() ([]string, error) {
+	tables := sst.Pin()
+	defer sst.Unpin(tables)
+
+	var corrupted []string
+	for _, dirPath := range tables {
+		valid, err := sst.verifyTable(dirPath)
+		if err != nil {
+			return nil, err
+		}
+		if !valid {
+			corrupted = append(corrupted, dirPath)
+		}
+	}
+
+	return corrupted, nil
+}
+
+// verifyTable reports whether the data of the table matches its merkle tree, unreadable data does not match
+func (sst *SSTable) verifyTable(dirPath string) (bool, error) {
+	table, err := openTableFile(dirPath)
+	if err != nil {
+		return false, err
+	}
+	defer table.file.Close()
+
+	mt := merkleTree.MakeMerkleTree()
+	for {
+		entry, ok := sst.readRawEntry(table)
+		if !ok {
+			return false, nil
+		}
+		if entry == nil {
+			break
+		}
+		mt.Add(entry)
+	}
+	mt.FormMerkleTree()
+
+	rebuilt, err := merkleTree.MerkleTreeToBytes(mt)
+	if err != nil {
+		return false, err
+	}
+	stored, err := readMerkle(dirPath)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(rebuilt, stored), nil
+}
+
+/*
+readRawEntry reads the bytes of the next record of the table, as they were added to its merkle tree, without decoding them.
+Sizes reaching past the end of the data mean the table is corrupted.
+
+Returns:
+  - []byte: Bytes of the record, nil at the end of the data.
+  - bool: Indicates whether the record could be read.
+*/
+func (sst *SSTable) readRawEntry(table *TableFile) ([]byte, bool) {
+	remaining := uint64(table.lastOffset - table.currentOffset)
+	if remaining == 0 {
+		return nil, true
+	}
+	_, err := table.file.Seek(int64(table.currentOffset), 0)
+	if err != nil {
+		return nil, false
+	}
+
+	if sst.compression {
+		var bufSize [binary.MaxVarintLen64]byte
+		readSize, _ := table.file.Read(bufSize[:])
+		entrySize, bytesRead := binary.Uvarint(bufSize[:readSize])
+		if bytesRead <= 0 || entrySize > remaining-uint64(bytesRead) {
+			return nil, false
+		}
+
+		entry := make([]byte, entrySize)
+		_, err = table.file.ReadAt(entry, int64(table.currentOffset+bytesRead))
+		if err != nil {
+			return nil, false
+		}
+		table.currentOffset += bytesRead + len(entry)
+		return entry, true
+	}
+
+	if remaining < record.RECORD_HEADER_SIZE {
+		return nil, false
+	}
+	header := make([]byte, record.RECORD_HEADER_SIZE)
+	_, err = io.ReadFull(table.file, header)
+	if err != nil {
+		return nil, false
+	}
+	keySize := binary.LittleEndian.Uint64(header[record.KEY_SIZE_START:record.VALUE_SIZE_START])
+	valSize := binary.LittleEndian.Uint64(header[record.VALUE_SIZE_START:record.KEY_START])
+	rest := remaining - record.RECORD_HEADER_SIZE
+	if keySize > rest || valSize > rest-keySize {
+		return nil, false
+	}
+
+	size := record.Size(header)
+	if uint64(size-record.RECORD_HEADER_SIZE) > rest {
+		return nil, false
+	}
+
+	entry := make([]byte, size)
+	copy(entry, header)
+	_, err = io.ReadFull(table.file, entry[record.RECORD_HEADER_SIZE:])
+	if err != nil {
+		return nil, false
+	}
+	table.currentOffset += len(entry)
+	return entry, true
+}
+
+// openTableFile opens the data of the table for reading its records in order
+func openTableFile(dirPath string) (*TableFile, error) {
+	files, err := readTOC(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) > 1 {
+		file, err := os.Open(dirPath + DATANAME)
+		if err != nil {
+			return nil, errors.New("error reading sst file")
+		}
+		end, err := file.Seek(0, 2)
+		if err != nil {
+			file.Close()
+			return nil, errors.New("error reading sst file")
+		}
+		return makeTableFile(file, true, 0, int(end), dirPath), nil
+	}
+
+	file, err := os.Open(dirPath + SINGLEFILENAME)
+	if err != nil {
+		return nil, errors.New("error reading sst file")
+	}
+	headerBytes := make([]byte, 2*OFFSETSIZE)
+	_, err = file.Read(headerBytes)
+	if err != nil {
+		file.Close()
+		return nil, errors.New("error reading header")
+	}
+	endOfData := binary.LittleEndian.Uint64(headerBytes[OFFSETSIZE : 2*OFFSETSIZE])
+
+	return makeTableFile(file, false, HEADERSIZE, int(endOfData), dirPath), nil
+}
@@ -3,6 +3,7 @@ package tokenBucket
 import (
 	"encoding/binary"
 	"errors"
+	"sync"
 	"time"
 )
 
@@ -10,14 +11,18 @@ const (
 	FIELDSIZE = 8
 )
 
+var ErrRateLimited = errors.New("reached maximum number of requests, please wait")
+
 /*
 TokenBucket represents a simple rate limiting token bucket.
+It is safe for concurrent use.
 */
 type TokenBucket struct {
-	capacity       int64     // maximum tokens in the bucket
-	refillCooldown int64     // user defined cooldown in seconds, until the next refill
-	tokens         int64     // current number of tokens in the bucket
-	lastRefill     time.Time // when was the number of tokens reset
+	capacity       int64      // maximum tokens in the bucket
+	refillCooldown int64      // user defined cooldown in seconds, until the next refill
+	tokens         int64      // current number of tokens in the bucket
+	lastRefill     time.Time  // when was the number of tokens reset
+	lock           sync.Mutex // guards tokens and lastRefill
 }
 
 /*
@@ -43,17 +48,20 @@ func (tb *TokenBucket) refill() {
 /*
 TakeToken attempts to consume the specified number of tokens from the bucket.
 It returns the serialized data representing the state after token consumption,
-or an error if the request cannot be fulfilled due to rate limiting.
+or ErrRateLimited if the request cannot be fulfilled due to rate limiting.
 */
 func (tb *TokenBucket) TakeToken(tokens int64) ([]byte, error) {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
 	if tb.lastRefill.Add(time.Duration(tb.refillCooldown) * time.Second).Before(time.Now()) {
 		tb.refill()
 	}
 	if tb.tokens <= 0 {
-		return nil, errors.New("reached maximum number of requests, please wait")
+		return nil, ErrRateLimited
 	}
 	tb.tokens -= tokens
-	serializedData := tb.TokenRequestToBytes()
+	serializedData := tb.tokenRequestToBytes()
 	return serializedData, nil
 }
 
@@ -61,6 +69,13 @@ func (tb *TokenBucket) TakeToken(tokens int64) ([]byte, error) {
 TokenRequestToBytes converts the current state of the TokenBucket to a serialized byte slice.
 */
 func (tb *TokenBucket) TokenRequestToBytes() []byte {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	return tb.tokenRequestToBytes()
+}
+
+func (tb *TokenBucket) tokenRequestToBytes() []byte {
 	data := make([]byte, 24)
 
 	binary.BigEndian.PutUint64(data[:2*FIELDSIZE], uint64(tb.lastRefill.UnixNano()))
@@ -73,6 +88,9 @@ func (tb *TokenBucket) TokenRequestToBytes() []byte {
 BytesToTokenRequest updates the TokenBucket state by deserializing the provided byte slice.
 */
 func (tb *TokenBucket) BytesToTokenRequest(data []byte) {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
 	tb.lastRefill = time.Unix(0, int64(binary.BigEndian.Uint64(data[:2*FIELDSIZE])))
 	tb.tokens = int64(binary.BigEndian.Uint64(data[2*FIELDSIZE : 3*FIELDSIZE]))
 }
@@ -0,0 +1,35 @@
+package tokenBucket
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestConcurrentTakeToken takes and serializes tokens from several goroutines, no more requests pass than the bucket holds
+func TestConcurrentTakeToken(t *testing.T) {
+	const capacity = 50
+	tb := MakeTokenBucket(capacity, 3600)
+
+	var passed atomic.Int64
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if _, err := tb.TakeToken(1); err == nil {
+					passed.Add(1)
+				} else if err != ErrRateLimited {
+					t.Error(err)
+				}
+				tb.TokenRequestToBytes()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if passed.Load() != capacity {
+		t.Errorf("%d requests passed, want %d", passed.Load(), capacity)
+	}
+}
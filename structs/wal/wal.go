@@ -8,23 +8,34 @@ import (
 	"key-value-engine/structs/record"
 	"log"
 	"os"
+	"path/filepath"
 )
 
 const (
-	DIRECTORY = "data" + string(os.PathSeparator) + "wal"
-	FILEPATH  = DIRECTORY + string(os.PathSeparator) + "wal"
-	EXT       = ".log"
+	DIRNAME       = "wal"
+	FILENAME      = "wal"
+	EXT           = ".log"
+	OVERFLOW_SIZE = 8 // header of a segment holding the size of the record part continued from the previous segment
+)
+
+var (
+	ErrRecordTooLarge = errors.New("record is larger than a wal segment")
+	ErrChecksum       = errors.New("crc does not match the hashed value")
 )
 
 /*
 Structure:
+- Directory: Directory holding the WAL segment files.
 - SegmentSize: Size of each WAL segment file.
 - SegmentFiles: List of filenames representing WAL segment files.
 - RepairFileIndex: Index of the current WAL segment file being repaired.
 - RepairOffset: Offset within the current WAL segment file during repair operations.
+
+WAL is not safe for concurrent use, the DB serializes all writes through its write lock.
 */
 
 type WAL struct {
+	Directory       string
 	SegmentSize     int64
 	SegmentFiles    []string
 	RepairFileIndex int64
@@ -35,26 +46,37 @@ type WAL struct {
 MakeWAL initializes and returns a new WAL instance.
 
 Parameters:
+- dataDir: Root data directory, segment files are kept in its wal subdirectory.
 - segmentSize: Size of each WAL segment file.
 
 Returns:
 - *WAL: Pointer to the created WAL instance.
 - error: Error, if any, during the initialization process.
 */
-func MakeWAL(segmentSize int64) (*WAL, error) {
-	if err := os.MkdirAll(DIRECTORY, 0755); err != nil {
+func MakeWAL(dataDir string, segmentSize int64) (*WAL, error) {
+	directory := filepath.Join(dataDir, DIRNAME)
+	if err := os.MkdirAll(directory, 0755); err != nil {
 		return nil, errors.New("error creating wal data directory")
 	}
 
-	initialSegmentFile := FILEPATH + "_1" + EXT
+	wal := &WAL{
+		Directory:       directory,
+		SegmentSize:     segmentSize,
+		RepairFileIndex: 0,
+		RepairOffset:    8,
+	}
+
+	initialSegmentFile := wal.SegmentName(1)
 
 	var filenames []string
 
 	if _, err := os.Stat(initialSegmentFile); err == nil {
-		dir, _ := os.Open(DIRECTORY)
-		files, _ := dir.Readdir(0)
-		for _, file := range files {
-			filenames = append(filenames, DIRECTORY+string(os.PathSeparator)+file.Name())
+		// segments are numbered from 1 without gaps
+		for i := 1; ; i++ {
+			if _, err := os.Stat(wal.SegmentName(i)); err != nil {
+				break
+			}
+			filenames = append(filenames, wal.SegmentName(i))
 		}
 	} else {
 		filenames = append(filenames, initialSegmentFile)
@@ -63,16 +85,21 @@ func MakeWAL(segmentSize int64) (*WAL, error) {
 		}
 	}
 
-	wal := &WAL{
-		SegmentSize:     segmentSize,
-		SegmentFiles:    filenames,
-		RepairFileIndex: 0,
-		RepairOffset:    8,
-	}
+	wal.SegmentFiles = filenames
 
 	return wal, nil
 }
 
+/*
+SegmentName returns the path of the segment file with the given index.
+
+Parameters:
+- index: Index of the segment, starting from 1.
+*/
+func (wal *WAL) SegmentName(index int) string {
+	return filepath.Join(wal.Directory, fmt.Sprintf("%s_%d%s", FILENAME, index, EXT))
+}
+
 /*
 createInitialSegmentFile creates the initial WAL segment file with an overflow record part.
 
@@ -103,17 +130,19 @@ func createInitialSegmentFile(filename string) error {
 
 /*
 AddRecord appends a new record to the WAL, handling record overflow by creating new segments.
+A record may be split between two segments, so it can not be larger than a segment without its header.
 
 Parameters:
-- key: Key for the new record.
-- value: Value associated with the key.
-- deleted: Flag indicating if the record is marked as deleted.
+- rec: Record to append, a single put or delete or a whole batch.
 
 Returns:
 - error: Error, if any, during the record addition process.
 */
 func (wal *WAL) AddRecord(rec *record.Record) error {
 	recordBytes := rec.RecordToBytes()
+	if int64(len(recordBytes)) > wal.SegmentSize-OVERFLOW_SIZE {
+		return ErrRecordTooLarge
+	}
 
 	filePath := wal.SegmentFiles[len(wal.SegmentFiles)-1]
 
@@ -145,6 +174,9 @@ func (wal *WAL) AddRecord(rec *record.Record) error {
 	if fileSize+int64(len(recordBytes)) > wal.SegmentSize {
 
 		bytesToFit := wal.SegmentSize - fileSize
+		if bytesToFit < 0 {
+			bytesToFit = 0
+		}
 		firstRecordPart := recordBytes[:bytesToFit]
 		secondRecordPart := recordBytes[bytesToFit:]
 
@@ -240,7 +272,7 @@ Returns:
 - error: Error, if any, during segment creation.
 */
 func (wal *WAL) makeSegment() error {
-	newSegmentFile := FILEPATH + fmt.Sprintf("_%d.log", len(wal.SegmentFiles)+1)
+	newSegmentFile := wal.SegmentName(len(wal.SegmentFiles) + 1)
 	wal.SegmentFiles = append(wal.SegmentFiles, newSegmentFile)
 
 	// Create the new segment file
@@ -266,175 +298,184 @@ func (wal *WAL) makeSegment() error {
 
 /*
 RestoreRecord retrieves and restores a record from the WAL based on the provided offset.
+A record split between two segments is joined with its part from the next segment.
+A partially written record at the end of the log is cut off, so new records are appended after the last complete one.
 
 Parameters:
-- offset: Offset within the WAL to start the restoration process.
+- offset: Offset within the WAL to start the restoration process, -1 to continue from the previous record.
 
 Returns:
-- *record.Record: Restored record.
-- error: Error, if any, during the restoration process.
+  - *record.Record: Restored record, nil at the end of the log.
+  - int64: Offset after the record, within the segment the record ends in.
+  - error: ErrChecksum together with the record and its end offset if the record is damaged,
+    so the caller can decide to skip it, or any other error during the restoration process.
 */
 func (wal *WAL) RestoreRecord(offset int64) (*record.Record, int64, error) {
 	if offset != -1 {
 		wal.RepairOffset = offset
 	}
 
-	f, err := os.OpenFile(wal.SegmentFiles[wal.RepairFileIndex], os.O_RDWR, 0644)
+	data, closeSegment, err := mapSegment(wal.SegmentFiles[wal.RepairFileIndex])
 	if err != nil {
-		return nil, 0, errors.New("error opening new segment file for writing")
+		return nil, 0, err
 	}
-	defer func(f *os.File) {
-		err := f.Close()
-		if err != nil {
-
-		}
-	}(f)
+	defer closeSegment()
 
-	mmappedData, err := mmap.Map(f, mmap.RDWR, 0)
-	if err != nil {
-		return nil, 0, errors.New("error mmaping new file")
+	lastSegment := wal.RepairFileIndex == int64(len(wal.SegmentFiles)-1)
+	available := int64(len(data)) - wal.RepairOffset
+	if available < 0 {
+		return nil, 0, errors.New("offset is outside of the wal segment")
 	}
-	defer func(mmappedData *mmap.MMap) {
-		err := mmappedData.Unmap()
-		if err != nil {
 
+	recSize := int64(-1)
+	if available >= record.RECORD_HEADER_SIZE {
+		recSize = int64(record.Size(data[wal.RepairOffset : wal.RepairOffset+record.RECORD_HEADER_SIZE]))
+		if recSize < record.RECORD_HEADER_SIZE {
+			return nil, 0, errors.New("corrupted wal record header")
 		}
-	}(&mmappedData)
-	currentSeek, _ := f.Seek(0, 1)
-	eofSeek := len(mmappedData)
-	_, _ = f.Seek(currentSeek, 0)
-	if int(offset) >= eofSeek {
-		return nil, 0, nil
 	}
 
-	leftoverSpace := wal.SegmentSize - offset
+	var recBytes []byte
 
-	if leftoverSpace < record.RECORD_HEADER_SIZE {
-		recordFirstPartBytes := make([]byte, leftoverSpace)
-		copy(recordFirstPartBytes, mmappedData[wal.RepairOffset:])
+	if recSize != -1 && recSize <= available {
+		recBytes = make([]byte, recSize)
+		copy(recBytes, data[wal.RepairOffset:wal.RepairOffset+recSize])
 
-		if wal.RepairFileIndex == int64(len(wal.SegmentFiles)-1) {
-			return nil, 0, errors.New("not enough segment files")
+		wal.RepairOffset += recSize
+	} else {
+		// the record continues in the next segment, in the last segment it was not completely written
+		if lastSegment {
+			if available > 0 {
+				return nil, 0, wal.cutTail(wal.RepairFileIndex, wal.RepairOffset)
+			}
+			return nil, 0, nil
 		}
 
-		wal.RepairFileIndex++
-		wal.RepairOffset = 0
+		recordFirstPartBytes := make([]byte, available)
+		copy(recordFirstPartBytes, data[wal.RepairOffset:])
 
-		secondFile, err := os.OpenFile(wal.SegmentFiles[wal.RepairFileIndex], os.O_RDWR, 0644)
+		nextData, closeNextSegment, err := mapSegment(wal.SegmentFiles[wal.RepairFileIndex+1])
 		if err != nil {
-			return nil, 0, errors.New("error opening new segment file for writing")
+			return nil, 0, err
 		}
-		defer func(secondFile *os.File) {
-			err := secondFile.Close()
-			if err != nil {
-
+		defer closeNextSegment()
+
+		nextLastSegment := wal.RepairFileIndex+1 == int64(len(wal.SegmentFiles)-1)
+
+		var recSecondPartBytes []byte
+		complete := false
+		if len(nextData) >= OVERFLOW_SIZE {
+			leftoverRecSize := int64(binary.LittleEndian.Uint64(nextData[:OVERFLOW_SIZE]))
+			if leftoverRecSize >= 0 && leftoverRecSize <= int64(len(nextData))-OVERFLOW_SIZE {
+				recSecondPartBytes = nextData[OVERFLOW_SIZE : OVERFLOW_SIZE+leftoverRecSize]
+				recBytes = append(recordFirstPartBytes, recSecondPartBytes...)
+				complete = len(recBytes) >= record.RECORD_HEADER_SIZE &&
+					record.Size(recBytes[:record.RECORD_HEADER_SIZE]) == len(recBytes)
 			}
-		}(secondFile)
-
-		mmapedDataSecondFile, err := mmap.Map(secondFile, mmap.RDWR, 0)
-		if err != nil {
-			return nil, 0, errors.New("error mmaping new file")
 		}
-		defer func(mmapedDataSecondFile *mmap.MMap) {
-			err := mmapedDataSecondFile.Unmap()
-			if err != nil {
 
+		if !complete {
+			if nextLastSegment {
+				return nil, 0, wal.cutTail(wal.RepairFileIndex, wal.RepairOffset)
 			}
-		}(&mmapedDataSecondFile)
-
-		leftoverRecSizeBytes := make([]byte, 8)
-		copy(leftoverRecSizeBytes, mmapedDataSecondFile[:8])
-		leftoverRecSize := binary.LittleEndian.Uint64(leftoverRecSizeBytes)
-
-		wal.RepairOffset += 8
-
-		recSecondPartBytes := make([]byte, leftoverRecSize)
-		copy(recSecondPartBytes, mmapedDataSecondFile[8:8+leftoverRecSize])
-
-		wal.RepairOffset += int64(leftoverRecSize)
-
-		recBytes := append(recordFirstPartBytes, recSecondPartBytes...)
-		rec := record.BytesToRecord(recBytes)
-
-		if record.CrcHash(rec.GetValue()) != rec.GetCrc() {
-			return nil, 0, errors.New("crc does not match the hashed value")
+			return nil, 0, errors.New("corrupted wal record between segments")
 		}
 
-		return rec, wal.RepairOffset, nil
-
+		wal.RepairFileIndex++
+		wal.RepairOffset = OVERFLOW_SIZE + int64(len(recSecondPartBytes))
 	}
 
-	recHeader := make([]byte, record.RECORD_HEADER_SIZE)
-	copy(recHeader, mmappedData[wal.RepairOffset:wal.RepairOffset+record.RECORD_HEADER_SIZE])
-
-	recSize := record.Size(recHeader)
-
-	if int64(recSize) > leftoverSpace {
-		recordFirstPartBytes := make([]byte, leftoverSpace)
-		copy(recordFirstPartBytes, mmappedData[wal.RepairOffset:])
+	rec := record.BytesToRecord(recBytes)
 
-		if wal.RepairFileIndex == int64(len(wal.SegmentFiles)-1) {
-			return nil, 0, errors.New("not enough segment files")
-		}
+	if record.CrcHash(rec.GetValue()) != rec.GetCrc() {
+		return rec, wal.RepairOffset, ErrChecksum
+	}
 
-		wal.RepairFileIndex++
-		wal.RepairOffset = 0
+	return rec, wal.RepairOffset, nil
+}
 
-		secondFile, err := os.OpenFile(wal.SegmentFiles[wal.RepairFileIndex], os.O_RDWR, 0644)
-		if err != nil {
-			return nil, 0, errors.New("error opening new segment file for writing")
-		}
-		defer func(secondFile *os.File) {
-			err := secondFile.Close()
-			if err != nil {
+/*
+FirstRecordOffset returns the offset of the first record starting in the segment,
+after the part of a record continued from the previous segment.
 
-			}
-		}(secondFile)
+Parameters:
+- index: Index of the segment within SegmentFiles.
+*/
+func (wal *WAL) FirstRecordOffset(index int) (int64, error) {
+	data, closeSegment, err := mapSegment(wal.SegmentFiles[index])
+	if err != nil {
+		return 0, err
+	}
+	defer closeSegment()
 
-		mmapedDataSecondFile, err := mmap.Map(secondFile, mmap.RDWR, 0)
-		if err != nil {
-			return nil, 0, errors.New("error mmaping new file")
-		}
-		defer func(mmapedDataSecondFile *mmap.MMap) {
-			err := mmapedDataSecondFile.Unmap()
-			if err != nil {
+	if len(data) < OVERFLOW_SIZE {
+		return OVERFLOW_SIZE, nil
+	}
+	offset := OVERFLOW_SIZE + int64(binary.LittleEndian.Uint64(data[:OVERFLOW_SIZE]))
+	if offset < OVERFLOW_SIZE || offset > int64(len(data)) {
+		return 0, errors.New("corrupted wal segment header")
+	}
+	return offset, nil
+}
 
-			}
-		}(&mmapedDataSecondFile)
+/*
+mapSegment maps the segment file for reading.
 
-		leftoverRecSizeBytes := make([]byte, 8)
-		copy(leftoverRecSizeBytes, mmapedDataSecondFile[:8])
-		leftoverRecSize := binary.LittleEndian.Uint64(leftoverRecSizeBytes)
+Returns:
+- mmap.MMap: Content of the segment, nil for an empty file.
+- func(): Unmaps and closes the segment file.
+- error: Error, if any, during opening or mapping.
+*/
+func mapSegment(filename string) (mmap.MMap, func(), error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, errors.New("error opening segment file for reading")
+	}
 
-		wal.RepairOffset += 8
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, errors.New("error opening segment file for reading")
+	}
+	if info.Size() == 0 {
+		return nil, func() { f.Close() }, nil
+	}
 
-		recSecondPartBytes := make([]byte, leftoverRecSize)
-		copy(recSecondPartBytes, mmapedDataSecondFile[8:8+leftoverRecSize])
+	data, err := mmap.Map(f, mmap.RDONLY, 0)
+	if err != nil {
+		f.Close()
+		return nil, nil, errors.New("error mmaping file")
+	}
 
-		wal.RepairOffset += int64(leftoverRecSize)
+	return data, func() {
+		data.Unmap()
+		f.Close()
+	}, nil
+}
 
-		recBytes := append(recordFirstPartBytes, recSecondPartBytes...)
-		rec := record.BytesToRecord(recBytes)
+/*
+cutTail removes a partially written record from the end of the log,
+truncating the segment at the offset and deleting all segments after it.
 
-		if record.CrcHash(rec.GetValue()) != rec.GetCrc() {
-			return nil, 0, errors.New("crc does not match the hashed value")
+Parameters:
+- index: Index of the segment the partial record starts in.
+- offset: Offset of the partial record within the segment.
+*/
+func (wal *WAL) cutTail(index, offset int64) error {
+	for _, filename := range wal.SegmentFiles[index+1:] {
+		err := os.Remove(filename)
+		if err != nil {
+			return errors.New("error deleting file")
 		}
-
-		return rec, wal.RepairOffset, nil
 	}
+	wal.SegmentFiles = wal.SegmentFiles[:index+1]
 
-	recBytes := make([]byte, recSize)
-	copy(recBytes, mmappedData[wal.RepairOffset:wal.RepairOffset+int64(recSize)])
-
-	wal.RepairOffset += int64(recSize)
-
-	rec := record.BytesToRecord(recBytes)
-
-	if record.CrcHash(rec.GetValue()) != rec.GetCrc() {
-		return nil, 0, errors.New("error opening new segment file for writing")
+	err := os.Truncate(wal.SegmentFiles[index], offset)
+	if err != nil {
+		return errors.New("error truncating segment file")
 	}
 
-	return rec, wal.RepairOffset, nil
+	return nil
 }
 
 /*
@@ -473,7 +514,7 @@ func (wal *WAL) renameSegments() error {
 
 	for i := 0; i < len(wal.SegmentFiles); i++ {
 		oldName := wal.SegmentFiles[i]
-		newName := fmt.Sprintf("%s_%d.log", FILEPATH, i+1)
+		newName := wal.SegmentName(i + 1)
 
 		err := os.Rename(oldName, newName)
 		wal.SegmentFiles[i] = newName
@@ -1,44 +1,53 @@
 package wputils
 
 import (
-	"bufio"
 	"encoding/csv"
 	"errors"
-	"fmt"
 	"key-value-engine/structs/memtable"
 	"key-value-engine/structs/record"
 	"key-value-engine/structs/wal"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
 
-func AddRecord(manager *memtable.MemManager, walInstance *wal.WAL, restoreEndOffset int64, rec *record.Record) (int64, error) {
-	filePath := "data" + string(os.PathSeparator) + "memwal.csv"
-	var file *os.File
-	var err error
-	file, err = os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return 0, errors.New("error reading wal file")
-	}
+const (
+	MEMWALNAME = "memwal.csv"
+)
 
-	var addOffset int64
-	addOffset = restoreEndOffset
-	fileInfo, err := file.Stat()
+/*
+Family is the memtable manager of a column family together with the directory of its memwal file.
+The memwal file holds the WAL positions the memtables of the family start at, oldest first,
+all families share one WAL, which is cut only before the oldest position of all families.
+The positions are read from the file once and kept in memory, the file is written only when they change,
+that is when a memtable starts, is switched or is flushed, never for the other writes.
+*/
+type Family struct {
+	Directory  string
+	Manager    *memtable.MemManager
+	CreatedSeq uint64     // records up to it belong to a dropped family of the same name
+	marks      [][]string // lines of the memwal file, nil until loadMarks reads them
+	loaded     bool
+}
+
+func AddRecord(families map[string]*Family, walInstance *wal.WAL, restoreEndOffset int64, rec *record.Record) (int64, error) {
+	grouped, err := groupByFamily(families, rec)
 	if err != nil {
-		return 0, errors.New("error reading wal file")
+		return 0, err
 	}
 
-	if fileInfo.Size() == 0 {
-		filename := walInstance.SegmentFiles[len(walInstance.SegmentFiles)-1]
-		offset := strconv.FormatInt(addOffset, 10)
-		_, err := file.Seek(0, 2)
+	// the first record of a family marks where its memtables start
+	for name := range grouped {
+		lines, err := families[name].loadMarks()
 		if err != nil {
-			return 0, errors.New("error reading wal file")
+			return 0, err
 		}
-		_, err = file.WriteString(filename + "," + offset + "\n")
-		if err != nil {
-			return 0, errors.New("error writting wal file")
+		if len(lines) == 0 {
+			err = families[name].addMark(walInstance, restoreEndOffset)
+			if err != nil {
+				return 0, err
+			}
 		}
 	}
 
@@ -49,99 +58,102 @@ func AddRecord(manager *memtable.MemManager, walInstance *wal.WAL, restoreEndOff
 		return 0, err
 	}
 
+	addOffset := restoreEndOffset
 	addOffset += int64(len(recToBytes))
 	if addOffset > walInstance.SegmentSize {
 		addOffset %= walInstance.SegmentSize
 		addOffset += 8
 	}
-	isSwitch, isFlush, err := manager.PutMem(rec)
-	if err != nil {
-		return 0, err
-	}
-	if isSwitch {
-		filename := walInstance.SegmentFiles[len(walInstance.SegmentFiles)-1]
-		offset := strconv.FormatInt(addOffset, 10)
-		_, err := file.Seek(0, 2)
+
+	flushed := false
+	for name, records := range grouped {
+		isSwitch, isFlush, err := applyRecords(families[name].Manager, records)
 		if err != nil {
-			return 0, errors.New("error reading wal file")
+			return 0, err
 		}
-		_, err = file.WriteString(filename + "," + offset + "\n")
-		if err != nil {
-			return 0, errors.New("error reading wal file")
+		if isSwitch {
+			err = families[name].addMark(walInstance, addOffset)
+			if err != nil {
+				return 0, err
+			}
 		}
 		if isFlush {
-			_, err := file.Seek(0, 0)
+			// the oldest memtable of the family is in the SSTables, so its position is no longer needed
+			lines, err := families[name].loadMarks()
 			if err != nil {
-				return 0, errors.New("error reading wal file")
+				return 0, err
 			}
-
-			scanner := bufio.NewScanner(file)
-			if scanner.Scan() && scanner.Scan() {
-				line := scanner.Text()
-				parts := strings.Split(line, ",")
-				if len(parts) != 2 {
-					return 0, errors.New("invalid line format in CSV file")
-				}
-				lowWaterMarkFile := parts[0]
-				lowWaterMark, err := extractFileIndex(lowWaterMarkFile)
-				if err != nil {
-					return 0, err
-				}
-
-				// Delete WAL files up to lowWaterMarkFile
-				err = walInstance.DeleteLWM(uint64(lowWaterMark - 1))
-				if err != nil {
-					return 0, err
-				}
-
-				// Update CSV file by deleting the first line and subtracting lowWaterMark from the index
-				if err := updateCSVFile(filePath, lowWaterMark-1); err != nil {
-					return 0, err
-				}
-
-			} else {
+			if len(lines) < 2 {
 				return 0, errors.New("error csv file is empty")
 			}
+			err = families[name].setMarks(lines[1:])
+			if err != nil {
+				return 0, err
+			}
+			flushed = true
 		}
 	}
-	return addOffset, nil
-}
 
-func Restore(manager *memtable.MemManager, walInstance *wal.WAL) (int64, error) {
-	var retOffset int64
-	file, err := os.OpenFile("data"+string(os.PathSeparator)+"memwal.csv", os.O_RDWR|os.O_CREATE, 0666)
-	if err != nil {
-		return 0, err
+	if flushed {
+		err = flushLagging(families, walInstance)
+		if err != nil {
+			return 0, err
+		}
+		err = deleteLWM(families, walInstance)
+		if err != nil {
+			return 0, err
+		}
 	}
-	defer file.Close()
 
-	var lines [][]string
+	return addOffset, nil
+}
 
-	reader := csv.NewReader(file)
+/*
+Restore replays the WAL into the memtables of the families, starting from the oldest position any family needs.
+Records of a family that are already in its SSTables are skipped, so are the records of dropped families.
 
-	lines, err = reader.ReadAll()
-	if err != nil {
-		return 0, errors.New("error reading csv file")
-	}
+Returns:
+  - int64: Offset after the last record of the WAL.
+  - error: Error, if any, during reading the memwal files or the WAL.
+*/
+func Restore(families map[string]*Family, walInstance *wal.WAL) (int64, error) {
+	var retOffset int64
 
-	if len(lines) == 0 {
-		return 8, nil
-	}
-	var data [][]string
-	for _, line := range lines {
-		if len(line) < 2 {
-			return 0, errors.New("error reading csv file")
+	startIndex, offset := -1, int64(0)
+	for _, family := range families {
+		lines, err := family.loadMarks()
+		if err != nil {
+			return 0, err
+		}
+		if len(lines) == 0 {
+			continue
 		}
-		dataLine := []string{line[0], line[1]}
 
-		// Append the record to the data slice
-		data = append(data, dataLine)
+		index, err := extractFileIndex(lines[0][0])
+		if err != nil {
+			return 0, err
+		}
+		lineOffset, err := strconv.ParseInt(lines[0][1], 10, 64)
+		if err != nil {
+			return 0, errors.New("error reading csv file")
+		}
+		if startIndex == -1 || index < startIndex || (index == startIndex && lineOffset < offset) {
+			startIndex, offset = index, lineOffset
+		}
 	}
 
-	offset, err := strconv.ParseInt(data[0][1], 10, 64)
-	if err != nil {
-		return 0, errors.New("error reading csv file")
+	if startIndex == -1 {
+		// every memtable is flushed, the last segment is still read to find where the next record goes,
+		// starting after the part of a record it continues, since the segment before it may be deleted
+		startIndex = len(walInstance.SegmentFiles)
+		var err error
+		offset, err = walInstance.FirstRecordOffset(startIndex - 1)
+		if err != nil {
+			return 0, err
+		}
 	}
+	walInstance.RepairFileIndex = int64(startIndex - 1)
+
 	// Iterate through the records and restore
 
 	currentOffset := offset
@@ -152,60 +164,262 @@ func Restore(manager *memtable.MemManager, walInstance *wal.WAL) (int64, error)
 			retOffset = currentOffset
 			break
 		}
+		if errors.Is(err, wal.ErrChecksum) && rec.IsBatch() {
+			// a damaged batch is skipped as a whole
+			currentOffset = newOffset
+			continue
+		}
 		if err != nil {
 			return 0, err
 		}
 		currentOffset = newOffset
 
-		_, _, err = manager.PutMem(rec)
+		grouped, err := groupByFamily(families, rec)
 		if err != nil {
 			return 0, err
 		}
+		for name, records := range grouped {
+			manager := families[name].Manager
+
+			var unflushed []*record.Record
+			for _, member := range records {
+				if member.GetSeq() > manager.FlushedSeq() && member.GetSeq() > families[name].CreatedSeq {
+					unflushed = append(unflushed, member)
+				}
+			}
+			if len(unflushed) == 0 {
+				continue
+			}
+
+			_, _, err = applyRecords(manager, unflushed)
+			if err != nil {
+				return 0, err
+			}
+		}
 	}
 
 	return retOffset, nil
 }
 
-func extractFileIndex(fileName string) (int, error) {
-	parts := strings.Split(fileName, "_")
-	if len(parts) != 2 {
-		return 0, errors.New("invalid file name format")
+// groupByFamily unwraps the records of a WAL entry, a batch can hold records of several families
+func groupByFamily(families map[string]*Family, rec *record.Record) (map[string][]*record.Record, error) {
+	records := []*record.Record{rec}
+	if rec.IsBatch() {
+		var err error
+		records, err = rec.BatchRecords()
+		if err != nil {
+			return nil, err
+		}
 	}
-	indexParts := strings.Split(parts[1], ".")
-	index, err := strconv.Atoi(indexParts[0])
+
+	grouped := make(map[string][]*record.Record)
+	for _, member := range records {
+		name, unwrapped, err := member.FamilyRecord()
+		if err != nil {
+			return nil, err
+		}
+		if families[name] == nil {
+			// the family was dropped
+			continue
+		}
+		grouped[name] = append(grouped[name], unwrapped)
+	}
+
+	return grouped, nil
+}
+
+// applyRecords puts the records into the memtables, all records of a batch are put at once
+func applyRecords(manager *memtable.MemManager, records []*record.Record) (bool, bool, error) {
+	if len(records) == 1 {
+		return manager.PutMem(records[0])
+	}
+
+	return manager.PutBatch(records)
+}
+
+/*
+flushLagging flushes the memtables of the families that hold back the deletion of WAL segments,
+so a family that is rarely written does not keep the whole log.
+A family is flushed once it needs more than twice the segments needed by the family needing the fewest,
+its memwal file is emptied, so its next record marks its position again.
+*/
+func flushLagging(families map[string]*Family, walInstance *wal.WAL) error {
+	first := make(map[string]int)
+	newest := 0
+	for name, family := range families {
+		lines, err := family.loadMarks()
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		index, err := extractFileIndex(lines[0][0])
+		if err != nil {
+			return err
+		}
+		first[name] = index
+		if index > newest {
+			newest = index
+		}
+	}
+
+	last := len(walInstance.SegmentFiles)
+	for name, index := range first {
+		if last-index+1 <= 2*(last-newest+1) {
+			continue
+		}
+
+		err := families[name].Manager.FlushAll()
+		if err != nil {
+			return err
+		}
+		err = families[name].setMarks(nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+FlushAll flushes the memtables of every family and empties their memwal files,
+then deletes every WAL segment but the last one, since no family needs them for restoring.
+*/
+func FlushAll(families map[string]*Family, walInstance *wal.WAL) error {
+	for _, family := range families {
+		err := family.Manager.FlushAll()
+		if err != nil {
+			return err
+		}
+		err = family.setMarks(nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(walInstance.SegmentFiles) > 1 {
+		return walInstance.DeleteLWM(uint64(len(walInstance.SegmentFiles) - 1))
+	}
+	return nil
+}
+
+// deleteLWM deletes the WAL segments before the oldest position needed by any family
+func deleteLWM(families map[string]*Family, walInstance *wal.WAL) error {
+	lowWaterMark := -1
+	for _, family := range families {
+		lines, err := family.loadMarks()
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		index, err := extractFileIndex(lines[0][0])
+		if err != nil {
+			return err
+		}
+		if lowWaterMark == -1 || index < lowWaterMark {
+			lowWaterMark = index
+		}
+	}
+	if lowWaterMark <= 1 {
+		return nil
+	}
+
+	// Delete WAL files up to lowWaterMarkFile
+	err := walInstance.DeleteLWM(uint64(lowWaterMark - 1))
 	if err != nil {
-		return 0, errors.New("error reading csv file")
+		return err
 	}
 
-	return index, nil
+	// the remaining segments are renamed from 1, so the positions of every family are renamed the same way
+	for _, family := range families {
+		if err := updateCSVFile(family, walInstance, lowWaterMark-1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadMarks returns the positions of the family, the memwal file is read only the first time
+func (f *Family) loadMarks() ([][]string, error) {
+	if !f.loaded {
+		lines, err := readMarks(f.Directory)
+		if err != nil {
+			return nil, err
+		}
+		f.marks, f.loaded = lines, true
+	}
+	return f.marks, nil
 }
 
-func updateCSVFile(filePath string, lowWaterMark int) error {
-	file, err := os.OpenFile(filePath, os.O_RDWR, 0644)
+// setMarks replaces the positions of the family and its memwal file
+func (f *Family) setMarks(lines [][]string) error {
+	err := writeMarks(f.Directory, lines)
 	if err != nil {
-		return errors.New("error reading csv file")
+		return err
+	}
+	f.marks, f.loaded = lines, true
+	return nil
+}
+
+// addMark adds the position in the last WAL segment to the positions of the family and its memwal file
+func (f *Family) addMark(walInstance *wal.WAL, offset int64) error {
+	lines, err := f.loadMarks()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Join(f.Directory, MEMWALNAME), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.New("error reading wal file")
 	}
 	defer file.Close()
 
-	lines, err := csv.NewReader(file).ReadAll()
+	line := []string{walInstance.SegmentFiles[len(walInstance.SegmentFiles)-1], strconv.FormatInt(offset, 10)}
+	_, err = file.WriteString(line[0] + "," + line[1] + "\n")
 	if err != nil {
-		return errors.New("error reading csv file")
+		return errors.New("error writting wal file")
 	}
 
-	updatedLines := make([][]string, len(lines)-1)
-	for i, line := range lines[1:] {
+	f.marks = append(lines, line)
+	return nil
+}
+
+// readMarks returns the lines of the memwal file in the directory, creating the file if it does not exist
+func readMarks(directory string) ([][]string, error) {
+	file, err := os.OpenFile(filepath.Join(directory, MEMWALNAME), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.New("error reading csv file")
+	}
+	defer file.Close()
+
+	lines, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, errors.New("error reading csv file")
+	}
+	for _, line := range lines {
 		if len(line) < 2 {
-			return errors.New("error reading csv file")
-		}
-		updatedIndex, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line[0], "data"+string(os.PathSeparator)+"wal"+string(os.PathSeparator)+"wal_"), ".log"))
-		if err != nil {
-			return errors.New("error reading csv file")
+			return nil, errors.New("error reading csv file")
 		}
-		updatedIndex -= lowWaterMark
-		line[0] = fmt.Sprintf("data"+string(os.PathSeparator)+"wal"+string(os.PathSeparator)+"wal_%d.log", updatedIndex)
-		updatedLines[i] = line
 	}
 
+	return lines, nil
+}
+
+// writeMarks replaces the lines of the memwal file in the directory
+func writeMarks(directory string, lines [][]string) error {
+	file, err := os.OpenFile(filepath.Join(directory, MEMWALNAME), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.New("error reading csv file")
+	}
+	defer file.Close()
+
 	// Truncate the file and write updated lines
 	err = file.Truncate(0)
 	if err != nil {
@@ -217,10 +431,44 @@ func updateCSVFile(filePath string, lowWaterMark int) error {
 	}
 
 	writer := csv.NewWriter(file)
-	err = writer.WriteAll(updatedLines)
+	err = writer.WriteAll(lines)
 	if err != nil {
 		return errors.New("error writting csv file")
 	}
 
 	return nil
 }
+
+func extractFileIndex(fileName string) (int, error) {
+	parts := strings.Split(filepath.Base(fileName), "_")
+	if len(parts) != 2 {
+		return 0, errors.New("invalid file name format")
+	}
+	indexParts := strings.Split(parts[1], ".")
+	index, err := strconv.Atoi(indexParts[0])
+	if err != nil {
+		return 0, errors.New("error reading csv file")
+	}
+
+	return index, nil
+}
+
+// updateCSVFile subtracts lowWaterMark from the WAL segment index of every position of the family
+func updateCSVFile(family *Family, walInstance *wal.WAL, lowWaterMark int) error {
+	lines, err := family.loadMarks()
+	if err != nil {
+		return err
+	}
+
+	updated := make([][]string, len(lines))
+	for i, line := range lines {
+		updatedIndex, err := extractFileIndex(line[0])
+		if err != nil {
+			return err
+		}
+		updatedIndex -= lowWaterMark
+		updated[i] = []string{walInstance.SegmentName(updatedIndex), line[1]}
+	}
+
+	return family.setMarks(updated)
+}